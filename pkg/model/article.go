@@ -4,35 +4,210 @@ import "time"
 
 // Photo represents a photo uploaded by a user
 type Photo struct {
-	PhotoID    string        `json:"photoId" bson:"_id"`
-	UserID     string        `json:"userId" bson:"user_id"`     // Reference to User (Foreign Key)
-	FileName   string        `json:"fileName" bson:"file_name"` // Original filename
-	MimeType   string        `json:"mimeType" bson:"mime_type"` // e.g., "image/jpeg"
-	UploadedAt time.Time     `json:"uploadedAt" bson:"uploaded_at"`
-	Metadata   PhotoMetadata `json:"metadata" bson:"metadata"` // EXIF and other metadata
+	PhotoID         string         `json:"photoId" bson:"_id"`
+	UserID          string         `json:"userId" bson:"user_id"`     // Reference to User (Foreign Key)
+	FileName        string         `json:"fileName" bson:"file_name"` // Original filename
+	MimeType        string         `json:"mimeType" bson:"mime_type"` // e.g., "image/jpeg"
+	Title           string         `json:"title" bson:"title"`
+	Description     string         `json:"description" bson:"description"`
+	AltText         string         `json:"altText" bson:"alt_text"`                                   // Accessibility text for screen readers
+	FileSize        int64          `json:"fileSize" bson:"file_size"`                                 // Size of the original in bytes
+	Checksum        string         `json:"checksum" bson:"checksum"`                                  // Hex SHA-256 of the original
+	PerceptualHash  string         `json:"perceptualHash,omitempty" bson:"perceptual_hash,omitempty"` // Hex 64-bit DCT hash of the upright image; near-duplicates differ in few bits
+	PerceptualBands []string       `json:"-" bson:"perceptual_bands,omitempty"`                       // PerceptualHashBands of PerceptualHash, indexed for similarity search
+	ColorHistogram  []byte         `json:"-" bson:"color_histogram,omitempty"`                        // Share of pixels in each 4x4x4 RGB bin, 255 being all of them
+	UploadedAt      time.Time      `json:"uploadedAt" bson:"uploaded_at"`
+	Metadata        PhotoMetadata  `json:"metadata" bson:"metadata"`                     // EXIF and other metadata
+	Location        *GeoPoint      `json:"location,omitempty" bson:"location,omitempty"` // GeoJSON point from GPS, 2dsphere indexed
+	Place           *PhotoPlace    `json:"place,omitempty" bson:"place,omitempty"`       // Nearest known place to Location
+	Variants        []PhotoVariant `json:"variants" bson:"variants"`                     // Stored blobs, original first
+
+	Shared                bool   `json:"shared" bson:"shared"`                                      // Visible to users other than the owner
+	PrivacyMode           string `json:"privacyMode,omitempty" bson:"privacy_mode,omitempty"`       // Per-photo override; empty follows the owner's setting
+	AppliedPrivacy        string `json:"appliedPrivacy,omitempty" bson:"applied_privacy,omitempty"` // Mode the shared variant was produced with
+	AppliedPrivacyVersion int64  `json:"-" bson:"applied_privacy_version,omitempty"`                // Version of the owner's setting when AppliedPrivacy was written
+
+	Status             string     `json:"status,omitempty" bson:"status,omitempty"`                          // Background processing state, see PhotoStatus*
+	ProcessingAttempts int        `json:"processingAttempts,omitempty" bson:"processing_attempts,omitempty"` // Processing attempts started so far
+	ProcessingError    string     `json:"processingError,omitempty" bson:"processing_error,omitempty"`       // Why the last processing attempt failed
+	ProcessedAt        *time.Time `json:"processedAt,omitempty" bson:"processed_at,omitempty"`
+}
+
+// VariantOriginal is the name of the variant holding the uploaded file as-is
+const VariantOriginal = "original"
+
+// PhotoVariant describes one stored blob of a photo: the original or a resized copy
+type PhotoVariant struct {
+	Name        string `json:"name" bson:"name"` // "original" or a profile name such as "1080"
+	BlobName    string `json:"blobName" bson:"blob_name"`
+	URL         string `json:"url" bson:"url"`
+	ContentType string `json:"contentType" bson:"content_type"`
+	Width       int    `json:"width" bson:"width"`
+	Height      int    `json:"height" bson:"height"`
+	Size        int64  `json:"size" bson:"size"` // Bytes
+}
+
+// Variant returns the variant with the given name
+func (p Photo) Variant(name string) (PhotoVariant, bool) {
+	for _, v := range p.Variants {
+		if v.Name == name {
+			return v, true
+		}
+	}
+	return PhotoVariant{}, false
 }
 
-// PhotoMetadata stores extracted EXIF and technical photo data
+// PhotoMetadata stores extracted EXIF, IPTC, XMP and technical photo data.
+// Display strings are normalized ("f/2.8", "1/125s"); the numeric fields next to
+// them hold the same values for range queries and are omitted when unknown.
 type PhotoMetadata struct {
-	CameraModel      string    `json:"cameraModel" bson:"camera_model"`
-	CameraMake       string    `json:"cameraMake" bson:"camera_make"`
-	LensModel        string    `json:"lensModel" bson:"lens_model"`
-	FocalLength      string    `json:"focalLength" bson:"focal_length"`   // e.g., "50mm"
-	FNumber          string    `json:"fNumber" bson:"f_number"`           // e.g., "f/2.8"
-	ExposureTime     string    `json:"exposureTime" bson:"exposure_time"` // e.g., "1/125"
-	ISO              string    `json:"iso" bson:"iso"`
-	DateTimeOriginal time.Time `json:"dateTimeOriginal" bson:"date_time_original"` // Photo capture time
-	Width            int       `json:"width" bson:"width"`
-	Height           int       `json:"height" bson:"height"`
+	CameraModel           string    `json:"cameraModel" bson:"camera_model"`
+	CameraMake            string    `json:"cameraMake" bson:"camera_make"`
+	LensModel             string    `json:"lensModel" bson:"lens_model"`
+	LensMake              string    `json:"lensMake,omitempty" bson:"lens_make,omitempty"`
+	Software              string    `json:"software,omitempty" bson:"software,omitempty"`
+	Artist                string    `json:"artist,omitempty" bson:"artist,omitempty"`
+	Copyright             string    `json:"copyright,omitempty" bson:"copyright,omitempty"`
+	FocalLength           string    `json:"focalLength" bson:"focal_length"`   // e.g., "50mm"
+	FNumber               string    `json:"fNumber" bson:"f_number"`           // e.g., "f/2.8"
+	ExposureTime          string    `json:"exposureTime" bson:"exposure_time"` // e.g., "1/125s"
+	ISO                   string    `json:"iso" bson:"iso"`
+	ExposureBias          string    `json:"exposureBias,omitempty" bson:"exposure_bias,omitempty"`                     // e.g., "+0.7 EV"
+	ExposureProgram       string    `json:"exposureProgram,omitempty" bson:"exposure_program,omitempty"`               // e.g., "Aperture priority"
+	MeteringMode          string    `json:"meteringMode,omitempty" bson:"metering_mode,omitempty"`                     // e.g., "Multi-segment"
+	Flash                 string    `json:"flash,omitempty" bson:"flash,omitempty"`                                    // e.g., "Fired, auto mode"
+	WhiteBalance          string    `json:"whiteBalance,omitempty" bson:"white_balance,omitempty"`                     // "Auto" or "Manual"
+	FocalLengthMM         float64   `json:"focalLengthMm,omitempty" bson:"focal_length_mm,omitempty"`                  // Actual focal length in millimeters
+	FocalLength35mm       int       `json:"focalLength35mm,omitempty" bson:"focal_length_35mm,omitempty"`              // 35mm-equivalent focal length
+	Aperture              float64   `json:"aperture,omitempty" bson:"aperture,omitempty"`                              // f-number, e.g. 2.8
+	ExposureSeconds       float64   `json:"exposureSeconds,omitempty" bson:"exposure_seconds,omitempty"`               // Shutter speed in seconds
+	ISOValue              int       `json:"isoValue,omitempty" bson:"iso_value,omitempty"`                             // ISO speed as a number
+	ExposureBiasEV        *float64  `json:"exposureBiasEv,omitempty" bson:"exposure_bias_ev,omitempty"`                // Exposure compensation in EV
+	FlashFired            *bool     `json:"flashFired,omitempty" bson:"flash_fired,omitempty"`                         // Nil when the camera did not record flash
+	DateTimeOriginal      time.Time `json:"dateTimeOriginal" bson:"date_time_original"`                                // Capture instant in UTC
+	LocalDateTimeOriginal string    `json:"localDateTimeOriginal,omitempty" bson:"local_date_time_original,omitempty"` // Wall-clock capture time, e.g. "2024-05-01T18:42:10"
+	LocalMinuteOfDay      *int      `json:"localMinuteOfDay,omitempty" bson:"local_minute_of_day,omitempty"`           // Wall-clock minutes since midnight, 0-1439
+	TimeZone              string    `json:"timeZone,omitempty" bson:"time_zone,omitempty"`                             // IANA name ("Asia/Seoul") or UTC offset ("+09:00")
+	TimeZoneSource        string    `json:"timeZoneSource,omitempty" bson:"time_zone_source,omitempty"`                // How TimeZone was determined, see TimeZoneSource*
+	DateSource            string    `json:"dateSource,omitempty" bson:"date_source,omitempty"`                         // Where DateTimeOriginal came from, see DateSource*
+	DateConfidence        string    `json:"dateConfidence,omitempty" bson:"date_confidence,omitempty"`                 // "high", "medium" or "low"
+	OffsetTime            string    `json:"offsetTime,omitempty" bson:"offset_time,omitempty"`                         // UTC offset of DateTime, e.g. "+09:00"
+	OffsetTimeOriginal    string    `json:"offsetTimeOriginal,omitempty" bson:"offset_time_original,omitempty"`
+	OffsetTimeDigitized   string    `json:"offsetTimeDigitized,omitempty" bson:"offset_time_digitized,omitempty"`
+	Width                 int       `json:"width" bson:"width"`             // Displayed width, after orientation
+	Height                int       `json:"height" bson:"height"`           // Displayed height, after orientation
+	Orientation           int       `json:"orientation" bson:"orientation"` // EXIF orientation 1-8, 0 if absent
+	GPS                   *GPSInfo  `json:"gps,omitempty" bson:"gps,omitempty"`
+
+	// IPTC and XMP descriptive metadata
+	Keywords []string `json:"keywords,omitempty" bson:"keywords,omitempty"` // IPTC keywords merged with XMP dc:subject
+	Caption  string   `json:"caption,omitempty" bson:"caption,omitempty"`   // IPTC caption, or XMP dc:description
+	Rating   *int     `json:"rating,omitempty" bson:"rating,omitempty"`     // XMP rating, -1 (rejected) to 5
+	Label    string   `json:"label,omitempty" bson:"label,omitempty"`       // XMP color label, e.g. "Red"
+}
+
+// How the time zone of a capture time was determined
+const (
+	TimeZoneSourceExif              = "exif_offset"         // OffsetTimeOriginal tag
+	TimeZoneSourceGPSLocation       = "gps_location"        // Zone of the place nearest the GPS position, its offset confirmed by the GPS timestamp
+	TimeZoneSourceGPSLocationApprox = "gps_location_approx" // Zone of the place nearest the GPS position, or its longitude band at sea; may be wrong near zone borders
+	TimeZoneSourceGPSTime           = "gps_time"            // Difference between local time and the UTC GPS timestamp
+	TimeZoneSourceEmbedded          = "embedded"            // Offset written with an XMP or PNG date
+	TimeZoneSourceUser              = "user"                // Set when the capture date was corrected
+	TimeZoneSourceUnknown           = "unknown"             // No zone found; the wall-clock time was taken as UTC
+)
+
+// GPSDerivedTimeZone reports whether source names a zone looked up from the GPS position
+func GPSDerivedTimeZone(source string) bool {
+	return source == TimeZoneSourceGPSLocation || source == TimeZoneSourceGPSLocationApprox
+}
+
+// Where a capture date came from, most reliable first
+const (
+	DateSourceExif     = "exif"     // EXIF DateTimeOriginal
+	DateSourceXMP      = "xmp"      // XMP exif:DateTimeOriginal, photoshop:DateCreated or xmp:CreateDate
+	DateSourcePNGText  = "png_text" // PNG "Creation Time" text chunk
+	DateSourceFileName = "filename" // Camera, screenshot or messenger file name pattern
+	DateSourcePNGTime  = "png_time" // PNG tIME chunk, the last modification time
+	DateSourceUser     = "user"     // Corrected by the owner
+)
+
+// How much an inferred capture date can be trusted
+const (
+	DateConfidenceHigh   = "high"   // Written by the capturing device or the owner
+	DateConfidenceMedium = "medium" // Written by software, or a full timestamp in the file name
+	DateConfidenceLow    = "low"    // Only a date, or a time that may be a later modification
+)
+
+// GPSInfo stores the position recorded by the camera
+type GPSInfo struct {
+	Latitude  float64    `json:"latitude" bson:"latitude"`                       // Decimal degrees, north positive
+	Longitude float64    `json:"longitude" bson:"longitude"`                     // Decimal degrees, east positive
+	Altitude  *float64   `json:"altitude,omitempty" bson:"altitude,omitempty"`   // Meters above sea level
+	Timestamp *time.Time `json:"timestamp,omitempty" bson:"timestamp,omitempty"` // UTC time from GPSDateStamp/GPSTimeStamp
+}
+
+// PhotoPlace is a human-readable place resolved offline from a photo's GPS position
+type PhotoPlace struct {
+	City        string `json:"city" bson:"city"`
+	Region      string `json:"region" bson:"region"` // State, province or similar first-level division
+	Country     string `json:"country" bson:"country"`
+	CountryCode string `json:"countryCode" bson:"country_code"` // ISO 3166-1 alpha-2
+}
+
+// PlaceSummary is one place in a gallery grouped by place
+type PlaceSummary struct {
+	City         string    `json:"city" bson:"city"`
+	Region       string    `json:"region" bson:"region"`
+	Country      string    `json:"country" bson:"country"`
+	CountryCode  string    `json:"countryCode" bson:"country_code"`
+	Count        int       `json:"count" bson:"count"`
+	CoverPhotoID string    `json:"coverPhotoId" bson:"cover_photo_id"` // Most recently uploaded photo taken there
+	LatestUpload time.Time `json:"latestUpload" bson:"latest_upload"`
+}
+
+// GeoPoint is a GeoJSON point; coordinates are [longitude, latitude]
+type GeoPoint struct {
+	Type        string    `json:"type" bson:"type"`
+	Coordinates []float64 `json:"coordinates" bson:"coordinates"`
+}
+
+// NewGeoPoint creates a GeoJSON point from latitude and longitude
+func NewGeoPoint(latitude, longitude float64) *GeoPoint {
+	return &GeoPoint{Type: "Point", Coordinates: []float64{longitude, latitude}}
+}
+
+// PhotoNearResult is a photo returned by a proximity query with its distance from the query point
+type PhotoNearResult struct {
+	Photo    `bson:",inline"`
+	Distance float64 `json:"distance" bson:"distance"` // Meters
 }
 
 // PhotoUploadRequest represents the API request for uploading a photo
 type PhotoUploadRequest struct {
 	Title       string `json:"title"`
 	Description string `json:"description"`
+	AltText     string `json:"altText"`
 	// File is handled separately via multipart form data
 }
 
+// PhotoUpdateRequest represents the API request for editing photo details.
+// Nil fields are left unchanged.
+type PhotoUpdateRequest struct {
+	Title       *string `json:"title,omitempty"`
+	Description *string `json:"description,omitempty"`
+	AltText     *string `json:"altText,omitempty"`
+}
+
+// CaptureDateRequest represents the API request for correcting a photo's capture date.
+// DateTime is RFC 3339 ("2024-01-02T15:04:05+09:00") or a local wall-clock time
+// ("2024-01-02T15:04:05" or "2024-01-02"). TimeZone, an IANA name or "+09:00" offset,
+// places a local time; it defaults to the photo's current zone.
+type CaptureDateRequest struct {
+	DateTime string `json:"dateTime"`
+	TimeZone string `json:"timeZone,omitempty"`
+}
+
 // PhotoQueryResponse represents the API response for photo metadata
 type PhotoQueryResponse struct {
 	Photo Photo `json:"photo"`
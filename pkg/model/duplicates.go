@@ -0,0 +1,57 @@
+package model
+
+import "fmt"
+
+// PhotoHash holds the image features of one photo, as loaded for near-duplicate grouping
+// and similarity search
+type PhotoHash struct {
+	PhotoID        string `bson:"_id"`
+	UserID         string `bson:"user_id"`
+	PerceptualHash string `bson:"perceptual_hash"`
+	ColorHistogram []byte `bson:"color_histogram,omitempty"`
+}
+
+// PerceptualHashBands splits a hex perceptual hash into its eight bytes, each labelled with
+// its position ("0:d2", "1:4e", ...), so an index on the bands finds candidates without
+// scanning the library. Differing bits can spoil at most as many bands, so hashes up to 7 bits
+// apart always share a band; further apart they may share none and are only found if the
+// differences happen to cluster in a few bytes. Malformed hashes have no bands.
+func PerceptualHashBands(hash string) []string {
+	if len(hash) != 16 {
+		return nil
+	}
+	bands := make([]string, 8)
+	for i := range bands {
+		bands[i] = fmt.Sprintf("%d:%s", i, hash[2*i:2*i+2])
+	}
+	return bands
+}
+
+// DuplicateGroup is a set of photos whose perceptual hashes are linked by chains of
+// near matches, oldest upload first
+type DuplicateGroup struct {
+	Photos      []Photo `json:"photos"`
+	Count       int     `json:"count"`
+	MaxDistance int     `json:"maxDistance"` // Largest Hamming distance between two photos of the group
+}
+
+// DuplicateGroups are a user's near-duplicate photos, largest group first
+type DuplicateGroups struct {
+	Distance int              `json:"distance"` // Hamming distance up to which two photos count as near-duplicates
+	Groups   []DuplicateGroup `json:"groups"`
+	Count    int              `json:"count"`
+}
+
+// SimilarPhoto is one result of a similar-photos search
+type SimilarPhoto struct {
+	Photo    Photo   `json:"photo"`
+	Score    float64 `json:"score"`    // 0 to 1, higher is more similar
+	Distance int     `json:"distance"` // Hamming distance between the perceptual hashes
+}
+
+// SimilarPhotos are the photos most similar to one photo, best match first
+type SimilarPhotos struct {
+	PhotoID string         `json:"photoId"`
+	Results []SimilarPhoto `json:"results"`
+	Count   int            `json:"count"`
+}
@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+// IdempotencyRecord is what is remembered about a request sent with an Idempotency-Key:
+// a fingerprint of the request and, once it has finished, the response to replay
+type IdempotencyRecord struct {
+	Fingerprint string              `json:"fingerprint"` // Hex SHA-256 of method, path and payload, set once the request finished
+	InFlight    bool                `json:"inFlight"`    // The first request has not finished yet
+	StatusCode  int                 `json:"statusCode,omitempty"`
+	Header      map[string][]string `json:"header,omitempty"`
+	Body        []byte              `json:"body,omitempty"`
+	CreatedAt   time.Time           `json:"createdAt"`
+}
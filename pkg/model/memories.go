@@ -0,0 +1,18 @@
+package model
+
+// MemoryYear holds the photos captured around the same day of the year in one earlier year
+type MemoryYear struct {
+	Year     int     `json:"year"`
+	YearsAgo int     `json:"yearsAgo"`
+	Photos   []Photo `json:"photos"`
+	Count    int     `json:"count"`
+}
+
+// Memories are a user's photos captured on a day of the year in earlier years, most recent year first
+type Memories struct {
+	Date     string       `json:"date"` // YYYY-MM-DD in TimeZone
+	TimeZone string       `json:"timeZone"`
+	Window   int          `json:"window"` // Days either side of Date
+	Years    []MemoryYear `json:"years"`
+	Count    int          `json:"count"`
+}
@@ -0,0 +1,71 @@
+package model
+
+// Privacy modes control what non-owners receive when a photo is shared.
+// The owner always sees the original and the full extracted metadata.
+const (
+	PrivacyModeNone     = "none"      // Serve the original as uploaded
+	PrivacyModeStripGPS = "strip_gps" // Remove GPS tags and location, keep other metadata
+	PrivacyModeStripAll = "strip_all" // Remove all metadata
+
+	// DefaultPrivacyMode applies to users who never chose a mode
+	DefaultPrivacyMode = PrivacyModeStripGPS
+)
+
+// VariantShared is the name of the sanitized full-size copy served to non-owners in place of the original
+const VariantShared = "shared"
+
+// ValidPrivacyMode reports whether mode is one of the PrivacyMode* values
+func ValidPrivacyMode(mode string) bool {
+	switch mode {
+	case PrivacyModeNone, PrivacyModeStripGPS, PrivacyModeStripAll:
+		return true
+	}
+	return false
+}
+
+// PrivacySettings is a user's default privacy mode for shared photos
+type PrivacySettings struct {
+	PrivacyMode string `json:"privacyMode"`
+}
+
+// PhotoPrivacyRequest represents the API request for changing a photo's sharing and privacy.
+// Nil fields are left unchanged; an empty privacyMode makes the photo follow the owner's setting.
+type PhotoPrivacyRequest struct {
+	Shared      *bool   `json:"shared,omitempty"`
+	PrivacyMode *string `json:"privacyMode,omitempty"`
+}
+
+// SharedView returns the photo as seen by users other than its owner, with metadata
+// removed according to AppliedPrivacy and the original replaced by the shared variant.
+// Photos without an applied mode are treated as strip_all.
+func (p Photo) SharedView() Photo {
+	view := p
+	view.PrivacyMode = ""
+	view.Checksum = ""
+	view.PerceptualHash = ""
+
+	switch p.AppliedPrivacy {
+	case PrivacyModeNone:
+		return view
+	case PrivacyModeStripGPS:
+		view.Metadata.GPS = nil
+		// A zone looked up from the GPS position names the region the photo was taken in
+		if GPSDerivedTimeZone(p.Metadata.TimeZoneSource) {
+			view.Metadata.TimeZone = ""
+			view.Metadata.TimeZoneSource = ""
+		}
+	default:
+		view.Metadata = PhotoMetadata{Width: p.Metadata.Width, Height: p.Metadata.Height}
+	}
+	view.Location = nil
+	view.Place = nil
+
+	// The original still carries every tag; only the sanitized copy and resized variants are exposed
+	view.Variants = nil
+	for _, v := range p.Variants {
+		if v.Name != VariantOriginal {
+			view.Variants = append(view.Variants, v)
+		}
+	}
+	return view
+}
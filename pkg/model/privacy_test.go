@@ -0,0 +1,52 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSharedViewTimeZone(t *testing.T) {
+	tests := []struct {
+		name           string
+		privacy        string
+		zone           string
+		source         string
+		wantZone       string
+		wantZoneSource string
+	}{
+		{"none keeps gps zone", PrivacyModeNone, "America/Indiana/Knox", TimeZoneSourceGPSLocation, "America/Indiana/Knox", TimeZoneSourceGPSLocation},
+		{"strip_gps drops gps zone", PrivacyModeStripGPS, "America/Indiana/Knox", TimeZoneSourceGPSLocation, "", ""},
+		{"strip_gps drops approximate gps zone", PrivacyModeStripGPS, "Asia/Seoul", TimeZoneSourceGPSLocationApprox, "", ""},
+		{"strip_gps keeps exif offset", PrivacyModeStripGPS, "-06:00", TimeZoneSourceExif, "-06:00", TimeZoneSourceExif},
+		{"strip_gps keeps gps time offset", PrivacyModeStripGPS, "-06:00", TimeZoneSourceGPSTime, "-06:00", TimeZoneSourceGPSTime},
+		{"strip_all drops gps zone", PrivacyModeStripAll, "America/Indiana/Knox", TimeZoneSourceGPSLocation, "", ""},
+		{"strip_all drops exif offset", PrivacyModeStripAll, "-06:00", TimeZoneSourceExif, "", ""},
+		{"unapplied drops gps zone", "", "America/Indiana/Knox", TimeZoneSourceGPSLocation, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			photo := Photo{
+				AppliedPrivacy: tt.privacy,
+				Location:       NewGeoPoint(41.3, -86.6),
+				Place:          &PhotoPlace{City: "Knox", CountryCode: "US"},
+				Metadata: PhotoMetadata{
+					DateTimeOriginal: time.Date(2024, 5, 1, 23, 42, 10, 0, time.UTC),
+					TimeZone:         tt.zone,
+					TimeZoneSource:   tt.source,
+					GPS:              &GPSInfo{Latitude: 41.3, Longitude: -86.6},
+				},
+			}
+			view := photo.SharedView()
+			if view.Metadata.TimeZone != tt.wantZone || view.Metadata.TimeZoneSource != tt.wantZoneSource {
+				t.Fatalf("SharedView() zone = %q, %q; want %q, %q",
+					view.Metadata.TimeZone, view.Metadata.TimeZoneSource, tt.wantZone, tt.wantZoneSource)
+			}
+			if tt.privacy != PrivacyModeNone && (view.Metadata.GPS != nil || view.Location != nil || view.Place != nil) {
+				t.Fatalf("SharedView() kept the location: %+v", view)
+			}
+			if photo.Metadata.TimeZone != tt.zone {
+				t.Fatalf("SharedView() modified the owner's photo")
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package model
+
+import "time"
+
+// Processing states of a photo. Uploads are stored as pending; a background job generates
+// the resized variants, hashes and derived metadata and marks the photo ready, or failed
+// once its retries are used up. Photos stored before background processing have no status
+// and are ready.
+const (
+	PhotoStatusPending    = "pending"
+	PhotoStatusProcessing = "processing"
+	PhotoStatusReady      = "ready"
+	PhotoStatusFailed     = "failed"
+)
+
+// Processing reports whether the background job of the photo has yet to finish
+func (p Photo) Processing() bool {
+	return p.Status == PhotoStatusPending || p.Status == PhotoStatusProcessing
+}
+
+// Kinds of processing job. Jobs queued before kinds existed have none and are uploads.
+const (
+	ProcessingJobUpload       = "upload"        // Finish processing an uploaded photo
+	ProcessingJobUserPrivacy  = "user_privacy"  // Queue a photo privacy job for each photo following the owner's mode
+	ProcessingJobPhotoPrivacy = "photo_privacy" // Regenerate the shared copy of one photo under the owner's mode
+)
+
+// ProcessingJob asks a worker to finish processing an uploaded photo, or to bring shared
+// copies up to a changed default privacy mode
+type ProcessingJob struct {
+	Kind       string    `json:"kind,omitempty"` // One of ProcessingJob*
+	PhotoID    string    `json:"photoId,omitempty"`
+	UserID     string    `json:"userId"`
+	EnqueuedAt time.Time `json:"enqueuedAt"`
+
+	// Privacy jobs: the mode to apply and the version of the owner's setting it was set as.
+	// Jobs of a superseded version drop their writes.
+	PrivacyMode    string `json:"privacyMode,omitempty"`
+	PrivacyVersion int64  `json:"privacyVersion,omitempty"`
+	// User privacy jobs: cursor of the last photo an earlier run of the job got to
+	After string `json:"after,omitempty"`
+}
+
+// PhotoStatus is the processing state of a photo as reported to its owner
+type PhotoStatus struct {
+	PhotoID     string     `json:"photoId"`
+	Status      string     `json:"status"`             // One of PhotoStatus*
+	Attempts    int        `json:"attempts,omitempty"` // Processing attempts started so far
+	Error       string     `json:"error,omitempty"`    // Why the last attempt failed
+	ProcessedAt *time.Time `json:"processedAt,omitempty"`
+}
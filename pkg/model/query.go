@@ -0,0 +1,119 @@
+package model
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Photo fields a gallery can be sorted by
+const (
+	PhotoSortUploaded = "uploaded" // UploadedAt
+	PhotoSortCaptured = "captured" // Metadata.DateTimeOriginal
+	PhotoSortFileName = "filename" // FileName
+	PhotoSortFileSize = "size"     // FileSize
+)
+
+// Date fields a gallery can be filtered on
+const (
+	DateFieldUploaded = "uploaded" // UploadedAt
+	DateFieldCaptured = "captured" // Metadata.DateTimeOriginal; photos without a capture date never match
+)
+
+// PhotoSort is the order of a photo list; ties are broken by photo ID in the same direction
+type PhotoSort struct {
+	Field      string // One of PhotoSort*
+	Descending bool
+}
+
+// DefaultPhotoSort lists the most recent uploads first
+var DefaultPhotoSort = PhotoSort{Field: PhotoSortUploaded, Descending: true}
+
+// ValidPhotoSortField reports whether field is one of PhotoSort*
+func ValidPhotoSortField(field string) bool {
+	switch field {
+	case PhotoSortUploaded, PhotoSortCaptured, PhotoSortFileName, PhotoSortFileSize:
+		return true
+	}
+	return false
+}
+
+// TimeRange is the half-open interval from Start up to but excluding End
+type TimeRange struct {
+	Start time.Time
+	End   time.Time
+}
+
+// PhotoPage is one page of a photo listing. NextCursor is empty on the last page.
+type PhotoPage struct {
+	Photos     []Photo `json:"photos"`
+	Count      int     `json:"count"`
+	NextCursor string  `json:"nextCursor,omitempty"`
+}
+
+// ErrInvalidCursor is returned when a cursor is malformed or was issued for another sort order
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// PhotoCursor is the position after the last photo of a page: its value of the sort field
+// and its ID. Clients only see it as an opaque token.
+type PhotoCursor struct {
+	Sort    PhotoSort
+	Value   interface{} // time.Time, string or int64 depending on Sort.Field
+	PhotoID string
+}
+
+// cursorToken is the JSON inside the base64url cursor token
+type cursorToken struct {
+	Field      string     `json:"f"`
+	Descending bool       `json:"d,omitempty"`
+	Time       *time.Time `json:"t,omitempty"`
+	Text       *string    `json:"s,omitempty"`
+	Number     *int64     `json:"n,omitempty"`
+	PhotoID    string     `json:"id"`
+}
+
+// NewPhotoCursor returns the token of the position after last in a listing ordered by sort
+func NewPhotoCursor(sort PhotoSort, last Photo) string {
+	token := cursorToken{Field: sort.Field, Descending: sort.Descending, PhotoID: last.PhotoID}
+	switch sort.Field {
+	case PhotoSortUploaded:
+		token.Time = &last.UploadedAt
+	case PhotoSortCaptured:
+		token.Time = &last.Metadata.DateTimeOriginal
+	case PhotoSortFileName:
+		token.Text = &last.FileName
+	case PhotoSortFileSize:
+		token.Number = &last.FileSize
+	}
+	data, _ := json.Marshal(token)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// ParsePhotoCursor decodes a token from NewPhotoCursor, checking that it belongs to sort
+func ParsePhotoCursor(token string, sort PhotoSort) (*PhotoCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var t cursorToken
+	if err := json.Unmarshal(data, &t); err != nil || t.PhotoID == "" {
+		return nil, ErrInvalidCursor
+	}
+	if t.Field != sort.Field || t.Descending != sort.Descending {
+		return nil, ErrInvalidCursor
+	}
+
+	cursor := &PhotoCursor{Sort: sort, PhotoID: t.PhotoID}
+	switch {
+	case (sort.Field == PhotoSortUploaded || sort.Field == PhotoSortCaptured) && t.Time != nil:
+		cursor.Value = *t.Time
+	case sort.Field == PhotoSortFileName && t.Text != nil:
+		cursor.Value = *t.Text
+	case sort.Field == PhotoSortFileSize && t.Number != nil:
+		cursor.Value = *t.Number
+	default:
+		return nil, ErrInvalidCursor
+	}
+	return cursor, nil
+}
@@ -0,0 +1,75 @@
+package model
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPhotoCursorRoundTrip(t *testing.T) {
+	last := Photo{
+		PhotoID:    "photo-2",
+		FileName:   "IMG_0002.jpg",
+		FileSize:   4 << 20,
+		UploadedAt: time.Date(2024, 1, 2, 15, 30, 45, 123000000, time.UTC),
+		Metadata:   PhotoMetadata{DateTimeOriginal: time.Date(2023, 12, 31, 23, 59, 59, 0, time.UTC)},
+	}
+	tests := []struct {
+		field string
+		want  interface{}
+	}{
+		{PhotoSortUploaded, last.UploadedAt},
+		{PhotoSortCaptured, last.Metadata.DateTimeOriginal},
+		{PhotoSortFileName, last.FileName},
+		{PhotoSortFileSize, last.FileSize},
+	}
+	for _, tt := range tests {
+		for _, descending := range []bool{false, true} {
+			sort := PhotoSort{Field: tt.field, Descending: descending}
+			cursor, err := ParsePhotoCursor(NewPhotoCursor(sort, last), sort)
+			if err != nil {
+				t.Fatalf("ParsePhotoCursor(%+v) error = %v", sort, err)
+			}
+			if cursor.Sort != sort || cursor.PhotoID != last.PhotoID {
+				t.Fatalf("ParsePhotoCursor(%+v) = %+v, %q", sort, cursor.Sort, cursor.PhotoID)
+			}
+			if got, ok := cursor.Value.(time.Time); ok {
+				if !got.Equal(tt.want.(time.Time)) {
+					t.Fatalf("ParsePhotoCursor(%+v) value = %v, want %v", sort, got, tt.want)
+				}
+			} else if cursor.Value != tt.want {
+				t.Fatalf("ParsePhotoCursor(%+v) value = %#v, want %#v", sort, cursor.Value, tt.want)
+			}
+		}
+	}
+}
+
+func TestParsePhotoCursorInvalid(t *testing.T) {
+	last := Photo{PhotoID: "photo-1", FileName: "a.jpg"}
+	raw := func(json string) string { return base64.RawURLEncoding.EncodeToString([]byte(json)) }
+
+	tests := []struct {
+		name  string
+		token string
+		sort  PhotoSort
+	}{
+		{"empty", "", DefaultPhotoSort},
+		{"not base64", "not a cursor!", DefaultPhotoSort},
+		{"padded base64", base64.URLEncoding.EncodeToString([]byte(`{"f":"uploaded","d":true,"t":"2024-01-02T00:00:00Z","id":"x"}`)), DefaultPhotoSort},
+		{"not json", raw("uploaded"), DefaultPhotoSort},
+		{"missing photo id", raw(`{"f":"uploaded","d":true,"t":"2024-01-02T00:00:00Z"}`), DefaultPhotoSort},
+		{"other field", NewPhotoCursor(PhotoSort{Field: PhotoSortFileName, Descending: true}, last), DefaultPhotoSort},
+		{"other direction", NewPhotoCursor(PhotoSort{Field: PhotoSortUploaded}, last), DefaultPhotoSort},
+		{"missing value", raw(`{"f":"uploaded","d":true,"id":"x"}`), DefaultPhotoSort},
+		{"value of the wrong type", raw(`{"f":"size","s":"big","id":"x"}`), PhotoSort{Field: PhotoSortFileSize}},
+		{"unknown field", raw(`{"f":"rating","n":5,"id":"x"}`), PhotoSort{Field: "rating"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParsePhotoCursor(tt.token, tt.sort); !errors.Is(err, ErrInvalidCursor) {
+				t.Fatalf("ParsePhotoCursor() error = %v, want ErrInvalidCursor", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,23 @@
+package model
+
+// Timeline granularities
+const (
+	TimelineDay   = "day"
+	TimelineMonth = "month"
+	TimelineYear  = "year"
+)
+
+// TimelineBucket is the number of photos captured in one period
+type TimelineBucket struct {
+	Period string `json:"period" bson:"period"` // "2024", "2024-05" or "2024-05-01" in the requested time zone
+	Count  int    `json:"count" bson:"count"`
+}
+
+// Timeline counts a user's photos per period of capture date, most recent period first
+type Timeline struct {
+	Granularity string           `json:"granularity"`
+	TimeZone    string           `json:"timeZone"`
+	Buckets     []TimelineBucket `json:"buckets"`
+	Undated     int              `json:"undated"` // Photos without a capture date
+	Total       int              `json:"total"`
+}
@@ -0,0 +1,32 @@
+package model
+
+import "time"
+
+// ResumableUpload tracks the state of a tus resumable upload between requests
+type ResumableUpload struct {
+	UploadID    string    `json:"uploadId"`
+	UserID      string    `json:"userId"`
+	Length      int64     `json:"length"` // Total size declared by Upload-Length
+	Offset      int64     `json:"offset"` // Bytes staged so far
+	FileName    string    `json:"fileName"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	AltText     string    `json:"altText"`
+	BlockIDs    []string  `json:"blockIds"`            // Azure block IDs staged so far, in order
+	Committed   bool      `json:"committed,omitempty"` // Blocks are committed; a retried final PATCH only reprocesses the blob
+	PhotoID     string    `json:"photoId,omitempty"`   // Set once the upload has been processed
+	Duplicate   bool      `json:"duplicate,omitempty"` // PhotoID is an earlier upload of the same content
+	CreatedAt   time.Time `json:"createdAt"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+}
+
+// UploadCheckRequest lists the SHA-256 hashes of files a client is about to upload
+type UploadCheckRequest struct {
+	Hashes []string `json:"hashes"` // Hex SHA-256 of each original file
+}
+
+// UploadCheckResponse splits the requested hashes into content already stored and files to upload
+type UploadCheckResponse struct {
+	Existing map[string]string `json:"existing"` // Hash to the ID of the photo with that content
+	Missing  []string          `json:"missing"`
+}
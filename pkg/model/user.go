@@ -10,6 +10,7 @@ type User struct {
 	PasswordHash string    `json:"-" bson:"password_hash"` // bcrypt hash (if used)
 	Roles        []string  `json:"roles" bson:"roles"`     // e.g., ["user","admin"]
 	IsActive     bool      `json:"isActive" bson:"is_active"`
+	PrivacyMode  string    `json:"privacyMode,omitempty" bson:"privacy_mode,omitempty"` // Default for shared photos, see PrivacyMode*
 	LastSeen     time.Time `json:"lastSeen" bson:"last_seen"`
 	UpdatedAt    time.Time `json:"updatedAt" bson:"updated_at"`
 	CreatedAt    time.Time `json:"createdAt" bson:"created_at"`
@@ -16,6 +16,61 @@ const (
 	// MaxUploadFileSize is the maximum allowed file upload size (32MB).
 	MaxUploadFileSize = 32 << 20
 
+	// MultipartMemoryLimit is how much of a multipart body is kept in memory; larger parts spill to disk.
+	MultipartMemoryLimit = 1 << 20
+
+	// MaxMultipartOverhead allows room for form fields and boundaries on top of MaxUploadFileSize.
+	MaxMultipartOverhead = 1 << 20
+
+	// MaxPhotoTitleLength is the maximum number of characters in a photo title.
+	MaxPhotoTitleLength = 200
+
+	// MaxPhotoDescriptionLength is the maximum number of characters in a photo description.
+	MaxPhotoDescriptionLength = 2000
+
+	// MaxPhotoAltTextLength is the maximum number of characters in photo alt text.
+	MaxPhotoAltTextLength = 500
+
+	// MaxBatchUploadFiles is the maximum number of files accepted by one batch upload.
+	MaxBatchUploadFiles = 50
+
+	// MaxBatchUploadSize is the maximum total body size of a batch upload (256MB).
+	MaxBatchUploadSize = 256 << 20
+
+	// BatchUploadConcurrency is how many files of a batch are processed at once.
+	BatchUploadConcurrency = 4
+
+	// MaxUploadCheckHashes is the maximum number of hashes accepted by one upload check.
+	MaxUploadCheckHashes = 1000
+
+	// ResumableUploadTTL is how long an unfinished tus upload can be resumed.
+	ResumableUploadTTL = 24 * time.Hour
+
+	// IdempotencyKeyTTL is how long the response to a request with an Idempotency-Key is replayed by default.
+	IdempotencyKeyTTL = 24 * time.Hour
+
+	// MaxIdempotencyKeyLength is the maximum length of an Idempotency-Key header.
+	MaxIdempotencyKeyLength = 255
+
+	// DefaultProcessingWorkers is how many background processing jobs run at once per instance.
+	DefaultProcessingWorkers = 2
+
+	// MaxProcessingAttempts is how often a processing job is tried before it is dead-lettered.
+	MaxProcessingAttempts = 5
+
+	// ProcessingJobTimeout bounds one attempt at processing a photo.
+	ProcessingJobTimeout = 2 * time.Minute
+
+	// ProcessingRetryDelay is how long a delivered job stays unacknowledged before another
+	// worker retries it; it must exceed ProcessingJobTimeout so running jobs are not taken over.
+	ProcessingRetryDelay = 3 * time.Minute
+
+	// DefaultPageSize is the number of photos per page when a listing does not specify a limit.
+	DefaultPageSize = 50
+
+	// MaxPageSize caps the number of photos per page of a listing.
+	MaxPageSize = 200
+
 	// DefaultPhotoContainerName is the Azure Blob Storage container for photos.
 	DefaultPhotoContainerName = "photos"
 
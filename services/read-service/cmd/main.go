@@ -32,8 +32,24 @@ func main() {
 	cosmosRepo := repository.NewCosmosDBRepository(cosmosURI, dbName)
 	redisRepo := repository.NewRedisRepository(redisAddr, "")
 
+	// Azure Blob Storage is optional; without it photo files are not served
+	var blobRepo repository.AzureBlobRepository
+	if azureConnString := os.Getenv("AZURE_STORAGE_CONNECTION_STRING"); azureConnString != "" {
+		azureContainerName := os.Getenv("AZURE_STORAGE_CONTAINER_NAME")
+		if azureContainerName == "" {
+			azureContainerName = "photos"
+		}
+		repo, err := repository.NewAzureBlobRepository(azureConnString, azureContainerName)
+		if err != nil {
+			log.Fatalf("Failed to initialize Azure Blob Storage: %v", err)
+		}
+		blobRepo = repo
+	} else {
+		log.Println("warning: AZURE_STORAGE_CONNECTION_STRING not set; photo file endpoint disabled")
+	}
+
 	// 2. Initialize Service Layer
-	galleryService := service.NewGalleryService(cosmosRepo, redisRepo)
+	galleryService := service.NewGalleryService(cosmosRepo, redisRepo, blobRepo)
 
 	// 3. Initialize Handler Layer
 	galleryHandler := handler.NewGalleryHandler(galleryService, service.NewAnalyticsClient("http://localhost:8082"))
@@ -43,8 +59,20 @@ func main() {
 
 	// Photo retrieval endpoints
 	mux.HandleFunc("GET /api/gallery/photo/{photoId}", galleryHandler.GetPhoto)
+	mux.HandleFunc("GET /api/gallery/photo/{photoId}/similar", galleryHandler.GetSimilarPhotos)
 	mux.HandleFunc("GET /api/gallery", galleryHandler.GetGallery)
+	if blobRepo != nil {
+		mux.HandleFunc("GET /api/gallery/photo/{photoId}/file", galleryHandler.GetPhotoFile)
+	}
 	mux.HandleFunc("GET /api/gallery/date", galleryHandler.GetGalleryByDateRange)
+	mux.HandleFunc("GET /api/gallery/geo/bbox", galleryHandler.GetGalleryInBoundingBox)
+	mux.HandleFunc("GET /api/gallery/geo/near", galleryHandler.GetGalleryNear)
+	mux.HandleFunc("GET /api/gallery/place", galleryHandler.GetGalleryByPlace)
+	mux.HandleFunc("GET /api/gallery/places", galleryHandler.GetGalleryPlaces)
+	mux.HandleFunc("GET /api/gallery/timeofday", galleryHandler.GetGalleryByTimeOfDay)
+	mux.HandleFunc("GET /api/gallery/timeline", galleryHandler.GetGalleryTimeline)
+	mux.HandleFunc("GET /api/gallery/memories", galleryHandler.GetGalleryMemories)
+	mux.HandleFunc("GET /api/gallery/duplicates", galleryHandler.GetGalleryDuplicates)
 
 	// Health check
 	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
@@ -4,9 +4,17 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log"
+	"math"
 	"net/http"
+	"net/url"
+	"strconv"
+	"time"
 
+	"seungpyolee.com/pkg/model"
 	"seungpyolee.com/services/read-service/internal/service"
 )
 
@@ -50,10 +58,14 @@ func (h *GalleryHandler) GetPhoto(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Verify authorization: user can only see their own photos
+	// Verify authorization: other users only see shared photos, with metadata stripped
 	if photo.UserID != userID {
-		http.Error(w, "Unauthorized", http.StatusForbidden)
-		return
+		if !photo.Shared {
+			http.Error(w, "Unauthorized", http.StatusForbidden)
+			return
+		}
+		view := photo.SharedView()
+		photo = &view
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -66,8 +78,84 @@ func (h *GalleryHandler) GetPhoto(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// GetPhotoFile serves the bytes of one stored variant of a photo
+// Query params: variant (defaults to "original"; e.g. "1080", "720", "480")
+// Non-owners asking for the original of a shared photo receive its sanitized copy.
+func (h *GalleryHandler) GetPhotoFile(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("X-User-ID")
+	if userID == "" {
+		http.Error(w, "X-User-ID header is required", http.StatusUnauthorized)
+		return
+	}
+
+	photoID := r.PathValue("photoId")
+	if photoID == "" {
+		http.Error(w, "Photo ID is required", http.StatusBadRequest)
+		return
+	}
+
+	variantName := r.URL.Query().Get("variant")
+	if variantName == "" {
+		variantName = model.VariantOriginal
+	}
+
+	ctx := r.Context()
+	photo, err := h.galleryService.GetPhotoByID(ctx, photoID)
+	if err != nil {
+		log.Printf("[Handler] Error fetching photo: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if photo == nil || photo.PhotoID == "" {
+		http.Error(w, "Photo not found", http.StatusNotFound)
+		return
+	}
+
+	// Verify authorization: other users only get shared photos, and never the original
+	// unless its owner chose to share it unmodified
+	if photo.UserID != userID {
+		if !photo.Shared {
+			http.Error(w, "Unauthorized", http.StatusForbidden)
+			return
+		}
+		variantName = service.SharedVariantName(photo, variantName)
+	}
+
+	variant, body, err := h.galleryService.GetPhotoVariant(ctx, photo, variantName)
+	if errors.Is(err, service.ErrVariantNotFound) {
+		http.Error(w, "Variant not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("[Handler] Error fetching photo file: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	defer body.Close()
+
+	w.Header().Set("Content-Type", variant.ContentType)
+	if variant.Size >= 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(variant.Size, 10))
+	}
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, body); err != nil {
+		// Headers are sent; the client sees a truncated body
+		log.Printf("[Handler] Error streaming photo file %s: %v", photoID, err)
+	}
+
+	// Record API call to analytics (async)
+	if h.analyticsClient != nil {
+		h.analyticsClient.RecordAPICall("/api/gallery/photo/file", userID)
+	}
+}
+
 // GetGallery handles retrieval of all photos for the authenticated user
 // Expected header: "X-User-ID"
+// Query params: sort (uploaded, captured, filename or size; default uploaded), order (asc or desc;
+// default desc, asc for filename), limit (page size), cursor (nextCursor of the previous page)
 func (h *GalleryHandler) GetGallery(w http.ResponseWriter, r *http.Request) {
 	userID := r.Header.Get("X-User-ID")
 	if userID == "" {
@@ -75,8 +163,24 @@ func (h *GalleryHandler) GetGallery(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	query := r.URL.Query()
+	sort, err := parseSortParams(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit, err := parseLimitParam(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	ctx := r.Context()
-	photos, err := h.galleryService.GetPhotosByUser(ctx, userID)
+	page, err := h.galleryService.GetPhotosByUser(ctx, userID, sort, query.Get("cursor"), limit)
+	if errors.Is(err, service.ErrInvalidQuery) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		log.Printf("[Handler] Error fetching gallery: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
@@ -85,14 +189,12 @@ func (h *GalleryHandler) GetGallery(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"photos": photos,
-		"count":  len(photos),
-	})
+	json.NewEncoder(w).Encode(page)
 }
 
 // GetGalleryByDateRange handles filtered retrieval by date range
-// Query params: startDate (RFC3339), endDate (RFC3339)
+// Query params: startDate, endDate (RFC3339 or YYYY-MM-DD, inclusive), field (uploaded or captured; default uploaded),
+// limit (page size), cursor (nextCursor of the previous page)
 func (h *GalleryHandler) GetGalleryByDateRange(w http.ResponseWriter, r *http.Request) {
 	userID := r.Header.Get("X-User-ID")
 	if userID == "" {
@@ -100,25 +202,472 @@ func (h *GalleryHandler) GetGalleryByDateRange(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	startDate := r.URL.Query().Get("startDate")
-	endDate := r.URL.Query().Get("endDate")
+	query := r.URL.Query()
+	startDate := query.Get("startDate")
+	endDate := query.Get("endDate")
 	if startDate == "" || endDate == "" {
 		http.Error(w, "startDate and endDate query params are required", http.StatusBadRequest)
 		return
 	}
 
+	limit, err := parseLimitParam(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	ctx := r.Context()
-	photos, err := h.galleryService.GetPhotosByDateRange(ctx, userID, startDate, endDate)
+	page, err := h.galleryService.GetPhotosByDateRange(ctx, userID, query.Get("field"), startDate, endDate, query.Get("cursor"), limit)
+	if errors.Is(err, service.ErrInvalidQuery) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		log.Printf("[Handler] Error fetching photos by date: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(page)
+}
+
+// GetGalleryInBoundingBox handles retrieval of photos located inside a bounding box
+// Query params: minLat, minLng, maxLat, maxLng (decimal degrees), limit (optional)
+func (h *GalleryHandler) GetGalleryInBoundingBox(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("X-User-ID")
+	if userID == "" {
+		http.Error(w, "X-User-ID header is required", http.StatusUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+	coords, err := parseFloatParams(query, "minLat", "minLng", "maxLat", "maxLng")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit, err := parseLimitParam(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	photos, err := h.galleryService.GetPhotosInBoundingBox(ctx, userID, coords[0], coords[1], coords[2], coords[3], limit)
+	if errors.Is(err, service.ErrInvalidQuery) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("[Handler] Error fetching photos in bounding box: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"photos": photos,
 		"count":  len(photos),
 	})
+
+	// Record API call to analytics (async)
+	if h.analyticsClient != nil {
+		h.analyticsClient.RecordAPICall("/api/gallery/geo/bbox", userID)
+	}
+}
+
+// GetGalleryNear handles retrieval of photos within a radius of a point, nearest first
+// Query params: lat, lng (decimal degrees), radius (meters), limit (optional)
+func (h *GalleryHandler) GetGalleryNear(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("X-User-ID")
+	if userID == "" {
+		http.Error(w, "X-User-ID header is required", http.StatusUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+	params, err := parseFloatParams(query, "lat", "lng", "radius")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit, err := parseLimitParam(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	results, err := h.galleryService.GetPhotosNear(ctx, userID, params[0], params[1], params[2], limit)
+	if errors.Is(err, service.ErrInvalidQuery) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("[Handler] Error fetching photos near point: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"photos": results,
+		"count":  len(results),
+	})
+
+	// Record API call to analytics (async)
+	if h.analyticsClient != nil {
+		h.analyticsClient.RecordAPICall("/api/gallery/geo/near", userID)
+	}
+}
+
+// GetGalleryByPlace handles retrieval of photos taken at a place
+// Query params: country (ISO 3166-1 alpha-2 code), region, city; at least one is required;
+// limit (page size), cursor (nextCursor of the previous page)
+func (h *GalleryHandler) GetGalleryByPlace(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("X-User-ID")
+	if userID == "" {
+		http.Error(w, "X-User-ID header is required", http.StatusUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+	place := model.PhotoPlace{
+		CountryCode: query.Get("country"),
+		Region:      query.Get("region"),
+		City:        query.Get("city"),
+	}
+	limit, err := parseLimitParam(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	page, err := h.galleryService.GetPhotosByPlace(ctx, userID, place, query.Get("cursor"), limit)
+	if errors.Is(err, service.ErrInvalidQuery) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("[Handler] Error fetching photos by place: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(page)
+
+	// Record API call to analytics (async)
+	if h.analyticsClient != nil {
+		h.analyticsClient.RecordAPICall("/api/gallery/place", userID)
+	}
+}
+
+// GetGalleryPlaces handles the gallery grouped by place with a photo count and cover photo per place
+// Query params: country (optional ISO 3166-1 alpha-2 code)
+func (h *GalleryHandler) GetGalleryPlaces(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("X-User-ID")
+	if userID == "" {
+		http.Error(w, "X-User-ID header is required", http.StatusUnauthorized)
+		return
+	}
+
+	ctx := r.Context()
+	places, err := h.galleryService.GetPlaceSummaries(ctx, userID, r.URL.Query().Get("country"))
+	if err != nil {
+		log.Printf("[Handler] Error grouping photos by place: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"places": places,
+		"count":  len(places),
+	})
+
+	// Record API call to analytics (async)
+	if h.analyticsClient != nil {
+		h.analyticsClient.RecordAPICall("/api/gallery/places", userID)
+	}
+}
+
+// GetGalleryByTimeOfDay handles retrieval of photos by local capture time, whatever the date
+// Query params: start, end (HH:MM wall-clock time where the photo was taken; start after end wraps past midnight),
+// limit (page size), cursor (nextCursor of the previous page)
+func (h *GalleryHandler) GetGalleryByTimeOfDay(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("X-User-ID")
+	if userID == "" {
+		http.Error(w, "X-User-ID header is required", http.StatusUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+	start, err := parseTimeOfDayParam(query, "start")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	end, err := parseTimeOfDayParam(query, "end")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit, err := parseLimitParam(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	page, err := h.galleryService.GetPhotosByTimeOfDay(ctx, userID, start, end, query.Get("cursor"), limit)
+	if errors.Is(err, service.ErrInvalidQuery) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("[Handler] Error fetching photos by time of day: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(page)
+
+	// Record API call to analytics (async)
+	if h.analyticsClient != nil {
+		h.analyticsClient.RecordAPICall("/api/gallery/timeofday", userID)
+	}
+}
+
+// GetGalleryTimeline handles photo counts per period of capture date
+// Query params: granularity (day, month or year; default month), tz (IANA zone or UTC offset; default UTC)
+func (h *GalleryHandler) GetGalleryTimeline(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("X-User-ID")
+	if userID == "" {
+		http.Error(w, "X-User-ID header is required", http.StatusUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+	ctx := r.Context()
+	timeline, err := h.galleryService.GetTimeline(ctx, userID, query.Get("granularity"), query.Get("tz"))
+	if errors.Is(err, service.ErrInvalidQuery) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("[Handler] Error building timeline: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(timeline)
+
+	// Record API call to analytics (async)
+	if h.analyticsClient != nil {
+		h.analyticsClient.RecordAPICall("/api/gallery/timeline", userID)
+	}
+}
+
+// GetGalleryMemories handles "on this day" photos from earlier years, grouped by year
+// Query params: date (YYYY-MM-DD, default today), tz (IANA zone or UTC offset; default UTC), window (days either side, default 0)
+func (h *GalleryHandler) GetGalleryMemories(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("X-User-ID")
+	if userID == "" {
+		http.Error(w, "X-User-ID header is required", http.StatusUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+	window := 0
+	if raw := query.Get("window"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil {
+			http.Error(w, "window must be an integer number of days", http.StatusBadRequest)
+			return
+		}
+		window = v
+	}
+
+	ctx := r.Context()
+	memories, err := h.galleryService.GetMemories(ctx, userID, query.Get("date"), query.Get("tz"), window)
+	if errors.Is(err, service.ErrInvalidQuery) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("[Handler] Error fetching memories: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(memories)
+
+	// Record API call to analytics (async)
+	if h.analyticsClient != nil {
+		h.analyticsClient.RecordAPICall("/api/gallery/memories", userID)
+	}
+}
+
+// GetSimilarPhotos handles visually similar photos from the owner's library, best match first
+// Query params: limit (default 20)
+func (h *GalleryHandler) GetSimilarPhotos(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("X-User-ID")
+	if userID == "" {
+		http.Error(w, "X-User-ID header is required", http.StatusUnauthorized)
+		return
+	}
+
+	photoID := r.PathValue("photoId")
+	if photoID == "" {
+		http.Error(w, "Photo ID is required", http.StatusBadRequest)
+		return
+	}
+	limit, err := parseLimitParam(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	similar, err := h.galleryService.GetSimilarPhotos(ctx, userID, photoID, limit)
+	if errors.Is(err, service.ErrInvalidQuery) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, service.ErrPhotoNotFound) {
+		http.Error(w, "Photo not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("[Handler] Error finding similar photos: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(similar)
+
+	// Record API call to analytics (async)
+	if h.analyticsClient != nil {
+		h.analyticsClient.RecordAPICall("/api/gallery/photo/similar", userID)
+	}
+}
+
+// GetGalleryDuplicates handles groups of near-duplicate photos for the user to review
+// Query params: distance (max differing perceptual hash bits, default 8)
+func (h *GalleryHandler) GetGalleryDuplicates(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("X-User-ID")
+	if userID == "" {
+		http.Error(w, "X-User-ID header is required", http.StatusUnauthorized)
+		return
+	}
+
+	distance := 0
+	if raw := r.URL.Query().Get("distance"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v <= 0 {
+			http.Error(w, "distance must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		distance = v
+	}
+
+	ctx := r.Context()
+	groups, err := h.galleryService.GetNearDuplicates(ctx, userID, distance)
+	if errors.Is(err, service.ErrInvalidQuery) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("[Handler] Error finding near-duplicates: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(groups)
+
+	// Record API call to analytics (async)
+	if h.analyticsClient != nil {
+		h.analyticsClient.RecordAPICall("/api/gallery/duplicates", userID)
+	}
+}
+
+// parseTimeOfDayParam reads a required HH:MM query param as minutes after midnight
+func parseTimeOfDayParam(query url.Values, name string) (int, error) {
+	raw := query.Get(name)
+	if raw == "" {
+		return 0, fmt.Errorf("%s query param is required", name)
+	}
+	t, err := time.Parse("15:04", raw)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a time in HH:MM format", name)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// parseSortParams reads the optional sort and order query params
+func parseSortParams(query url.Values) (model.PhotoSort, error) {
+	sort := model.DefaultPhotoSort
+	if field := query.Get("sort"); field != "" {
+		sort.Field = field
+		// Names read best A to Z; dates and sizes largest first
+		sort.Descending = field != model.PhotoSortFileName
+	}
+	switch query.Get("order") {
+	case "":
+	case "asc":
+		sort.Descending = false
+	case "desc":
+		sort.Descending = true
+	default:
+		return sort, fmt.Errorf("order must be asc or desc")
+	}
+	return sort, nil
+}
+
+// parseFloatParams reads required float query params in the given order
+func parseFloatParams(query url.Values, names ...string) ([]float64, error) {
+	values := make([]float64, len(names))
+	for i, name := range names {
+		raw := query.Get(name)
+		if raw == "" {
+			return nil, fmt.Errorf("%s query param is required", name)
+		}
+		v, err := strconv.ParseFloat(raw, 64)
+		if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil, fmt.Errorf("%s must be a number", name)
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+// parseLimitParam reads the optional limit query param; 0 means the service default
+func parseLimitParam(query url.Values) (int, error) {
+	raw := query.Get("limit")
+	if raw == "" {
+		return 0, nil
+	}
+	limit, err := strconv.Atoi(raw)
+	if err != nil || limit <= 0 {
+		return 0, fmt.Errorf("limit must be a positive integer")
+	}
+	return limit, nil
 }
@@ -4,8 +4,6 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"log"
-	"time"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
 )
@@ -29,46 +27,19 @@ func NewAzureBlobRepository(connectionString, containerName string) (*AzureBlobR
 	}, nil
 }
 
-// GetBlob downloads the blob with the given name and returns its bytes
-func (r *AzureBlobRepositoryImpl) GetBlob(ctx context.Context, blobName string) ([]byte, error) {
-	// create a context with timeout to avoid hanging
-	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
-	defer cancel()
-
+// OpenBlob returns a streaming reader over the blob content and its size in bytes, -1 if
+// unknown; the caller must close the reader
+func (r *AzureBlobRepositoryImpl) OpenBlob(ctx context.Context, blobName string) (io.ReadCloser, int64, error) {
 	containerClient := r.client.ServiceClient().NewContainerClient(r.containerName)
 	blockBlobClient := containerClient.NewBlockBlobClient(blobName)
 
 	resp, err := blockBlobClient.DownloadStream(ctx, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to download blob %s: %w", blobName, err)
-	}
-
-	// resp.Body may be an io.ReadCloser or provide a Body method; try to read directly
-	var reader io.ReadCloser
-
-	// Several SDK versions expose Body directly.
-	if resp.Body != nil {
-		reader = resp.Body
-	}
-
-	if reader == nil {
-		// Fallback: try to call NewRetryReader if available (older SDKs)
-		if rr := resp.NewRetryReader; rr != nil {
-			reader = rr(ctx, nil)
-		}
+		return nil, 0, fmt.Errorf("failed to download blob %s: %w", blobName, err)
 	}
-
-	if reader == nil {
-		return nil, fmt.Errorf("no readable body available for blob %s", blobName)
-	}
-
-	defer reader.Close()
-
-	data, err := io.ReadAll(reader)
-	if err != nil {
-		log.Printf("[Azure] error reading blob body: %v", err)
-		return nil, fmt.Errorf("failed to read blob data: %w", err)
+	size := int64(-1)
+	if resp.ContentLength != nil {
+		size = *resp.ContentLength
 	}
-
-	return data, nil
+	return resp.Body, size, nil
 }
@@ -4,6 +4,7 @@ package repository
 import (
 	"context"
 	"log"
+	"math"
 	"time"
 
 	"go.mongodb.org/mongo-driver/v2/bson"
@@ -12,6 +13,42 @@ import (
 	"seungpyolee.com/pkg/model"
 )
 
+// photoSortKeys maps model.PhotoSort fields to document fields
+var photoSortKeys = map[string]string{
+	model.PhotoSortUploaded: "uploaded_at",
+	model.PhotoSortCaptured: "metadata.date_time_original",
+	model.PhotoSortFileName: "file_name",
+	model.PhotoSortFileSize: "file_size",
+}
+
+// dateFieldKeys maps model.DateField* to document fields
+var dateFieldKeys = map[string]string{
+	model.DateFieldUploaded: "uploaded_at",
+	model.DateFieldCaptured: "metadata.date_time_original",
+}
+
+// sortDocument orders by the sort field, then by _id so photos with equal values keep a stable order
+func sortDocument(sort model.PhotoSort) bson.D {
+	direction := 1
+	if sort.Descending {
+		direction = -1
+	}
+	return bson.D{{Key: photoSortKeys[sort.Field], Value: direction}, {Key: "_id", Value: direction}}
+}
+
+// afterCursor matches the documents that follow the cursor in its sort order
+func afterCursor(cursor *model.PhotoCursor) bson.A {
+	key := photoSortKeys[cursor.Sort.Field]
+	op := "$gt"
+	if cursor.Sort.Descending {
+		op = "$lt"
+	}
+	return bson.A{
+		bson.M{key: bson.M{op: cursor.Value}},
+		bson.M{key: cursor.Value, "_id": bson.M{op: cursor.PhotoID}},
+	}
+}
+
 type CosmosDBRepoImpl struct {
 	client    *mongo.Client
 	photoColl *mongo.Collection
@@ -60,10 +97,14 @@ func (r *CosmosDBRepoImpl) GetPhotoByID(ctx context.Context, photoID string) (mo
 	return photo, nil
 }
 
-// GetPhotosByUserID retrieves all photos for a specific user (sorted by upload date descending)
-func (r *CosmosDBRepoImpl) GetPhotosByUserID(ctx context.Context, userID string) ([]model.Photo, error) {
+// GetPhotosByUserID retrieves up to limit photos of a user in the given order, starting
+// after the cursor when one is given
+func (r *CosmosDBRepoImpl) GetPhotosByUserID(ctx context.Context, userID string, sort model.PhotoSort, after *model.PhotoCursor, limit int64) ([]model.Photo, error) {
 	filter := bson.M{"user_id": userID}
-	opts := options.Find().SetSort(bson.M{"uploaded_at": -1})
+	if after != nil {
+		filter["$or"] = afterCursor(after)
+	}
+	opts := options.Find().SetSort(sortDocument(sort)).SetLimit(limit)
 
 	cursor, err := r.photoColl.Find(ctx, filter, opts)
 	if err != nil {
@@ -81,19 +122,21 @@ func (r *CosmosDBRepoImpl) GetPhotosByUserID(ctx context.Context, userID string)
 	return photos, nil
 }
 
-// GetPhotosByDateRange retrieves photos for a user within a date range
-func (r *CosmosDBRepoImpl) GetPhotosByDateRange(ctx context.Context, userID string, startDate, endDate string) ([]model.Photo, error) {
-	startTime, _ := time.Parse(time.RFC3339, startDate)
-	endTime, _ := time.Parse(time.RFC3339, endDate)
-
+// GetPhotosByDateRange retrieves up to limit photos of a user whose upload or capture date,
+// per field, lies between start and end inclusive, most recent first, starting after the
+// cursor when one is given
+func (r *CosmosDBRepoImpl) GetPhotosByDateRange(ctx context.Context, userID, field string, start, end time.Time, after *model.PhotoCursor, limit int64) ([]model.Photo, error) {
 	filter := bson.M{
 		"user_id": userID,
-		"uploaded_at": bson.M{
-			"$gte": startTime,
-			"$lte": endTime,
+		dateFieldKeys[field]: bson.M{
+			"$gte": start,
+			"$lte": end,
 		},
 	}
-	opts := options.Find().SetSort(bson.M{"uploaded_at": -1})
+	if after != nil {
+		filter["$or"] = afterCursor(after)
+	}
+	opts := options.Find().SetSort(sortDocument(model.PhotoSort{Field: field, Descending: true})).SetLimit(limit)
 
 	cursor, err := r.photoColl.Find(ctx, filter, opts)
 	if err != nil {
@@ -109,3 +152,388 @@ func (r *CosmosDBRepoImpl) GetPhotosByDateRange(ctx context.Context, userID stri
 
 	return photos, nil
 }
+
+// GetPhotosInBoundingBox retrieves a user's photos located inside a latitude/longitude box.
+// A box with minLng > maxLng crosses the antimeridian.
+func (r *CosmosDBRepoImpl) GetPhotosInBoundingBox(ctx context.Context, userID string, minLat, minLng, maxLat, maxLng float64, limit int64) ([]model.Photo, error) {
+	var within bson.A
+	for _, polygon := range boundingBoxPolygons(minLat, minLng, maxLat, maxLng) {
+		within = append(within, bson.M{
+			"location": bson.M{"$geoWithin": bson.M{"$geometry": polygon}},
+		})
+	}
+
+	filter := bson.M{
+		"user_id": userID,
+		"$or":     within,
+	}
+	opts := options.Find().SetSort(bson.M{"uploaded_at": -1}).SetLimit(limit)
+
+	cursor, err := r.photoColl.Find(ctx, filter, opts)
+	if err != nil {
+		log.Printf("[Cosmos] Error querying photos in bounding box: %v", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var photos []model.Photo
+	if err := cursor.All(ctx, &photos); err != nil {
+		return nil, err
+	}
+
+	return photos, nil
+}
+
+// GetPhotosNear retrieves a user's photos within radiusMeters of a point, nearest first
+func (r *CosmosDBRepoImpl) GetPhotosNear(ctx context.Context, userID string, lat, lng, radiusMeters float64, limit int64) ([]model.PhotoNearResult, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$geoNear", Value: bson.M{
+			"near":          model.NewGeoPoint(lat, lng),
+			"key":           "location",
+			"distanceField": "distance",
+			"maxDistance":   radiusMeters,
+			"spherical":     true,
+			"query":         bson.M{"user_id": userID},
+		}}},
+		{{Key: "$limit", Value: limit}},
+	}
+
+	cursor, err := r.photoColl.Aggregate(ctx, pipeline)
+	if err != nil {
+		log.Printf("[Cosmos] Error querying photos near point: %v", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var results []model.PhotoNearResult
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// GetPhotosByPlace retrieves up to limit photos of a user matching the non-empty fields of
+// place, most recent upload first, starting after the cursor when one is given
+func (r *CosmosDBRepoImpl) GetPhotosByPlace(ctx context.Context, userID string, place model.PhotoPlace, after *model.PhotoCursor, limit int64) ([]model.Photo, error) {
+	filter := bson.M{"user_id": userID}
+	if place.CountryCode != "" {
+		filter["place.country_code"] = place.CountryCode
+	}
+	if place.Region != "" {
+		filter["place.region"] = place.Region
+	}
+	if place.City != "" {
+		filter["place.city"] = place.City
+	}
+	if after != nil {
+		filter["$or"] = afterCursor(after)
+	}
+	opts := options.Find().SetSort(sortDocument(model.DefaultPhotoSort)).SetLimit(limit)
+
+	cursor, err := r.photoColl.Find(ctx, filter, opts)
+	if err != nil {
+		log.Printf("[Cosmos] Error querying photos by place: %v", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var photos []model.Photo
+	if err := cursor.All(ctx, &photos); err != nil {
+		return nil, err
+	}
+
+	return photos, nil
+}
+
+// GetPlaceSummaries groups a user's photos by city, most photographed first.
+// A non-empty countryCode restricts the result to that country.
+func (r *CosmosDBRepoImpl) GetPlaceSummaries(ctx context.Context, userID, countryCode string) ([]model.PlaceSummary, error) {
+	match := bson.M{"user_id": userID, "place": bson.M{"$exists": true}}
+	if countryCode != "" {
+		match["place.country_code"] = countryCode
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$sort", Value: bson.M{"uploaded_at": -1}}},
+		{{Key: "$group", Value: bson.M{
+			"_id": bson.M{
+				"country_code": "$place.country_code",
+				"region":       "$place.region",
+				"city":         "$place.city",
+			},
+			"country":        bson.M{"$first": "$place.country"},
+			"count":          bson.M{"$sum": 1},
+			"cover_photo_id": bson.M{"$first": "$_id"},
+			"latest_upload":  bson.M{"$first": "$uploaded_at"},
+		}}},
+		{{Key: "$project", Value: bson.M{
+			"_id":            0,
+			"country_code":   "$_id.country_code",
+			"region":         "$_id.region",
+			"city":           "$_id.city",
+			"country":        1,
+			"count":          1,
+			"cover_photo_id": 1,
+			"latest_upload":  1,
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "count", Value: -1}, {Key: "latest_upload", Value: -1}}}},
+	}
+
+	cursor, err := r.photoColl.Aggregate(ctx, pipeline)
+	if err != nil {
+		log.Printf("[Cosmos] Error grouping photos by place: %v", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var summaries []model.PlaceSummary
+	if err := cursor.All(ctx, &summaries); err != nil {
+		return nil, err
+	}
+
+	return summaries, nil
+}
+
+// GetPhotosByTimeOfDay retrieves up to limit photos of a user whose local capture time falls
+// between startMinute and endMinute (minutes after midnight, inclusive), most recently
+// captured first, starting after the cursor when one is given. A start after the end
+// selects a range that wraps past midnight, e.g. 22:00 to 02:00.
+func (r *CosmosDBRepoImpl) GetPhotosByTimeOfDay(ctx context.Context, userID string, startMinute, endMinute int, after *model.PhotoCursor, limit int64) ([]model.Photo, error) {
+	filter := bson.M{"user_id": userID}
+	var and bson.A
+	if startMinute <= endMinute {
+		filter["metadata.local_minute_of_day"] = bson.M{"$gte": startMinute, "$lte": endMinute}
+	} else {
+		and = append(and, bson.M{"$or": bson.A{
+			bson.M{"metadata.local_minute_of_day": bson.M{"$gte": startMinute}},
+			bson.M{"metadata.local_minute_of_day": bson.M{"$lte": endMinute}},
+		}})
+	}
+	if after != nil {
+		and = append(and, bson.M{"$or": afterCursor(after)})
+	}
+	if len(and) > 0 {
+		filter["$and"] = and
+	}
+	sort := model.PhotoSort{Field: model.PhotoSortCaptured, Descending: true}
+	opts := options.Find().SetSort(sortDocument(sort)).SetLimit(limit)
+
+	cursor, err := r.photoColl.Find(ctx, filter, opts)
+	if err != nil {
+		log.Printf("[Cosmos] Error querying photos by time of day: %v", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var photos []model.Photo
+	if err := cursor.All(ctx, &photos); err != nil {
+		return nil, err
+	}
+
+	return photos, nil
+}
+
+// GetPhotosCapturedInRanges retrieves up to limit photos of a user captured within any of the
+// ranges, most recently captured first
+func (r *CosmosDBRepoImpl) GetPhotosCapturedInRanges(ctx context.Context, userID string, ranges []model.TimeRange, limit int64) ([]model.Photo, error) {
+	within := make(bson.A, 0, len(ranges))
+	for _, tr := range ranges {
+		within = append(within, bson.M{
+			"metadata.date_time_original": bson.M{"$gte": tr.Start, "$lt": tr.End},
+		})
+	}
+
+	filter := bson.M{
+		"user_id": userID,
+		"$or":     within,
+	}
+	opts := options.Find().SetSort(sortDocument(model.PhotoSort{Field: model.PhotoSortCaptured, Descending: true})).SetLimit(limit)
+
+	cursor, err := r.photoColl.Find(ctx, filter, opts)
+	if err != nil {
+		log.Printf("[Cosmos] Error querying photos in capture ranges: %v", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var photos []model.Photo
+	if err := cursor.All(ctx, &photos); err != nil {
+		return nil, err
+	}
+
+	return photos, nil
+}
+
+// GetPerceptualHashes retrieves the perceptual hash of each of a user's photos that has one
+func (r *CosmosDBRepoImpl) GetPerceptualHashes(ctx context.Context, userID string) ([]model.PhotoHash, error) {
+	filter := bson.M{"user_id": userID, "perceptual_hash": bson.M{"$gt": ""}}
+	opts := options.Find().SetProjection(bson.M{"_id": 1, "perceptual_hash": 1})
+
+	cursor, err := r.photoColl.Find(ctx, filter, opts)
+	if err != nil {
+		log.Printf("[Cosmos] Error querying perceptual hashes: %v", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var hashes []model.PhotoHash
+	if err := cursor.All(ctx, &hashes); err != nil {
+		return nil, err
+	}
+
+	return hashes, nil
+}
+
+// GetPhotosByIDs retrieves those of the given photos that belong to a user, in no particular order
+func (r *CosmosDBRepoImpl) GetPhotosByIDs(ctx context.Context, userID string, photoIDs []string) ([]model.Photo, error) {
+	filter := bson.M{"user_id": userID, "_id": bson.M{"$in": photoIDs}}
+
+	cursor, err := r.photoColl.Find(ctx, filter)
+	if err != nil {
+		log.Printf("[Cosmos] Error querying photos by ID: %v", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var photos []model.Photo
+	if err := cursor.All(ctx, &photos); err != nil {
+		return nil, err
+	}
+
+	return photos, nil
+}
+
+// GetPhotoHash retrieves the owner and image features of a photo; a missing photo yields an empty PhotoHash
+func (r *CosmosDBRepoImpl) GetPhotoHash(ctx context.Context, photoID string) (model.PhotoHash, error) {
+	var hash model.PhotoHash
+	opts := options.FindOne().SetProjection(bson.M{"_id": 1, "user_id": 1, "perceptual_hash": 1, "color_histogram": 1})
+
+	err := r.photoColl.FindOne(ctx, bson.M{"_id": photoID}, opts).Decode(&hash)
+	if err == mongo.ErrNoDocuments {
+		return model.PhotoHash{}, nil
+	}
+	if err != nil {
+		log.Printf("[Cosmos] Error fetching image features of photo %s: %v", photoID, err)
+		return model.PhotoHash{}, err
+	}
+	return hash, nil
+}
+
+// GetSimilarCandidates retrieves the image features of up to limit photos of a user that
+// share at least one perceptual hash band, see model.PerceptualHashBands. Photos sharing
+// more bands are closer on average and come first, so the limit cuts the least likely matches.
+func (r *CosmosDBRepoImpl) GetSimilarCandidates(ctx context.Context, userID string, bands []string, limit int64) ([]model.PhotoHash, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"user_id": userID, "perceptual_bands": bson.M{"$in": bands}}}},
+		{{Key: "$project", Value: bson.M{
+			"user_id":         1,
+			"perceptual_hash": 1,
+			"color_histogram": 1,
+			"band_hits":       bson.M{"$size": bson.M{"$setIntersection": bson.A{"$perceptual_bands", bands}}},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "band_hits", Value: -1}, {Key: "_id", Value: 1}}}},
+		{{Key: "$limit", Value: limit}},
+	}
+
+	cursor, err := r.photoColl.Aggregate(ctx, pipeline)
+	if err != nil {
+		log.Printf("[Cosmos] Error querying similar photo candidates: %v", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var candidates []model.PhotoHash
+	if err := cursor.All(ctx, &candidates); err != nil {
+		return nil, err
+	}
+
+	return candidates, nil
+}
+
+// timelineFormats are the $dateToString formats of the timeline granularities
+var timelineFormats = map[string]string{
+	model.TimelineDay:   "%Y-%m-%d",
+	model.TimelineMonth: "%Y-%m",
+	model.TimelineYear:  "%Y",
+}
+
+// GetTimeline counts a user's photos per period of capture date in the given time zone
+// (IANA name or UTC offset), most recent first. Photos without a capture date are counted
+// in a bucket with an empty period.
+func (r *CosmosDBRepoImpl) GetTimeline(ctx context.Context, userID, granularity, timeZone string) ([]model.TimelineBucket, error) {
+	// A missing capture date is stored as the zero time
+	hasDate := bson.M{"$gt": bson.A{"$metadata.date_time_original", time.Time{}}}
+	period := bson.M{"$dateToString": bson.M{
+		"format":   timelineFormats[granularity],
+		"date":     "$metadata.date_time_original",
+		"timezone": timeZone,
+	}}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"user_id": userID}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":   bson.M{"$cond": bson.A{hasDate, period, nil}},
+			"count": bson.M{"$sum": 1},
+		}}},
+		{{Key: "$project", Value: bson.M{"_id": 0, "period": "$_id", "count": 1}}},
+		{{Key: "$sort", Value: bson.M{"period": -1}}},
+	}
+
+	cursor, err := r.photoColl.Aggregate(ctx, pipeline)
+	if err != nil {
+		log.Printf("[Cosmos] Error aggregating timeline: %v", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var buckets []model.TimelineBucket
+	if err := cursor.All(ctx, &buckets); err != nil {
+		return nil, err
+	}
+
+	return buckets, nil
+}
+
+// boundingBoxPolygons converts a latitude/longitude box into GeoJSON polygons usable with $geoWithin.
+// GeoJSON edges are geodesics, so the box is split at the antimeridian and into pieces no wider
+// than 90 degrees (keeping each polygon smaller than a hemisphere), and the east-west edges are
+// densified so they follow the parallels closely.
+func boundingBoxPolygons(minLat, minLng, maxLat, maxLng float64) []bson.M {
+	type span struct{ west, east float64 }
+	spans := []span{{minLng, maxLng}}
+	if minLng > maxLng {
+		spans = []span{{minLng, 180}, {-180, maxLng}}
+	}
+
+	const maxPieceWidth = 90.0
+	const edgeStep = 1.0
+
+	var polygons []bson.M
+	for _, sp := range spans {
+		for west := sp.west; west < sp.east; west += maxPieceWidth {
+			east := math.Min(west+maxPieceWidth, sp.east)
+
+			var ring [][]float64
+			// South edge, west to east
+			for x := west; x < east; x += edgeStep {
+				ring = append(ring, []float64{x, minLat})
+			}
+			ring = append(ring, []float64{east, minLat})
+			// North edge, east to west
+			for x := east; x > west; x -= edgeStep {
+				ring = append(ring, []float64{x, maxLat})
+			}
+			ring = append(ring, []float64{west, maxLat})
+			// Close the ring
+			ring = append(ring, []float64{west, minLat})
+
+			polygons = append(polygons, bson.M{
+				"type":        "Polygon",
+				"coordinates": [][][]float64{ring},
+			})
+		}
+	}
+	return polygons
+}
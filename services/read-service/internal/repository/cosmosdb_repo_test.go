@@ -0,0 +1,157 @@
+package repository
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"seungpyolee.com/pkg/model"
+)
+
+// compareValues orders two values of a sort field the way the database does
+func compareValues(a, b interface{}) int {
+	switch a := a.(type) {
+	case time.Time:
+		return a.Compare(b.(time.Time))
+	case string:
+		return strings.Compare(a, b.(string))
+	case int64:
+		switch b := b.(int64); {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+		return 0
+	}
+	panic(fmt.Sprintf("unexpected sort value %T", a))
+}
+
+// matchesCondition evaluates a {key: value} or {key: {op: value}} condition on doc
+func matchesCondition(doc bson.M, key string, condition interface{}) bool {
+	ops, ok := condition.(bson.M)
+	if !ok {
+		return compareValues(doc[key], condition) == 0
+	}
+	for op, value := range ops {
+		c := compareValues(doc[key], value)
+		if (op == "$gt" && c <= 0) || (op == "$lt" && c >= 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesAny evaluates the $or array returned by afterCursor on doc
+func matchesAny(doc bson.M, or bson.A) bool {
+	for _, clause := range or {
+		all := true
+		for key, condition := range clause.(bson.M) {
+			all = all && matchesCondition(doc, key, condition)
+		}
+		if all {
+			return true
+		}
+	}
+	return false
+}
+
+// photoDocument is the stored form of photo, limited to the sort fields
+func photoDocument(photo model.Photo) bson.M {
+	return bson.M{
+		"_id":                         photo.PhotoID,
+		"uploaded_at":                 photo.UploadedAt,
+		"metadata.date_time_original": photo.Metadata.DateTimeOriginal,
+		"file_name":                   photo.FileName,
+		"file_size":                   photo.FileSize,
+	}
+}
+
+func TestSortDocument(t *testing.T) {
+	for field, key := range photoSortKeys {
+		for _, descending := range []bool{false, true} {
+			direction := 1
+			if descending {
+				direction = -1
+			}
+			want := bson.D{{Key: key, Value: direction}, {Key: "_id", Value: direction}}
+			got := sortDocument(model.PhotoSort{Field: field, Descending: descending})
+			if fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Fatalf("sortDocument(%s, %v) = %v, want %v", field, descending, got, want)
+			}
+		}
+	}
+}
+
+// TestAfterCursorPages walks every sort order a page at a time, following the cursors the
+// service issues, and checks each photo is listed exactly once and in order. Every sort
+// field has ties so the _id tie-breaker is exercised across page boundaries.
+func TestAfterCursorPages(t *testing.T) {
+	base := time.Date(2024, 1, 2, 15, 0, 0, 0, time.UTC)
+	var photos []model.Photo
+	for i := 0; i < 9; i++ {
+		photos = append(photos, model.Photo{
+			PhotoID:    fmt.Sprintf("photo-%d", (i*5)%9),
+			UploadedAt: base.Add(time.Duration(i/3) * time.Hour),
+			Metadata:   model.PhotoMetadata{DateTimeOriginal: base.Add(-time.Duration(i%4) * 24 * time.Hour)},
+			FileName:   fmt.Sprintf("IMG_%d.jpg", i%2),
+			FileSize:   int64(i%3) << 20,
+		})
+	}
+
+	const pageSize = 2
+	for field, key := range photoSortKeys {
+		for _, descending := range []bool{false, true} {
+			order := model.PhotoSort{Field: field, Descending: descending}
+			t.Run(fmt.Sprintf("%s descending=%v", field, descending), func(t *testing.T) {
+				want := append([]model.Photo(nil), photos...)
+				sort.Slice(want, func(i, j int) bool {
+					c := compareValues(photoDocument(want[i])[key], photoDocument(want[j])[key])
+					if c == 0 {
+						c = strings.Compare(want[i].PhotoID, want[j].PhotoID)
+					}
+					return (c < 0) != descending
+				})
+
+				var listed []string
+				token := ""
+				for page := 0; page <= len(photos); page++ {
+					var after *model.PhotoCursor
+					if token != "" {
+						var err error
+						if after, err = model.ParsePhotoCursor(token, order); err != nil {
+							t.Fatalf("ParsePhotoCursor() error = %v", err)
+						}
+					}
+					var batch []model.Photo
+					for _, photo := range want {
+						if after == nil || matchesAny(photoDocument(photo), afterCursor(after)) {
+							batch = append(batch, photo)
+						}
+					}
+					if len(batch) > pageSize {
+						batch = batch[:pageSize]
+					}
+					for _, photo := range batch {
+						listed = append(listed, photo.PhotoID)
+					}
+					if len(batch) < pageSize {
+						break
+					}
+					token = model.NewPhotoCursor(order, batch[len(batch)-1])
+				}
+
+				var wantIDs []string
+				for _, photo := range want {
+					wantIDs = append(wantIDs, photo.PhotoID)
+				}
+				if strings.Join(listed, ",") != strings.Join(wantIDs, ",") {
+					t.Fatalf("paged listing = %v, want %v", listed, wantIDs)
+				}
+			})
+		}
+	}
+}
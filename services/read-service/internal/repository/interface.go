@@ -3,6 +3,8 @@ package repository
 
 import (
 	"context"
+	"io"
+	"time"
 
 	"seungpyolee.com/pkg/model"
 )
@@ -10,8 +12,24 @@ import (
 type CosmosDBRepository interface {
 	// Photo queries
 	GetPhotoByID(ctx context.Context, photoID string) (model.Photo, error)
-	GetPhotosByUserID(ctx context.Context, userID string) ([]model.Photo, error)
-	GetPhotosByDateRange(ctx context.Context, userID string, startDate, endDate string) ([]model.Photo, error)
+	GetPhotosByUserID(ctx context.Context, userID string, sort model.PhotoSort, after *model.PhotoCursor, limit int64) ([]model.Photo, error)
+	GetPhotosByDateRange(ctx context.Context, userID, field string, start, end time.Time, after *model.PhotoCursor, limit int64) ([]model.Photo, error)
+	// Geospatial queries (photos with a GPS location only)
+	GetPhotosInBoundingBox(ctx context.Context, userID string, minLat, minLng, maxLat, maxLng float64, limit int64) ([]model.Photo, error)
+	GetPhotosNear(ctx context.Context, userID string, lat, lng, radiusMeters float64, limit int64) ([]model.PhotoNearResult, error)
+	// Place queries (photos with a resolved place only)
+	GetPhotosByPlace(ctx context.Context, userID string, place model.PhotoPlace, after *model.PhotoCursor, limit int64) ([]model.Photo, error)
+	GetPlaceSummaries(ctx context.Context, userID, countryCode string) ([]model.PlaceSummary, error)
+	GetPhotosByTimeOfDay(ctx context.Context, userID string, startMinute, endMinute int, after *model.PhotoCursor, limit int64) ([]model.Photo, error)
+	GetPhotosCapturedInRanges(ctx context.Context, userID string, ranges []model.TimeRange, limit int64) ([]model.Photo, error)
+	// Near-duplicate detection (photos with a perceptual hash only)
+	GetPerceptualHashes(ctx context.Context, userID string) ([]model.PhotoHash, error)
+	GetPhotosByIDs(ctx context.Context, userID string, photoIDs []string) ([]model.Photo, error)
+	// Similarity search
+	GetPhotoHash(ctx context.Context, photoID string) (model.PhotoHash, error)
+	GetSimilarCandidates(ctx context.Context, userID string, bands []string, limit int64) ([]model.PhotoHash, error)
+	// Aggregations
+	GetTimeline(ctx context.Context, userID, granularity, timeZone string) ([]model.TimelineBucket, error)
 }
 
 type RedisRepository interface {
@@ -19,11 +37,20 @@ type RedisRepository interface {
 	GetPhotoMetadata(ctx context.Context, photoID string) (*model.Photo, error)
 	SetPhotoMetadata(ctx context.Context, photoID string, photo *model.Photo) error
 	InvalidatePhotoCache(ctx context.Context, photoID string) error
-	// Gallery list caching
-	GetGalleryCache(ctx context.Context, userID string) ([]model.Photo, error)
-	SetGalleryCache(ctx context.Context, userID string, photos []model.Photo) error
+	// Gallery page caching; all pages of a user are invalidated together
+	GetGalleryPage(ctx context.Context, userID, pageKey string) (*model.PhotoPage, error)
+	SetGalleryPage(ctx context.Context, userID, pageKey string, page *model.PhotoPage) error
 	InvalidateGalleryCache(ctx context.Context, userID string) error
+	// Timeline caching, one entry per granularity and time zone
+	GetTimelineCache(ctx context.Context, userID, key string) (*model.Timeline, error)
+	SetTimelineCache(ctx context.Context, userID, key string, timeline *model.Timeline) error
+	// "On this day" caching, one entry per date, time zone and window
+	GetMemoriesCache(ctx context.Context, userID, key string) (*model.Memories, error)
+	SetMemoriesCache(ctx context.Context, userID, key string, memories *model.Memories) error
+	// Similar-photo caching, one entry per photo and limit
+	GetSimilarCache(ctx context.Context, userID, key string) (*model.SimilarPhotos, error)
+	SetSimilarCache(ctx context.Context, userID, key string, similar *model.SimilarPhotos) error
 }
 type AzureBlobRepository interface {
-	GetBlob(ctx context.Context, blobName string) ([]byte, error)
+	OpenBlob(ctx context.Context, blobName string) (body io.ReadCloser, size int64, err error)
 }
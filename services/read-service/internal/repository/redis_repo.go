@@ -69,42 +69,46 @@ func (r *RedisRepoImpl) InvalidatePhotoCache(ctx context.Context, photoID string
 	return err
 }
 
-// GetGalleryCache retrieves cached gallery list for a user
-func (r *RedisRepoImpl) GetGalleryCache(ctx context.Context, userID string) ([]model.Photo, error) {
+// GetGalleryPage retrieves a cached gallery page. The pages of a user live in one hash,
+// keyed by sort order, page size and cursor, so a single delete invalidates all of them.
+func (r *RedisRepoImpl) GetGalleryPage(ctx context.Context, userID, pageKey string) (*model.PhotoPage, error) {
 	key := "gallery:" + userID
-	val, err := r.client.Get(ctx, key).Result()
+	val, err := r.client.HGet(ctx, key, pageKey).Result()
 	if err == redis.Nil {
 		return nil, nil // Cache miss
 	}
 	if err != nil {
-		log.Printf("[Redis] Failed to get gallery cache for user %s: %v", userID, err)
+		log.Printf("[Redis] Failed to get gallery page for user %s: %v", userID, err)
 		return nil, nil // Non-fatal
 	}
 
-	var photos []model.Photo
-	if err := json.Unmarshal([]byte(val), &photos); err != nil {
-		log.Printf("[Redis] Failed to unmarshal gallery: %v", err)
+	var page model.PhotoPage
+	if err := json.Unmarshal([]byte(val), &page); err != nil {
+		log.Printf("[Redis] Failed to unmarshal gallery page: %v", err)
 		return nil, nil
 	}
-	return photos, nil
+	return &page, nil
 }
 
-// SetGalleryCache stores gallery list in cache with short TTL
-func (r *RedisRepoImpl) SetGalleryCache(ctx context.Context, userID string, photos []model.Photo) error {
-	data, err := json.Marshal(photos)
+// SetGalleryPage stores a gallery page in cache; the user's page hash expires after a short TTL
+func (r *RedisRepoImpl) SetGalleryPage(ctx context.Context, userID, pageKey string, page *model.PhotoPage) error {
+	data, err := json.Marshal(page)
 	if err != nil {
-		log.Printf("[Redis] Failed to marshal gallery: %v", err)
+		log.Printf("[Redis] Failed to marshal gallery page: %v", err)
 		return err
 	}
 	key := "gallery:" + userID
-	err = r.client.Set(ctx, key, data, shared.ShortCacheTTL).Err()
-	if err != nil {
-		log.Printf("[Redis] Failed to cache gallery for user %s: %v", userID, err)
+	pipe := r.client.TxPipeline()
+	pipe.HSet(ctx, key, pageKey, data)
+	pipe.Expire(ctx, key, shared.ShortCacheTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("[Redis] Failed to cache gallery page for user %s: %v", userID, err)
+		return err
 	}
-	return err
+	return nil
 }
 
-// InvalidateGalleryCache removes gallery cache for a user
+// InvalidateGalleryCache removes all cached gallery pages of a user
 func (r *RedisRepoImpl) InvalidateGalleryCache(ctx context.Context, userID string) error {
 	key := "gallery:" + userID
 	err := r.client.Del(ctx, key).Err()
@@ -113,3 +117,118 @@ func (r *RedisRepoImpl) InvalidateGalleryCache(ctx context.Context, userID strin
 	}
 	return err
 }
+
+// GetTimelineCache retrieves a cached timeline. A user's timelines live in one hash so
+// uploads can invalidate them together.
+func (r *RedisRepoImpl) GetTimelineCache(ctx context.Context, userID, key string) (*model.Timeline, error) {
+	val, err := r.client.HGet(ctx, "timeline:"+userID, key).Result()
+	if err == redis.Nil {
+		return nil, nil // Cache miss
+	}
+	if err != nil {
+		log.Printf("[Redis] Failed to get timeline for user %s: %v", userID, err)
+		return nil, nil // Non-fatal
+	}
+
+	var timeline model.Timeline
+	if err := json.Unmarshal([]byte(val), &timeline); err != nil {
+		log.Printf("[Redis] Failed to unmarshal timeline: %v", err)
+		return nil, nil
+	}
+	return &timeline, nil
+}
+
+// SetTimelineCache stores a timeline; the user's timeline hash expires after DefaultCacheTTL
+func (r *RedisRepoImpl) SetTimelineCache(ctx context.Context, userID, key string, timeline *model.Timeline) error {
+	data, err := json.Marshal(timeline)
+	if err != nil {
+		log.Printf("[Redis] Failed to marshal timeline: %v", err)
+		return err
+	}
+	hashKey := "timeline:" + userID
+	pipe := r.client.TxPipeline()
+	pipe.HSet(ctx, hashKey, key, data)
+	pipe.Expire(ctx, hashKey, shared.DefaultCacheTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("[Redis] Failed to cache timeline for user %s: %v", userID, err)
+		return err
+	}
+	return nil
+}
+
+// GetMemoriesCache retrieves cached "on this day" photos. Entries are keyed by date, so each
+// day misses the cache once; a user's entries live in one hash so uploads can invalidate them together.
+func (r *RedisRepoImpl) GetMemoriesCache(ctx context.Context, userID, key string) (*model.Memories, error) {
+	val, err := r.client.HGet(ctx, "memories:"+userID, key).Result()
+	if err == redis.Nil {
+		return nil, nil // Cache miss
+	}
+	if err != nil {
+		log.Printf("[Redis] Failed to get memories for user %s: %v", userID, err)
+		return nil, nil // Non-fatal
+	}
+
+	var memories model.Memories
+	if err := json.Unmarshal([]byte(val), &memories); err != nil {
+		log.Printf("[Redis] Failed to unmarshal memories: %v", err)
+		return nil, nil
+	}
+	return &memories, nil
+}
+
+// SetMemoriesCache stores "on this day" photos; the user's memories hash expires after DefaultCacheTTL
+func (r *RedisRepoImpl) SetMemoriesCache(ctx context.Context, userID, key string, memories *model.Memories) error {
+	data, err := json.Marshal(memories)
+	if err != nil {
+		log.Printf("[Redis] Failed to marshal memories: %v", err)
+		return err
+	}
+	hashKey := "memories:" + userID
+	pipe := r.client.TxPipeline()
+	pipe.HSet(ctx, hashKey, key, data)
+	pipe.Expire(ctx, hashKey, shared.DefaultCacheTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("[Redis] Failed to cache memories for user %s: %v", userID, err)
+		return err
+	}
+	return nil
+}
+
+// GetSimilarCache retrieves cached similar-photo results. A user's results live in one hash
+// so uploads and deletions can invalidate them together.
+func (r *RedisRepoImpl) GetSimilarCache(ctx context.Context, userID, key string) (*model.SimilarPhotos, error) {
+	val, err := r.client.HGet(ctx, "similar:"+userID, key).Result()
+	if err == redis.Nil {
+		return nil, nil // Cache miss
+	}
+	if err != nil {
+		log.Printf("[Redis] Failed to get similar photos for user %s: %v", userID, err)
+		return nil, nil // Non-fatal
+	}
+
+	var similar model.SimilarPhotos
+	if err := json.Unmarshal([]byte(val), &similar); err != nil {
+		log.Printf("[Redis] Failed to unmarshal similar photos: %v", err)
+		return nil, nil
+	}
+	return &similar, nil
+}
+
+// SetSimilarCache stores similar-photo results; the user's hash expires after ShortCacheTTL
+// since edits to the listed photos do not invalidate it
+func (r *RedisRepoImpl) SetSimilarCache(ctx context.Context, userID, key string, similar *model.SimilarPhotos) error {
+	data, err := json.Marshal(similar)
+	if err != nil {
+		log.Printf("[Redis] Failed to marshal similar photos: %v", err)
+		return err
+	}
+	hashKey := "similar:" + userID
+	pipe := r.client.TxPipeline()
+	pipe.HSet(ctx, hashKey, key, data)
+	pipe.Expire(ctx, hashKey, shared.ShortCacheTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("[Redis] Failed to cache similar photos for user %s: %v", userID, err)
+		return err
+	}
+	return nil
+}
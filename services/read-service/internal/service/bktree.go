@@ -0,0 +1,70 @@
+package service
+
+import "math/bits"
+
+// bkTree indexes 64-bit hashes for Hamming distance range queries. Each child edge is
+// labelled with the child's distance to its parent; by the triangle inequality a search
+// only descends into children whose label is within the radius of the query's distance
+// to the parent.
+type bkTree struct {
+	root *bkNode
+}
+
+type bkNode struct {
+	hash     uint64
+	items    []int // Items with exactly this hash
+	children map[int]*bkNode
+}
+
+// Add indexes item under hash
+func (t *bkTree) Add(hash uint64, item int) {
+	if t.root == nil {
+		t.root = &bkNode{hash: hash, items: []int{item}}
+		return
+	}
+	n := t.root
+	for {
+		d := hammingDistance(n.hash, hash)
+		if d == 0 {
+			n.items = append(n.items, item)
+			return
+		}
+		child, ok := n.children[d]
+		if !ok {
+			if n.children == nil {
+				n.children = make(map[int]*bkNode)
+			}
+			n.children[d] = &bkNode{hash: hash, items: []int{item}}
+			return
+		}
+		n = child
+	}
+}
+
+// Search calls fn for every item whose hash is within radius of hash
+func (t *bkTree) Search(hash uint64, radius int, fn func(item int)) {
+	if t.root == nil {
+		return
+	}
+	stack := []*bkNode{t.root}
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		d := hammingDistance(n.hash, hash)
+		if d <= radius {
+			for _, item := range n.items {
+				fn(item)
+			}
+		}
+		for label, child := range n.children {
+			if label >= d-radius && label <= d+radius {
+				stack = append(stack, child)
+			}
+		}
+	}
+}
+
+func hammingDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
@@ -0,0 +1,60 @@
+package service
+
+import (
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+// flipBits returns hash with n distinct random bits inverted
+func flipBits(rng *rand.Rand, hash uint64, n int) uint64 {
+	for _, bit := range rng.Perm(64)[:n] {
+		hash ^= 1 << bit
+	}
+	return hash
+}
+
+func TestBKTreeSearchMatchesBruteForce(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	// Clusters of near-duplicates plus exact repeats, like a real photo library
+	var hashes []uint64
+	for cluster := 0; cluster < 40; cluster++ {
+		base := rng.Uint64()
+		hashes = append(hashes, base, base)
+		for i := 0; i < 10; i++ {
+			hashes = append(hashes, flipBits(rng, base, rng.Intn(16)))
+		}
+	}
+	var tree bkTree
+	for item, hash := range hashes {
+		tree.Add(hash, item)
+	}
+
+	queries := append([]uint64{0, ^uint64(0)}, hashes[:50]...)
+	for i := 0; i < 50; i++ {
+		queries = append(queries, flipBits(rng, hashes[rng.Intn(len(hashes))], rng.Intn(8)))
+	}
+	for _, radius := range []int{0, 1, 4, 10, 20, 64} {
+		for _, query := range queries {
+			var got []int
+			tree.Search(query, radius, func(item int) { got = append(got, item) })
+			slices.Sort(got)
+
+			var want []int
+			for item, hash := range hashes {
+				if hammingDistance(hash, query) <= radius {
+					want = append(want, item)
+				}
+			}
+			if !slices.Equal(got, want) {
+				t.Fatalf("Search(%016x, %d) = %v, want %v", query, radius, got, want)
+			}
+		}
+	}
+}
+
+func TestBKTreeSearchEmpty(t *testing.T) {
+	var tree bkTree
+	tree.Search(0, 64, func(item int) { t.Fatalf("Search on an empty tree returned item %d", item) })
+}
@@ -0,0 +1,151 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+
+	"seungpyolee.com/pkg/model"
+)
+
+const (
+	// DefaultDuplicateDistance is the Hamming distance between perceptual hashes up to which
+	// photos count as near-duplicates when a query does not specify one
+	DefaultDuplicateDistance = 8
+	// MaxDuplicateDistance caps the distance; beyond it unrelated photos start to match
+	MaxDuplicateDistance = 16
+)
+
+// GetNearDuplicates groups the user's photos whose perceptual hashes differ in at most
+// distance bits, directly or through other photos of the group. Photos uploaded before
+// perceptual hashing, or that could not be decoded, are never grouped.
+func (s *GalleryService) GetNearDuplicates(ctx context.Context, userID string, distance int) (*model.DuplicateGroups, error) {
+	if distance == 0 {
+		distance = DefaultDuplicateDistance
+	}
+	if distance < 0 || distance > MaxDuplicateDistance {
+		return nil, fmt.Errorf("%w: distance must be between 1 and %d", ErrInvalidQuery, MaxDuplicateDistance)
+	}
+
+	hashes, err := s.dbRepo.GetPerceptualHashes(ctx, userID)
+	if err != nil {
+		log.Printf("[Gallery] Failed to load perceptual hashes for user %s: %v", userID, err)
+		return nil, err
+	}
+	clusters := clusterNearDuplicates(hashes, distance)
+
+	result := &model.DuplicateGroups{Distance: distance, Groups: []model.DuplicateGroup{}}
+	if len(clusters) == 0 {
+		return result, nil
+	}
+
+	var photoIDs []string
+	for _, c := range clusters {
+		photoIDs = append(photoIDs, c.photoIDs...)
+	}
+	photos, err := s.dbRepo.GetPhotosByIDs(ctx, userID, photoIDs)
+	if err != nil {
+		log.Printf("[Gallery] Failed to fetch near-duplicate photos for user %s: %v", userID, err)
+		return nil, err
+	}
+	byID := make(map[string]model.Photo, len(photos))
+	for _, p := range photos {
+		byID[p.PhotoID] = p
+	}
+
+	for _, c := range clusters {
+		group := model.DuplicateGroup{MaxDistance: c.maxDistance}
+		for _, id := range c.photoIDs {
+			// Skip photos deleted since the hashes were read
+			if p, ok := byID[id]; ok {
+				group.Photos = append(group.Photos, p)
+			}
+		}
+		if len(group.Photos) < 2 {
+			continue
+		}
+		slices.SortFunc(group.Photos, func(a, b model.Photo) int {
+			return cmp.Or(a.UploadedAt.Compare(b.UploadedAt), cmp.Compare(a.PhotoID, b.PhotoID))
+		})
+		group.Count = len(group.Photos)
+		result.Groups = append(result.Groups, group)
+	}
+	slices.SortStableFunc(result.Groups, func(a, b model.DuplicateGroup) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), a.Photos[0].UploadedAt.Compare(b.Photos[0].UploadedAt))
+	})
+	result.Count = len(result.Groups)
+
+	log.Printf("[Gallery] Found %d near-duplicate groups for user %s", result.Count, userID)
+	return result, nil
+}
+
+// duplicateCluster is a connected set of near-duplicate photos
+type duplicateCluster struct {
+	photoIDs    []string
+	maxDistance int
+}
+
+// clusterNearDuplicates links every pair of hashes within distance, found through a BK-tree,
+// and returns the connected sets of two or more photos
+func clusterNearDuplicates(hashes []model.PhotoHash, distance int) []duplicateCluster {
+	values := make([]uint64, 0, len(hashes))
+	ids := make([]string, 0, len(hashes))
+	for _, h := range hashes {
+		v, err := strconv.ParseUint(h.PerceptualHash, 16, 64)
+		if err != nil {
+			continue
+		}
+		values = append(values, v)
+		ids = append(ids, h.PhotoID)
+	}
+
+	var tree bkTree
+	for i, v := range values {
+		tree.Add(v, i)
+	}
+
+	// Union-find over photo indexes
+	parent := make([]int, len(values))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	for i, v := range values {
+		tree.Search(v, distance, func(j int) {
+			if ri, rj := find(i), find(j); ri != rj {
+				parent[ri] = rj
+			}
+		})
+	}
+
+	members := make(map[int][]int)
+	for i := range values {
+		root := find(i)
+		members[root] = append(members[root], i)
+	}
+
+	var clusters []duplicateCluster
+	for _, m := range members {
+		if len(m) < 2 {
+			continue
+		}
+		c := duplicateCluster{photoIDs: make([]string, len(m))}
+		for k, i := range m {
+			c.photoIDs[k] = ids[i]
+			for _, j := range m[k+1:] {
+				c.maxDistance = max(c.maxDistance, hammingDistance(values[i], values[j]))
+			}
+		}
+		clusters = append(clusters, c)
+	}
+	return clusters
+}
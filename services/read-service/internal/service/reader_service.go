@@ -3,23 +3,52 @@ package service
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
 	"log"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+	// Embed the IANA zone database so timeline zones validate in minimal containers
+	_ "time/tzdata"
 
 	"golang.org/x/sync/singleflight"
 	"seungpyolee.com/pkg/model"
+	"seungpyolee.com/pkg/shared"
 	"seungpyolee.com/services/read-service/internal/repository"
 )
 
+// ErrVariantNotFound is returned when a photo has no stored variant with the requested name
+var ErrVariantNotFound = errors.New("variant not found")
+
+// ErrPhotoNotFound is returned when a photo does not exist or is outside the user's library
+var ErrPhotoNotFound = errors.New("photo not found")
+
+// ErrInvalidQuery is returned when query parameters are out of range or inconsistent
+var ErrInvalidQuery = errors.New("invalid query")
+
+const (
+	// DefaultGeoQueryLimit is used when a geospatial query does not specify a limit
+	DefaultGeoQueryLimit = 100
+	// MaxGeoQueryLimit caps the number of photos returned by a geospatial query
+	MaxGeoQueryLimit = 500
+)
+
 type GalleryService struct {
 	dbRepo     repository.CosmosDBRepository
 	cacheRepo  repository.RedisRepository
+	blobRepo   repository.AzureBlobRepository
 	requestGrp singleflight.Group
 }
 
-func NewGalleryService(dbRepo repository.CosmosDBRepository, cacheRepo repository.RedisRepository) *GalleryService {
+// NewGalleryService creates the gallery service; blobRepo may be nil when blob storage is not configured
+func NewGalleryService(dbRepo repository.CosmosDBRepository, cacheRepo repository.RedisRepository, blobRepo repository.AzureBlobRepository) *GalleryService {
 	return &GalleryService{
 		dbRepo:    dbRepo,
 		cacheRepo: cacheRepo,
+		blobRepo:  blobRepo,
 	}
 }
 
@@ -68,60 +97,545 @@ func (s *GalleryService) GetPhotoByID(ctx context.Context, photoID string) (*mod
 	return val.(*model.Photo), nil
 }
 
-// GetPhotosByUser retrieves all photos for a user with gallery list caching
-func (s *GalleryService) GetPhotosByUser(ctx context.Context, userID string) ([]model.Photo, error) {
-	// 1. Try gallery cache first
-	photos, err := s.cacheRepo.GetGalleryCache(ctx, userID)
-	if err == nil && photos != nil {
-		log.Printf("[Gallery] Cache hit for gallery %s", userID)
-		return photos, nil
+// GetPhotosByUser retrieves one page of the user's photos in the given order, starting after
+// cursor (empty for the first page). Pages are cached until the user's gallery changes.
+func (s *GalleryService) GetPhotosByUser(ctx context.Context, userID string, sort model.PhotoSort, cursor string, limit int) (*model.PhotoPage, error) {
+	if !model.ValidPhotoSortField(sort.Field) {
+		return nil, fmt.Errorf("%w: sort must be one of uploaded, captured, filename or size", ErrInvalidQuery)
+	}
+	limit, err := pageLimit(limit)
+	if err != nil {
+		return nil, err
+	}
+	after, err := parseCursor(cursor, sort)
+	if err != nil {
+		return nil, err
+	}
+
+	// 1. Try the page cache first
+	pageKey := fmt.Sprintf("%s:%t:%d:%s", sort.Field, sort.Descending, limit, cursor)
+	page, err := s.cacheRepo.GetGalleryPage(ctx, userID, pageKey)
+	if err == nil && page != nil {
+		log.Printf("[Gallery] Cache hit for gallery %s page %s", userID, pageKey)
+		return page, nil
 	}
 
 	// 2. Singleflight to prevent cache stampede
-	val, err, _ := s.requestGrp.Do("gallery:"+userID, func() (interface{}, error) {
+	val, err, _ := s.requestGrp.Do("gallery:"+userID+":"+pageKey, func() (interface{}, error) {
 		// Double-check cache in case another goroutine populated it
-		if cached, err := s.cacheRepo.GetGalleryCache(ctx, userID); err == nil && cached != nil {
+		if cached, err := s.cacheRepo.GetGalleryPage(ctx, userID, pageKey); err == nil && cached != nil {
 			return cached, nil
 		}
 
-		// DB lookup
-		dbPhotos, err := s.dbRepo.GetPhotosByUserID(ctx, userID)
+		// DB lookup; one extra photo tells whether another page follows
+		dbPhotos, err := s.dbRepo.GetPhotosByUserID(ctx, userID, sort, after, int64(limit+1))
 		if err != nil {
 			log.Printf("[Gallery] DB error for user %s: %v", userID, err)
 			return nil, err
 		}
+		dbPage := newPhotoPage(dbPhotos, sort, limit)
 
 		// Async cache update
-		go func(photos []model.Photo) {
-			if cacheErr := s.cacheRepo.SetGalleryCache(context.Background(), userID, photos); cacheErr != nil {
+		go func(p *model.PhotoPage) {
+			if cacheErr := s.cacheRepo.SetGalleryPage(context.Background(), userID, pageKey, p); cacheErr != nil {
 				log.Printf("[Gallery] Cache update failed for gallery %s: %v", userID, cacheErr)
 				// Non-fatal error
 			}
-		}(dbPhotos)
+		}(dbPage)
 
-		return dbPhotos, nil
+		return dbPage, nil
 	})
 
 	if err != nil {
 		return nil, err
 	}
 
-	if val == nil {
-		return []model.Photo{}, nil
-	}
-
-	result := val.([]model.Photo)
-	log.Printf("[Gallery] Retrieved %d photos for user %s", len(result), userID)
+	result := val.(*model.PhotoPage)
+	log.Printf("[Gallery] Retrieved %d photos for user %s", result.Count, userID)
 	return result, nil
 }
 
-// GetPhotosByDateRange retrieves photos within a date range
-func (s *GalleryService) GetPhotosByDateRange(ctx context.Context, userID, startDate, endDate string) ([]model.Photo, error) {
-	photos, err := s.dbRepo.GetPhotosByDateRange(ctx, userID, startDate, endDate)
+// GetPhotosByDateRange retrieves one page of the photos whose upload or capture date, per
+// field, lies within a range, most recent first. Bounds are RFC 3339 times or YYYY-MM-DD
+// dates; a date covers the whole UTC day.
+func (s *GalleryService) GetPhotosByDateRange(ctx context.Context, userID, field, startDate, endDate, cursor string, limit int) (*model.PhotoPage, error) {
+	if field == "" {
+		field = model.DateFieldUploaded
+	}
+	if field != model.DateFieldUploaded && field != model.DateFieldCaptured {
+		return nil, fmt.Errorf("%w: field must be captured or uploaded", ErrInvalidQuery)
+	}
+	start, err := parseDateBound("startDate", startDate, false)
+	if err != nil {
+		return nil, err
+	}
+	end, err := parseDateBound("endDate", endDate, true)
+	if err != nil {
+		return nil, err
+	}
+	if end.Before(start) {
+		return nil, fmt.Errorf("%w: endDate must not be before startDate", ErrInvalidQuery)
+	}
+	limit, err = pageLimit(limit)
+	if err != nil {
+		return nil, err
+	}
+	// Date fields share their names with the sort fields
+	sort := model.PhotoSort{Field: field, Descending: true}
+	after, err := parseCursor(cursor, sort)
+	if err != nil {
+		return nil, err
+	}
+
+	photos, err := s.dbRepo.GetPhotosByDateRange(ctx, userID, field, start, end, after, int64(limit+1))
 	if err != nil {
 		log.Printf("[Gallery] Failed to fetch photos in date range: %v", err)
 		return nil, err
 	}
+	return newPhotoPage(photos, sort, limit), nil
+}
+
+// newPhotoPage trims photos, fetched with one extra, to limit and sets the cursor of the next page
+func newPhotoPage(photos []model.Photo, sort model.PhotoSort, limit int) *model.PhotoPage {
+	page := &model.PhotoPage{Photos: photos}
+	if len(photos) > limit {
+		page.Photos = photos[:limit]
+		page.NextCursor = model.NewPhotoCursor(sort, page.Photos[limit-1])
+	}
+	if page.Photos == nil {
+		page.Photos = []model.Photo{}
+	}
+	page.Count = len(page.Photos)
+	return page
+}
+
+// pageLimit applies the default to an unset page size and rejects values outside 1..shared.MaxPageSize
+func pageLimit(limit int) (int, error) {
+	if limit == 0 {
+		return shared.DefaultPageSize, nil
+	}
+	if limit < 0 || limit > shared.MaxPageSize {
+		return 0, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidQuery, shared.MaxPageSize)
+	}
+	return limit, nil
+}
+
+// parseCursor decodes a page cursor; an empty cursor means the first page
+func parseCursor(cursor string, sort model.PhotoSort) (*model.PhotoCursor, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+	after, err := model.ParsePhotoCursor(cursor, sort)
+	if err != nil {
+		return nil, fmt.Errorf("%w: cursor is malformed or belongs to another sort order", ErrInvalidQuery)
+	}
+	return after, nil
+}
+
+// parseDateBound parses an RFC 3339 time or a YYYY-MM-DD date. A date used as the end
+// of a range stands for the last millisecond of that day, the precision MongoDB stores.
+func parseDateBound(name, value string, end bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %s must be an RFC 3339 time or a YYYY-MM-DD date", ErrInvalidQuery, name)
+	}
+	if end {
+		t = t.AddDate(0, 0, 1).Add(-time.Millisecond)
+	}
+	return t, nil
+}
 
+// SharedVariantName maps a variant requested by a non-owner to the one they may receive:
+// the original is replaced by the sanitized shared copy unless the privacy mode is "none"
+func SharedVariantName(photo *model.Photo, name string) string {
+	if name == model.VariantOriginal && photo.AppliedPrivacy != model.PrivacyModeNone {
+		return model.VariantShared
+	}
+	return name
+}
+
+// GetPhotoVariant opens the blob of a named variant recorded on the photo for streaming; the
+// caller must close it. The returned variant's Size is the size of the blob, -1 if unknown.
+func (s *GalleryService) GetPhotoVariant(ctx context.Context, photo *model.Photo, name string) (*model.PhotoVariant, io.ReadCloser, error) {
+	variant, ok := photo.Variant(name)
+	if !ok {
+		return nil, nil, ErrVariantNotFound
+	}
+
+	body, size, err := s.blobRepo.OpenBlob(ctx, variant.BlobName)
+	if err != nil {
+		log.Printf("[Gallery] Failed to download variant %s of photo %s: %v", name, photo.PhotoID, err)
+		return nil, nil, err
+	}
+	variant.Size = size
+	return &variant, body, nil
+}
+
+// GetPhotosInBoundingBox retrieves the user's photos located inside a latitude/longitude box.
+// minLng greater than maxLng selects a box that crosses the antimeridian.
+func (s *GalleryService) GetPhotosInBoundingBox(ctx context.Context, userID string, minLat, minLng, maxLat, maxLng float64, limit int) ([]model.Photo, error) {
+	if !validLatitude(minLat) || !validLatitude(maxLat) || !validLongitude(minLng) || !validLongitude(maxLng) {
+		return nil, fmt.Errorf("%w: coordinates out of range", ErrInvalidQuery)
+	}
+	if minLat >= maxLat {
+		return nil, fmt.Errorf("%w: minLat must be less than maxLat", ErrInvalidQuery)
+	}
+	width := maxLng - minLng
+	if width < 0 {
+		width += 360
+	}
+	if width == 0 {
+		return nil, fmt.Errorf("%w: bounding box has zero width", ErrInvalidQuery)
+	}
+	limit, err := geoQueryLimit(limit)
+	if err != nil {
+		return nil, err
+	}
+
+	photos, err := s.dbRepo.GetPhotosInBoundingBox(ctx, userID, minLat, minLng, maxLat, maxLng, int64(limit))
+	if err != nil {
+		log.Printf("[Gallery] Failed to fetch photos in bounding box: %v", err)
+		return nil, err
+	}
+	if photos == nil {
+		photos = []model.Photo{}
+	}
 	return photos, nil
 }
+
+// GetPhotosNear retrieves the user's photos within radiusMeters of a point, nearest first
+func (s *GalleryService) GetPhotosNear(ctx context.Context, userID string, lat, lng, radiusMeters float64, limit int) ([]model.PhotoNearResult, error) {
+	if !validLatitude(lat) || !validLongitude(lng) {
+		return nil, fmt.Errorf("%w: coordinates out of range", ErrInvalidQuery)
+	}
+	if math.IsNaN(radiusMeters) || radiusMeters <= 0 {
+		return nil, fmt.Errorf("%w: radius must be positive", ErrInvalidQuery)
+	}
+	limit, err := geoQueryLimit(limit)
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := s.dbRepo.GetPhotosNear(ctx, userID, lat, lng, radiusMeters, int64(limit))
+	if err != nil {
+		log.Printf("[Gallery] Failed to fetch photos near point: %v", err)
+		return nil, err
+	}
+	if results == nil {
+		results = []model.PhotoNearResult{}
+	}
+	return results, nil
+}
+
+// GetPhotosByPlace retrieves one page of the user's photos taken at a place, most recent
+// upload first; at least one of country code, region or city must be given and empty
+// fields match anything
+func (s *GalleryService) GetPhotosByPlace(ctx context.Context, userID string, place model.PhotoPlace, cursor string, limit int) (*model.PhotoPage, error) {
+	place.CountryCode = strings.ToUpper(strings.TrimSpace(place.CountryCode))
+	place.Region = strings.TrimSpace(place.Region)
+	place.City = strings.TrimSpace(place.City)
+	if place.CountryCode == "" && place.Region == "" && place.City == "" {
+		return nil, fmt.Errorf("%w: country, region or city is required", ErrInvalidQuery)
+	}
+	limit, err := pageLimit(limit)
+	if err != nil {
+		return nil, err
+	}
+	after, err := parseCursor(cursor, model.DefaultPhotoSort)
+	if err != nil {
+		return nil, err
+	}
+
+	photos, err := s.dbRepo.GetPhotosByPlace(ctx, userID, place, after, int64(limit+1))
+	if err != nil {
+		log.Printf("[Gallery] Failed to fetch photos by place: %v", err)
+		return nil, err
+	}
+	return newPhotoPage(photos, model.DefaultPhotoSort, limit), nil
+}
+
+// GetPlaceSummaries groups the user's photos by place, optionally within one country
+func (s *GalleryService) GetPlaceSummaries(ctx context.Context, userID, countryCode string) ([]model.PlaceSummary, error) {
+	summaries, err := s.dbRepo.GetPlaceSummaries(ctx, userID, strings.ToUpper(strings.TrimSpace(countryCode)))
+	if err != nil {
+		log.Printf("[Gallery] Failed to group photos by place: %v", err)
+		return nil, err
+	}
+	if summaries == nil {
+		summaries = []model.PlaceSummary{}
+	}
+	return summaries, nil
+}
+
+// GetPhotosByTimeOfDay retrieves one page of the user's photos taken between two local
+// wall-clock times, given as minutes after midnight, most recently captured first. A start
+// after the end wraps past midnight.
+func (s *GalleryService) GetPhotosByTimeOfDay(ctx context.Context, userID string, startMinute, endMinute int, cursor string, limit int) (*model.PhotoPage, error) {
+	if !validMinuteOfDay(startMinute) || !validMinuteOfDay(endMinute) {
+		return nil, fmt.Errorf("%w: time of day out of range", ErrInvalidQuery)
+	}
+	limit, err := pageLimit(limit)
+	if err != nil {
+		return nil, err
+	}
+	sort := model.PhotoSort{Field: model.PhotoSortCaptured, Descending: true}
+	after, err := parseCursor(cursor, sort)
+	if err != nil {
+		return nil, err
+	}
+
+	photos, err := s.dbRepo.GetPhotosByTimeOfDay(ctx, userID, startMinute, endMinute, after, int64(limit+1))
+	if err != nil {
+		log.Printf("[Gallery] Failed to fetch photos by time of day: %v", err)
+		return nil, err
+	}
+	return newPhotoPage(photos, sort, limit), nil
+}
+
+// GetTimeline counts the user's photos per day, month or year of capture in the given time
+// zone, an IANA name or a "+09:00" offset. Empty arguments default to months in UTC.
+// Timelines are cached until the user's photos change.
+func (s *GalleryService) GetTimeline(ctx context.Context, userID, granularity, timeZone string) (*model.Timeline, error) {
+	if granularity == "" {
+		granularity = model.TimelineMonth
+	}
+	if granularity != model.TimelineDay && granularity != model.TimelineMonth && granularity != model.TimelineYear {
+		return nil, fmt.Errorf("%w: granularity must be day, month or year", ErrInvalidQuery)
+	}
+	if timeZone == "" {
+		timeZone = "UTC"
+	}
+	if _, ok := loadTimeZone(timeZone); !ok {
+		return nil, fmt.Errorf("%w: unknown time zone %q", ErrInvalidQuery, timeZone)
+	}
+
+	// 1. Try cache first
+	key := granularity + ":" + timeZone
+	timeline, err := s.cacheRepo.GetTimelineCache(ctx, userID, key)
+	if err == nil && timeline != nil {
+		log.Printf("[Gallery] Cache hit for timeline %s %s", userID, key)
+		return timeline, nil
+	}
+
+	// 2. Singleflight to prevent cache stampede
+	val, err, _ := s.requestGrp.Do("timeline:"+userID+":"+key, func() (interface{}, error) {
+		// Double-check cache in case another goroutine populated it
+		if cached, err := s.cacheRepo.GetTimelineCache(ctx, userID, key); err == nil && cached != nil {
+			return cached, nil
+		}
+
+		buckets, err := s.dbRepo.GetTimeline(ctx, userID, granularity, timeZone)
+		if err != nil {
+			log.Printf("[Gallery] Failed to aggregate timeline for user %s: %v", userID, err)
+			return nil, err
+		}
+		dbTimeline := newTimeline(granularity, timeZone, buckets)
+
+		// Async cache update
+		go func(t *model.Timeline) {
+			if cacheErr := s.cacheRepo.SetTimelineCache(context.Background(), userID, key, t); cacheErr != nil {
+				log.Printf("[Gallery] Cache update failed for timeline %s: %v", userID, cacheErr)
+				// Non-fatal error
+			}
+		}(dbTimeline)
+
+		return dbTimeline, nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return val.(*model.Timeline), nil
+}
+
+// newTimeline separates the undated bucket from the dated ones and totals them
+func newTimeline(granularity, timeZone string, buckets []model.TimelineBucket) *model.Timeline {
+	timeline := &model.Timeline{
+		Granularity: granularity,
+		TimeZone:    timeZone,
+		Buckets:     make([]model.TimelineBucket, 0, len(buckets)),
+	}
+	for _, b := range buckets {
+		timeline.Total += b.Count
+		if b.Period == "" {
+			timeline.Undated += b.Count
+			continue
+		}
+		timeline.Buckets = append(timeline.Buckets, b)
+	}
+	return timeline
+}
+
+// utcOffsetPattern matches the offsets Mongo accepts as a timezone, e.g. "+09:00"
+var utcOffsetPattern = regexp.MustCompile(`^[+-](?:0\d|1[0-4]):[0-5]\d$`)
+
+// loadTimeZone resolves a UTC offset or an IANA zone name other than the server's "Local"
+func loadTimeZone(name string) (*time.Location, bool) {
+	if utcOffsetPattern.MatchString(name) {
+		t, _ := time.Parse("-07:00", name)
+		_, seconds := t.Zone()
+		return time.FixedZone(name, seconds), true
+	}
+	if name == "Local" {
+		return nil, false
+	}
+	loc, err := time.LoadLocation(name)
+	return loc, err == nil
+}
+
+const (
+	// MaxMemoriesWindow caps the days either side of the date an "on this day" query covers,
+	// which keeps the ranges of consecutive years apart
+	MaxMemoriesWindow = 30
+	// MaxMemoriesPhotos caps the number of photos returned by an "on this day" query
+	MaxMemoriesPhotos = 500
+	// earliestMemoryYear is the first year searched; upload-service rejects earlier capture dates
+	earliestMemoryYear = 1990
+)
+
+// GetMemories retrieves the user's photos captured on the same month and day as date, give or
+// take window days, in each earlier year. The date is YYYY-MM-DD, by default today; both it
+// and the capture dates are read in timeZone, an IANA name or a "+09:00" offset (default UTC).
+// Results are cached per user and day until the user's photos change.
+func (s *GalleryService) GetMemories(ctx context.Context, userID, date, timeZone string, window int) (*model.Memories, error) {
+	if timeZone == "" {
+		timeZone = "UTC"
+	}
+	loc, ok := loadTimeZone(timeZone)
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown time zone %q", ErrInvalidQuery, timeZone)
+	}
+	if window < 0 || window > MaxMemoriesWindow {
+		return nil, fmt.Errorf("%w: window must be between 0 and %d days", ErrInvalidQuery, MaxMemoriesWindow)
+	}
+	day := time.Now().In(loc)
+	if date != "" {
+		t, err := time.ParseInLocation(time.DateOnly, date, loc)
+		if err != nil {
+			return nil, fmt.Errorf("%w: date must be a YYYY-MM-DD date", ErrInvalidQuery)
+		}
+		day = t
+	}
+	day = time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, loc)
+
+	// 1. Try cache first
+	key := fmt.Sprintf("%s:%s:%d", day.Format(time.DateOnly), timeZone, window)
+	memories, err := s.cacheRepo.GetMemoriesCache(ctx, userID, key)
+	if err == nil && memories != nil {
+		log.Printf("[Gallery] Cache hit for memories %s %s", userID, key)
+		return memories, nil
+	}
+
+	// 2. Singleflight to prevent cache stampede
+	val, err, _ := s.requestGrp.Do("memories:"+userID+":"+key, func() (interface{}, error) {
+		// Double-check cache in case another goroutine populated it
+		if cached, err := s.cacheRepo.GetMemoriesCache(ctx, userID, key); err == nil && cached != nil {
+			return cached, nil
+		}
+
+		ranges := memoryRanges(day, window)
+		photos, err := s.dbRepo.GetPhotosCapturedInRanges(ctx, userID, ranges, MaxMemoriesPhotos)
+		if err != nil {
+			log.Printf("[Gallery] Failed to fetch memories for user %s: %v", userID, err)
+			return nil, err
+		}
+		dbMemories := newMemories(day, timeZone, window, ranges, photos)
+
+		// Async cache update
+		go func(m *model.Memories) {
+			if cacheErr := s.cacheRepo.SetMemoriesCache(context.Background(), userID, key, m); cacheErr != nil {
+				log.Printf("[Gallery] Cache update failed for memories %s: %v", userID, cacheErr)
+				// Non-fatal error
+			}
+		}(dbMemories)
+
+		return dbMemories, nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return val.(*model.Memories), nil
+}
+
+// memoryRanges returns the window around day's anniversary in each earlier year, the
+// previous year first. In common years a leap day is remembered on February 28, and
+// February 28 of a common year also covers the leap days before it.
+func memoryRanges(day time.Time, window int) []model.TimeRange {
+	var ranges []model.TimeRange
+	for year := day.Year() - 1; year >= earliestMemoryYear; year-- {
+		d, extra := day.Day(), 0
+		if day.Month() == time.February {
+			if d == 29 && !isLeapYear(year) {
+				d = 28
+			}
+			if d == 28 && !isLeapYear(day.Year()) && isLeapYear(year) {
+				extra = 1
+			}
+		}
+		anniversary := time.Date(year, day.Month(), d, 0, 0, 0, 0, day.Location())
+		ranges = append(ranges, model.TimeRange{
+			Start: anniversary.AddDate(0, 0, -window),
+			End:   anniversary.AddDate(0, 0, window+1+extra),
+		})
+	}
+	return ranges
+}
+
+// newMemories groups photos, most recently captured first, by the range of memoryRanges they fall in
+func newMemories(day time.Time, timeZone string, window int, ranges []model.TimeRange, photos []model.Photo) *model.Memories {
+	memories := &model.Memories{
+		Date:     day.Format(time.DateOnly),
+		TimeZone: timeZone,
+		Window:   window,
+		Years:    []model.MemoryYear{},
+	}
+	for _, photo := range photos {
+		captured := photo.Metadata.DateTimeOriginal
+		for i, r := range ranges {
+			if captured.Before(r.Start) || !captured.Before(r.End) {
+				continue
+			}
+			year := day.Year() - 1 - i
+			if n := len(memories.Years); n == 0 || memories.Years[n-1].Year != year {
+				memories.Years = append(memories.Years, model.MemoryYear{Year: year, YearsAgo: i + 1, Photos: []model.Photo{}})
+			}
+			group := &memories.Years[len(memories.Years)-1]
+			group.Photos = append(group.Photos, photo)
+			group.Count++
+			memories.Count++
+			break
+		}
+	}
+	return memories
+}
+
+func isLeapYear(year int) bool {
+	return year%4 == 0 && (year%100 != 0 || year%400 == 0)
+}
+
+// geoQueryLimit applies the default to an unset limit and rejects values outside 1..MaxGeoQueryLimit
+func geoQueryLimit(limit int) (int, error) {
+	if limit == 0 {
+		return DefaultGeoQueryLimit, nil
+	}
+	if limit < 0 || limit > MaxGeoQueryLimit {
+		return 0, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidQuery, MaxGeoQueryLimit)
+	}
+	return limit, nil
+}
+
+func validLatitude(v float64) bool {
+	return v >= -90 && v <= 90
+}
+
+func validLongitude(v float64) bool {
+	return v >= -180 && v <= 180
+}
+
+func validMinuteOfDay(v int) bool {
+	return v >= 0 && v < 24*60
+}
@@ -0,0 +1,109 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"seungpyolee.com/pkg/model"
+)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func TestMemoryRanges(t *testing.T) {
+	tests := []struct {
+		name   string
+		day    time.Time
+		window int
+		want   map[int]model.TimeRange // By year
+	}{
+		{"leap day in common years", date(2024, time.February, 29), 0, map[int]model.TimeRange{
+			2023: {Start: date(2023, time.February, 28), End: date(2023, time.March, 1)},
+			2021: {Start: date(2021, time.February, 28), End: date(2021, time.March, 1)},
+			2020: {Start: date(2020, time.February, 29), End: date(2020, time.March, 1)},
+			2000: {Start: date(2000, time.February, 29), End: date(2000, time.March, 1)},
+		}},
+		{"leap day with window", date(2024, time.February, 29), 1, map[int]model.TimeRange{
+			2023: {Start: date(2023, time.February, 27), End: date(2023, time.March, 2)},
+			2020: {Start: date(2020, time.February, 28), End: date(2020, time.March, 2)},
+		}},
+		{"feb 28 of a common year covers earlier leap days", date(2025, time.February, 28), 0, map[int]model.TimeRange{
+			2024: {Start: date(2024, time.February, 28), End: date(2024, time.March, 1)},
+			2023: {Start: date(2023, time.February, 28), End: date(2023, time.March, 1)},
+		}},
+		{"feb 28 of a leap year leaves the leap day alone", date(2024, time.February, 28), 0, map[int]model.TimeRange{
+			2023: {Start: date(2023, time.February, 28), End: date(2023, time.March, 1)},
+			2020: {Start: date(2020, time.February, 28), End: date(2020, time.February, 29)},
+		}},
+		{"march 1 after a leap day", date(2025, time.March, 1), 0, map[int]model.TimeRange{
+			2024: {Start: date(2024, time.March, 1), End: date(2024, time.March, 2)},
+		}},
+		{"window spans leap day", date(2024, time.March, 1), 1, map[int]model.TimeRange{
+			2023: {Start: date(2023, time.February, 28), End: date(2023, time.March, 3)},
+			2020: {Start: date(2020, time.February, 29), End: date(2020, time.March, 3)},
+		}},
+		{"1900 is not a leap year", date(2000, time.February, 29), 0, map[int]model.TimeRange{
+			1999: {Start: date(1999, time.February, 28), End: date(1999, time.March, 1)},
+			1996: {Start: date(1996, time.February, 29), End: date(1996, time.March, 1)},
+		}},
+		{"new year's day reaches back into december", date(2025, time.January, 1), 3, map[int]model.TimeRange{
+			2024: {Start: date(2023, time.December, 29), End: date(2024, time.January, 5)},
+		}},
+		{"new year's eve reaches into january", date(2024, time.December, 31), 2, map[int]model.TimeRange{
+			2023: {Start: date(2023, time.December, 29), End: date(2024, time.January, 3)},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ranges := memoryRanges(tt.day, tt.window)
+			if want := tt.day.Year() - earliestMemoryYear; len(ranges) != want {
+				t.Fatalf("memoryRanges() returned %d ranges, want %d", len(ranges), want)
+			}
+			for year, want := range tt.want {
+				got := ranges[tt.day.Year()-1-year]
+				if !got.Start.Equal(want.Start) || !got.End.Equal(want.End) {
+					t.Fatalf("memoryRanges() for %d = [%v, %v), want [%v, %v)", year, got.Start, got.End, want.Start, want.End)
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryRangesKeepLocation(t *testing.T) {
+	seoul, err := time.LoadLocation("Asia/Seoul")
+	if err != nil {
+		t.Skip("tzdata not available:", err)
+	}
+	ranges := memoryRanges(time.Date(2025, time.January, 1, 0, 0, 0, 0, seoul), 0)
+	if want := time.Date(2024, time.January, 1, 0, 0, 0, 0, seoul); !ranges[0].Start.Equal(want) {
+		t.Fatalf("memoryRanges()[0].Start = %v, want %v", ranges[0].Start, want)
+	}
+}
+
+func TestNewMemoriesGroupsByAnniversaryYear(t *testing.T) {
+	day := date(2025, time.January, 1)
+	ranges := memoryRanges(day, 3)
+	captured := func(id string, t time.Time) model.Photo {
+		return model.Photo{PhotoID: id, Metadata: model.PhotoMetadata{DateTimeOriginal: t}}
+	}
+	// Most recently captured first, as GetPhotosCapturedInRanges returns them
+	photos := []model.Photo{
+		captured("jan-2024", date(2024, time.January, 2)),
+		captured("dec-2023", date(2023, time.December, 30)),
+		captured("outside", date(2023, time.December, 20)),
+		captured("dec-2022", date(2022, time.December, 29)),
+	}
+
+	memories := newMemories(day, "UTC", 3, ranges, photos)
+	if memories.Count != 3 || len(memories.Years) != 2 {
+		t.Fatalf("newMemories() = %d photos in %d years, want 3 in 2", memories.Count, len(memories.Years))
+	}
+	// December 30, 2023 belongs to the 2024 anniversary of New Year's Day
+	if y := memories.Years[0]; y.Year != 2024 || y.YearsAgo != 1 || y.Count != 2 || y.Photos[1].PhotoID != "dec-2023" {
+		t.Fatalf("newMemories().Years[0] = %+v", y)
+	}
+	if y := memories.Years[1]; y.Year != 2023 || y.YearsAgo != 2 || y.Count != 1 || y.Photos[0].PhotoID != "dec-2022" {
+		t.Fatalf("newMemories().Years[1] = %+v", y)
+	}
+}
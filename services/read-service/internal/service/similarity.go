@@ -0,0 +1,172 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"slices"
+	"strconv"
+
+	"seungpyolee.com/pkg/model"
+)
+
+const (
+	// DefaultSimilarLimit is the number of similar photos returned when a query does not specify a limit
+	DefaultSimilarLimit = 20
+	// MaxSimilarLimit caps the number of similar photos returned
+	MaxSimilarLimit = 100
+	// maxSimilarCandidates bounds how many candidates from the band index, most shared bands first, are scored per search
+	maxSimilarCandidates = 5000
+	// minSimilarityScore drops candidates that only share a hash band by chance
+	minSimilarityScore = 0.5
+	// Weights of structure (perceptual hash) and color (histogram) in the score
+	hashWeight      = 0.7
+	histogramWeight = 0.3
+)
+
+// GetSimilarPhotos ranks the photos in the user's library that look like photoID. Candidates
+// come from the perceptual hash band index and are scored on hash distance and color
+// histogram overlap. Results are cached until the user adds or deletes photos.
+func (s *GalleryService) GetSimilarPhotos(ctx context.Context, userID, photoID string, limit int) (*model.SimilarPhotos, error) {
+	if limit == 0 {
+		limit = DefaultSimilarLimit
+	}
+	if limit < 0 || limit > MaxSimilarLimit {
+		return nil, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidQuery, MaxSimilarLimit)
+	}
+
+	// 1. Try cache first
+	key := fmt.Sprintf("%s:%d", photoID, limit)
+	similar, err := s.cacheRepo.GetSimilarCache(ctx, userID, key)
+	if err == nil && similar != nil {
+		log.Printf("[Gallery] Cache hit for similar photos %s %s", userID, key)
+		return similar, nil
+	}
+
+	// 2. Singleflight to prevent cache stampede
+	val, err, _ := s.requestGrp.Do("similar:"+userID+":"+key, func() (interface{}, error) {
+		// Double-check cache in case another goroutine populated it
+		if cached, err := s.cacheRepo.GetSimilarCache(ctx, userID, key); err == nil && cached != nil {
+			return cached, nil
+		}
+
+		dbSimilar, err := s.findSimilarPhotos(ctx, userID, photoID, limit)
+		if err != nil {
+			return nil, err
+		}
+
+		// Async cache update
+		go func(sp *model.SimilarPhotos) {
+			if cacheErr := s.cacheRepo.SetSimilarCache(context.Background(), userID, key, sp); cacheErr != nil {
+				log.Printf("[Gallery] Cache update failed for similar photos %s: %v", userID, cacheErr)
+				// Non-fatal error
+			}
+		}(dbSimilar)
+
+		return dbSimilar, nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return val.(*model.SimilarPhotos), nil
+}
+
+// findSimilarPhotos scores the band index candidates against the photo and loads the best ones
+func (s *GalleryService) findSimilarPhotos(ctx context.Context, userID, photoID string, limit int) (*model.SimilarPhotos, error) {
+	source, err := s.dbRepo.GetPhotoHash(ctx, photoID)
+	if err != nil {
+		log.Printf("[Gallery] Failed to fetch photo %s: %v", photoID, err)
+		return nil, err
+	}
+	// Other users' photos are not searched, shared or not
+	if source.PhotoID == "" || source.UserID != userID {
+		return nil, ErrPhotoNotFound
+	}
+
+	result := &model.SimilarPhotos{PhotoID: photoID, Results: []model.SimilarPhoto{}}
+	sourceHash, err := strconv.ParseUint(source.PerceptualHash, 16, 64)
+	if err != nil {
+		// Uploaded before hashing or not decodable: nothing to compare against
+		return result, nil
+	}
+
+	candidates, err := s.dbRepo.GetSimilarCandidates(ctx, userID, model.PerceptualHashBands(source.PerceptualHash), maxSimilarCandidates)
+	if err != nil {
+		log.Printf("[Gallery] Failed to fetch similar photo candidates for %s: %v", photoID, err)
+		return nil, err
+	}
+
+	var ranked []model.SimilarPhoto
+	for _, c := range candidates {
+		hash, err := strconv.ParseUint(c.PerceptualHash, 16, 64)
+		if err != nil || c.PhotoID == photoID {
+			continue
+		}
+		distance := hammingDistance(sourceHash, hash)
+		score := similarityScore(distance, source.ColorHistogram, c.ColorHistogram)
+		if score < minSimilarityScore {
+			continue
+		}
+		ranked = append(ranked, model.SimilarPhoto{Photo: model.Photo{PhotoID: c.PhotoID}, Score: score, Distance: distance})
+	}
+	slices.SortFunc(ranked, func(a, b model.SimilarPhoto) int {
+		return cmp.Or(cmp.Compare(b.Score, a.Score), cmp.Compare(a.Photo.PhotoID, b.Photo.PhotoID))
+	})
+	if len(ranked) > limit {
+		ranked = ranked[:limit]
+	}
+	if len(ranked) == 0 {
+		return result, nil
+	}
+
+	photoIDs := make([]string, len(ranked))
+	for i, r := range ranked {
+		photoIDs[i] = r.Photo.PhotoID
+	}
+	photos, err := s.dbRepo.GetPhotosByIDs(ctx, userID, photoIDs)
+	if err != nil {
+		log.Printf("[Gallery] Failed to fetch similar photos for %s: %v", photoID, err)
+		return nil, err
+	}
+	byID := make(map[string]model.Photo, len(photos))
+	for _, p := range photos {
+		byID[p.PhotoID] = p
+	}
+	for _, r := range ranked {
+		if p, ok := byID[r.Photo.PhotoID]; ok {
+			r.Photo = p
+			result.Results = append(result.Results, r)
+		}
+	}
+	result.Count = len(result.Results)
+	return result, nil
+}
+
+// similarityScore combines perceptual hash distance, where half the bits differing is as
+// unrelated as two photos get, with histogram overlap. Without both histograms only the
+// hash counts.
+func similarityScore(distance int, a, b []byte) float64 {
+	hashScore := max(0, 1-float64(distance)/32)
+	score := hashScore
+	if len(a) > 0 && len(a) == len(b) {
+		score = hashWeight*hashScore + histogramWeight*histogramIntersection(a, b)
+	}
+	return math.Round(score*1000) / 1000
+}
+
+// histogramIntersection returns the share of pixels two color histograms have in common, 0 to 1
+func histogramIntersection(a, b []byte) float64 {
+	var common, totalA, totalB int
+	for i := range a {
+		common += int(min(a[i], b[i]))
+		totalA += int(a[i])
+		totalB += int(b[i])
+	}
+	if total := max(totalA, totalB); total > 0 {
+		return float64(common) / float64(total)
+	}
+	return 0
+}
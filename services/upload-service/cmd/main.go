@@ -1,12 +1,15 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"time"
 
 	"seungpyolee.com/pkg/auth"
+	"seungpyolee.com/pkg/shared"
 	"seungpyolee.com/services/upload-service/internal/handler"
 	"seungpyolee.com/services/upload-service/internal/repository"
 	"seungpyolee.com/services/upload-service/internal/service"
@@ -35,6 +38,63 @@ func main() {
 		azureContainerName = "photos"
 	}
 
+	// Accepted upload types (comma-separated, e.g. "image/jpeg,image/png") and
+	// extension/content mismatch policy ("content" or "reject")
+	contentPolicy, err := service.ParseContentTypePolicy(os.Getenv("UPLOAD_ALLOWED_TYPES"), os.Getenv("UPLOAD_TYPE_MISMATCH_POLICY"))
+	if err != nil {
+		log.Fatalf("Invalid upload content type configuration: %v", err)
+	}
+
+	// Resized variant profiles as inline JSON or a JSON file (defaults to 1080/720/480 JPEG)
+	variantProfiles, err := service.LoadVariantProfiles(os.Getenv("VARIANT_PROFILES"), os.Getenv("VARIANT_PROFILES_FILE"))
+	if err != nil {
+		log.Fatalf("Invalid variant profile configuration: %v", err)
+	}
+
+	// Offline reverse geocoding from GEOCODER_PLACES_FILE (e.g. GeoNames cities15000.txt, with
+	// region and country names from GEOCODER_REGIONS_FILE and GEOCODER_COUNTRIES_FILE),
+	// matching places within GEOCODER_MAX_DISTANCE_KM of the photo (default 100).
+	// Without a dataset photos keep their GPS position but get no place or zone from it.
+	var geocoderMaxDistance float64
+	if v := os.Getenv("GEOCODER_MAX_DISTANCE_KM"); v != "" {
+		geocoderMaxDistance, err = strconv.ParseFloat(v, 64)
+		if err != nil {
+			log.Fatalf("Invalid GEOCODER_MAX_DISTANCE_KM: %v", err)
+		}
+	}
+	var geocoder *service.ReverseGeocoder
+	if placesFile := os.Getenv("GEOCODER_PLACES_FILE"); placesFile != "" {
+		geocoder, err = service.LoadReverseGeocoder(service.GeocoderDataset{
+			PlacesFile:    placesFile,
+			RegionsFile:   os.Getenv("GEOCODER_REGIONS_FILE"),
+			CountriesFile: os.Getenv("GEOCODER_COUNTRIES_FILE"),
+		}, geocoderMaxDistance)
+		if err != nil {
+			log.Fatalf("Failed to load reverse geocoder: %v", err)
+		}
+		log.Printf("Reverse geocoder loaded with %d places", geocoder.Size())
+	} else {
+		log.Println("Reverse geocoding disabled; set GEOCODER_PLACES_FILE to label photos with places")
+	}
+
+	// How long responses to requests with an Idempotency-Key are replayed (Go duration, default 24h)
+	var idempotencyTTL time.Duration
+	if v := os.Getenv("IDEMPOTENCY_KEY_TTL"); v != "" {
+		idempotencyTTL, err = time.ParseDuration(v)
+		if err != nil || idempotencyTTL <= 0 {
+			log.Fatalf("Invalid IDEMPOTENCY_KEY_TTL: %q", v)
+		}
+	}
+
+	// Background processing workers in this instance (default 2); 0 leaves processing to other instances
+	processingWorkers := shared.DefaultProcessingWorkers
+	if v := os.Getenv("PROCESSING_WORKERS"); v != "" {
+		processingWorkers, err = strconv.Atoi(v)
+		if err != nil || processingWorkers < 0 {
+			log.Fatalf("Invalid PROCESSING_WORKERS: %q", v)
+		}
+	}
+
 	dbName := "PhotoGalleryDB"
 
 	// 2. Initialize Repositories (Infrastructure Layer)
@@ -54,21 +114,62 @@ func main() {
 
 	// 3. Initialize Service Layer (Business Logic)
 	log.Println("Initializing Service Layer...")
-	uploaderSvc := service.NewUploaderService(cosmosRepo, blobRepo, redisRepo)
+	uploaderSvc := service.NewUploaderService(cosmosRepo, blobRepo, redisRepo, contentPolicy, variantProfiles, geocoder)
+	resumableSvc := service.NewResumableUploadService(blobRepo, redisRepo, uploaderSvc)
+	idempotencySvc := service.NewIdempotencyService(redisRepo, idempotencyTTL)
+
+	// Variants, hashes and derived metadata of uploads are produced by background workers
+	if processingWorkers > 0 {
+		service.NewProcessingWorkerPool(redisRepo, uploaderSvc, processingWorkers).Start(context.Background())
+	} else {
+		log.Println("Processing workers disabled; uploads stay pending until another instance processes them")
+	}
 
 	// 4. Initialize Handler Layer (Transport Layer)
 	log.Println("Initializing Handler Layer...")
-	uploaderHandler := handler.NewUploaderHandler(uploaderSvc, service.NewAnalyticsClient("http://localhost:8082"))
+	analyticsClient := service.NewAnalyticsClient("http://localhost:8082")
+	uploaderHandler := handler.NewUploaderHandler(uploaderSvc, analyticsClient)
+	resumableHandler := handler.NewResumableUploadHandler(resumableSvc, analyticsClient)
+	idempotency := handler.NewIdempotencyMiddleware(idempotencySvc)
 
-	// 5. Configure Routes
+	// 5. Configure Routes; mutating endpoints honour Idempotency-Key
 	mux := http.NewServeMux()
 
 	// Photo upload endpoint
-	mux.HandleFunc("POST /api/upload", uploaderHandler.HandleUploadPhoto)
+	mux.HandleFunc("POST /api/upload", idempotency.Wrap(uploaderHandler.HandleUploadPhoto))
+
+	// Multi-file upload in one request
+	mux.HandleFunc("POST /api/upload/batch", idempotency.Wrap(uploaderHandler.HandleUploadBatch))
+	mux.HandleFunc("POST /api/upload/check", uploaderHandler.HandleCheckUploads)
+
+	// Resumable uploads (tus 1.0). PATCH and DELETE are left unwrapped: tus makes them safe to
+	// retry through Upload-Offset and HEAD, and chunk bodies must stream rather than be hashed
+	mux.HandleFunc("OPTIONS /api/upload/tus", resumableHandler.HandleOptions)
+	mux.HandleFunc("POST /api/upload/tus", idempotency.Wrap(resumableHandler.HandleCreate))
+	mux.HandleFunc("HEAD /api/upload/tus/{uploadId}", resumableHandler.HandleHead)
+	mux.HandleFunc("PATCH /api/upload/tus/{uploadId}", resumableHandler.HandlePatch)
+	mux.HandleFunc("DELETE /api/upload/tus/{uploadId}", resumableHandler.HandleTerminate)
 
 	// Get user's photos
 	mux.HandleFunc("GET /api/photos", uploaderHandler.HandleGetPhotosByUser)
 
+	// Edit photo title, description and alt text
+	mux.HandleFunc("PATCH /api/photos/{photoId}", idempotency.Wrap(uploaderHandler.HandleUpdatePhoto))
+
+	// Correct an inferred or missing capture date
+	mux.HandleFunc("PUT /api/photos/{photoId}/capture-date", idempotency.Wrap(uploaderHandler.HandleUpdateCaptureDate))
+
+	// Background processing state of an upload
+	mux.HandleFunc("GET /api/photos/{photoId}/status", uploaderHandler.HandleGetPhotoStatus)
+
+	// Delete photo with blob and cache cleanup
+	mux.HandleFunc("DELETE /api/photos/{photoId}", idempotency.Wrap(uploaderHandler.HandleDeletePhoto))
+
+	// Sharing and privacy of photos served to other users
+	mux.HandleFunc("PATCH /api/photos/{photoId}/privacy", idempotency.Wrap(uploaderHandler.HandleUpdatePhotoPrivacy))
+	mux.HandleFunc("GET /api/settings/privacy", uploaderHandler.HandleGetPrivacySettings)
+	mux.HandleFunc("PUT /api/settings/privacy", idempotency.Wrap(uploaderHandler.HandleUpdatePrivacySettings))
+
 	// Health check
 	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
@@ -0,0 +1,16 @@
+#!/bin/sh
+# Refreshes the vendored GeoNames snapshot (CC BY 4.0) used for offline reverse geocoding.
+# GeoNames rewrites its dumps daily, so the Docker image is built from the files committed
+# here and checked against SHA256SUMS rather than downloaded at build time. Run this from
+# any directory, review the diff and commit the files together.
+set -eu
+
+cd "$(dirname "$0")"
+base=https://download.geonames.org/export/dump
+for file in cities15000.zip admin1CodesASCII.txt countryInfo.txt; do
+	curl -fsSL -o "$file" "$base/$file"
+done
+sha256sum cities15000.zip admin1CodesASCII.txt countryInfo.txt > SHA256SUMS
+date -u +%Y-%m-%d > SNAPSHOT
+echo "GeoNames snapshot of $(cat SNAPSHOT):"
+cat SHA256SUMS
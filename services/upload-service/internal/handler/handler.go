@@ -3,9 +3,17 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log"
+	"mime/multipart"
 	"net/http"
+	"slices"
+	"strconv"
 
+	"seungpyolee.com/pkg/model"
+	"seungpyolee.com/pkg/shared"
 	"seungpyolee.com/services/upload-service/internal/service"
 )
 
@@ -22,8 +30,9 @@ func NewUploaderHandler(svc service.UploaderService, analyticsClient *service.An
 }
 
 // HandleUploadPhoto handles multipart form file uploads
-// Expected form fields: "file", "title", "description"
+// Expected form fields: "title", "description", "altText", then "file"
 // Expected header: "X-User-ID" for user identification
+// The file part is streamed to the service as it arrives, so fields after it are ignored.
 func (h *UploaderHandler) HandleUploadPhoto(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -37,36 +46,81 @@ func (h *UploaderHandler) HandleUploadPhoto(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	// Parse multipart form with 32MB max file size
-	if err := r.ParseMultipartForm(32 << 20); err != nil {
+	// Cap the body at 32MB plus form overhead; nothing is buffered beyond the form fields
+	r.Body = http.MaxBytesReader(w, r.Body, shared.MaxUploadFileSize+shared.MaxMultipartOverhead)
+	form, err := r.MultipartReader()
+	if err != nil {
 		http.Error(w, "Failed to parse form: "+err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Get file from form
-	file, fileHeader, err := r.FormFile("file")
-	if err != nil {
-		http.Error(w, "File not provided", http.StatusBadRequest)
-		return
+	// Collect the detail fields up to the file part
+	var details model.PhotoUploadRequest
+	var file *multipart.Part
+	for file == nil {
+		part, err := form.NextPart()
+		if err == io.EOF {
+			http.Error(w, "File not provided", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			writeFormError(w, err)
+			return
+		}
+		switch part.FormName() {
+		case "file":
+			file = part
+		case "title":
+			details.Title, err = readFormValue(part)
+		case "description":
+			details.Description, err = readFormValue(part)
+		case "altText":
+			details.AltText, err = readFormValue(part)
+		}
+		if err != nil {
+			writeFormError(w, err)
+			return
+		}
 	}
 	defer file.Close()
 
 	// Call service to upload
 	ctx := r.Context()
-	photoID, err := h.UploaderService.UploadPhoto(ctx, userID, fileHeader.Filename, file)
+	photoID, duplicate, err := h.UploaderService.UploadPhoto(ctx, userID, file.FileName(), details, file)
 	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, "File exceeds maximum upload size", http.StatusRequestEntityTooLarge)
+			return
+		}
+		if errors.Is(err, service.ErrInvalidPhotoDetails) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, service.ErrUnsupportedMediaType) {
+			http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+			return
+		}
 		log.Printf("[Handler] Upload failed: %v", err)
 		http.Error(w, "Failed to upload photo: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// Success response
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{
+	// Success response; a duplicate points at the photo already holding the same content.
+	// New photos are processed in the background, see GET /api/photos/{photoId}/status.
+	response := map[string]interface{}{
 		"photoId": photoID,
 		"message": "Photo uploaded successfully",
-	})
+		"status":  model.PhotoStatusPending,
+	}
+	if duplicate {
+		response["message"] = "Photo already uploaded"
+		response["duplicate"] = true
+		delete(response, "status")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
 
 	// Record API call to analytics (async)
 	if h.AnalyticsClient != nil {
@@ -74,7 +128,140 @@ func (h *UploaderHandler) HandleUploadPhoto(w http.ResponseWriter, r *http.Reque
 	}
 }
 
-// HandleGetPhotosByUser retrieves all photos for a user
+// readFormValue reads a text field of a streamed multipart form
+func readFormValue(part *multipart.Part) (string, error) {
+	value, err := io.ReadAll(io.LimitReader(part, shared.MaxMultipartOverhead+1))
+	if err != nil {
+		return "", err
+	}
+	if len(value) > shared.MaxMultipartOverhead {
+		return "", errFormFieldTooLarge
+	}
+	return string(value), nil
+}
+
+// errFormFieldTooLarge is returned by readFormValue for fields beyond MaxMultipartOverhead
+var errFormFieldTooLarge = errors.New("form field too large")
+
+// writeFormError reports a failure to read a streamed multipart form
+func writeFormError(w http.ResponseWriter, err error) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		http.Error(w, "File exceeds maximum upload size", http.StatusRequestEntityTooLarge)
+		return
+	}
+	http.Error(w, "Failed to parse form: "+err.Error(), http.StatusBadRequest)
+}
+
+// HandleUploadBatch handles multipart uploads of many files in one request
+// Expected form fields: one or more "files" (or "file") parts
+// Responds 200 with a per-file result array; individual failures do not fail the batch
+func (h *UploaderHandler) HandleUploadBatch(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("X-User-ID")
+	if userID == "" {
+		http.Error(w, "X-User-ID header is required", http.StatusUnauthorized)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, shared.MaxBatchUploadSize)
+	if err := r.ParseMultipartForm(shared.MultipartMemoryLimit); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, "Batch exceeds maximum upload size", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Failed to parse form: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fileHeaders := slices.Concat(r.MultipartForm.File["files"], r.MultipartForm.File["file"])
+	if len(fileHeaders) == 0 {
+		http.Error(w, "No files provided", http.StatusBadRequest)
+		return
+	}
+	if len(fileHeaders) > shared.MaxBatchUploadFiles {
+		http.Error(w, fmt.Sprintf("At most %d files can be uploaded per batch", shared.MaxBatchUploadFiles), http.StatusBadRequest)
+		return
+	}
+
+	files := make([]service.BatchFile, len(fileHeaders))
+	for i, fh := range fileHeaders {
+		files[i] = service.BatchFile{
+			FileName: fh.Filename,
+			Size:     fh.Size,
+			Open: func() (io.ReadCloser, error) {
+				return fh.Open()
+			},
+		}
+	}
+
+	ctx := r.Context()
+	results := h.UploaderService.UploadPhotos(ctx, userID, files)
+
+	uploaded, duplicates := 0, 0
+	for _, res := range results {
+		if res.PhotoID != "" {
+			uploaded++
+		}
+		if res.Duplicate {
+			duplicates++
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"results":    results,
+		"uploaded":   uploaded,
+		"duplicates": duplicates,
+		"failed":     len(results) - uploaded,
+	})
+
+	// Record API call to analytics (async)
+	if h.AnalyticsClient != nil {
+		h.AnalyticsClient.RecordAPICall("/api/upload/batch", userID)
+	}
+}
+
+// HandleCheckUploads reports which files, identified by the SHA-256 of their content, the user already uploaded
+// Body: {"hashes": ["<hex sha-256>", ...]}
+func (h *UploaderHandler) HandleCheckUploads(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("X-User-ID")
+	if userID == "" {
+		http.Error(w, "X-User-ID header is required", http.StatusUnauthorized)
+		return
+	}
+
+	var req model.UploadCheckRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 256<<10)).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	result, err := h.UploaderService.CheckUploads(ctx, userID, req.Hashes)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidChecksum) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("[Handler] Upload check failed: %v", err)
+		http.Error(w, "Failed to check uploads: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(result)
+
+	// Record API call to analytics (async)
+	if h.AnalyticsClient != nil {
+		h.AnalyticsClient.RecordAPICall("/api/upload/check", userID)
+	}
+}
+
+// HandleGetPhotosByUser retrieves a page of a user's photos, newest upload first
+// Query params: limit (page size), cursor (nextCursor of the previous page)
 func (h *UploaderHandler) HandleGetPhotosByUser(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -87,22 +274,227 @@ func (h *UploaderHandler) HandleGetPhotosByUser(w http.ResponseWriter, r *http.R
 		return
 	}
 
+	query := r.URL.Query()
+	limit := 0
+	if raw := query.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
 	ctx := r.Context()
-	photos, err := h.UploaderService.GetPhotosByUser(ctx, userID)
+	page, err := h.UploaderService.GetPhotosByUser(ctx, userID, query.Get("cursor"), limit)
+	if errors.Is(err, service.ErrInvalidPagination) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Failed to fetch photos: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(page)
+
+	// Record API call to analytics (async)
+	if h.AnalyticsClient != nil {
+		h.AnalyticsClient.RecordAPICall("/api/photos", userID)
+	}
+}
+
+// HandleGetPhotoStatus reports whether a photo's background processing has finished
+func (h *UploaderHandler) HandleGetPhotoStatus(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("X-User-ID")
+	if userID == "" {
+		http.Error(w, "X-User-ID header is required", http.StatusUnauthorized)
+		return
+	}
+
+	photoID := r.PathValue("photoId")
+	if photoID == "" {
+		http.Error(w, "Photo ID is required", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	status, err := h.UploaderService.GetPhotoStatus(ctx, userID, photoID)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrPhotoNotFound):
+			http.Error(w, "Photo not found", http.StatusNotFound)
+		case errors.Is(err, service.ErrPhotoForbidden):
+			http.Error(w, "Unauthorized", http.StatusForbidden)
+		default:
+			http.Error(w, "Failed to fetch photo status: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(status)
+
+	// Record API call to analytics (async)
+	if h.AnalyticsClient != nil {
+		h.AnalyticsClient.RecordAPICall("/api/photos/status", userID)
+	}
+}
+
+// HandleUpdatePhoto edits the title, description and alt text of a photo
+// Expected JSON body: {"title": "...", "description": "...", "altText": "..."} (all optional)
+func (h *UploaderHandler) HandleUpdatePhoto(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("X-User-ID")
+	if userID == "" {
+		http.Error(w, "X-User-ID header is required", http.StatusUnauthorized)
+		return
+	}
+
+	photoID := r.PathValue("photoId")
+	if photoID == "" {
+		http.Error(w, "Photo ID is required", http.StatusBadRequest)
+		return
+	}
+
+	var update model.PhotoUpdateRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&update); err != nil {
+		http.Error(w, "Invalid JSON body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	photo, err := h.UploaderService.UpdatePhotoDetails(ctx, userID, photoID, update)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidPhotoDetails):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, service.ErrPhotoNotFound):
+			http.Error(w, "Photo not found", http.StatusNotFound)
+		case errors.Is(err, service.ErrPhotoForbidden):
+			http.Error(w, "Unauthorized", http.StatusForbidden)
+		default:
+			log.Printf("[Handler] Update failed: %v", err)
+			http.Error(w, "Failed to update photo: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(photo)
+
+	// Record API call to analytics (async)
+	if h.AnalyticsClient != nil {
+		h.AnalyticsClient.RecordAPICall("/api/photos/update", userID)
+	}
+}
+
+// HandleUpdateCaptureDate corrects the capture date of a photo
+// Body: {"dateTime": "2024-01-02T15:04:05", "timeZone": "Asia/Seoul"}; dateTime may also be RFC 3339 or a date
+func (h *UploaderHandler) HandleUpdateCaptureDate(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("X-User-ID")
+	if userID == "" {
+		http.Error(w, "X-User-ID header is required", http.StatusUnauthorized)
+		return
+	}
+
+	photoID := r.PathValue("photoId")
+	if photoID == "" {
+		http.Error(w, "Photo ID is required", http.StatusBadRequest)
+		return
+	}
+
+	var req model.CaptureDateRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	photo, err := h.UploaderService.UpdateCaptureDate(ctx, userID, photoID, req)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidCaptureDate):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, service.ErrPhotoNotFound):
+			http.Error(w, "Photo not found", http.StatusNotFound)
+		case errors.Is(err, service.ErrPhotoForbidden):
+			http.Error(w, "Unauthorized", http.StatusForbidden)
+		case errors.Is(err, service.ErrPhotoProcessing):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			log.Printf("[Handler] Capture date update failed: %v", err)
+			http.Error(w, "Failed to update capture date: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(photo)
+
+	// Record API call to analytics (async)
+	if h.AnalyticsClient != nil {
+		h.AnalyticsClient.RecordAPICall("/api/photos/capture-date", userID)
+	}
+}
+
+// HandleDeletePhoto deletes a photo, its original and resized blobs, and its cache entries
+func (h *UploaderHandler) HandleDeletePhoto(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("X-User-ID")
+	if userID == "" {
+		http.Error(w, "X-User-ID header is required", http.StatusUnauthorized)
+		return
+	}
+
+	photoID := r.PathValue("photoId")
+	if photoID == "" {
+		http.Error(w, "Photo ID is required", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	result, err := h.UploaderService.DeletePhoto(ctx, userID, photoID)
+	switch {
+	case errors.Is(err, service.ErrPhotoNotFound):
+		http.Error(w, "Photo not found", http.StatusNotFound)
+		return
+	case errors.Is(err, service.ErrPhotoForbidden):
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	case errors.Is(err, service.ErrPartialDeletion):
+		// Some blobs remain; the document is kept so the client can retry
+		log.Printf("[Handler] Delete incomplete: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message": err.Error(),
+			"result":  result,
+		})
+		return
+	case err != nil:
+		log.Printf("[Handler] Delete failed: %v", err)
+		http.Error(w, "Failed to delete photo: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	message := "Photo deleted successfully"
+	if len(result.Failures) > 0 {
+		message = "Photo deleted; some cache entries could not be invalidated"
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"photos": photos,
-		"count":  len(photos),
+		"message": message,
+		"result":  result,
 	})
 
 	// Record API call to analytics (async)
 	if h.AnalyticsClient != nil {
-		h.AnalyticsClient.RecordAPICall("/api/photos", userID)
+		h.AnalyticsClient.RecordAPICall("/api/photos/delete", userID)
 	}
 }
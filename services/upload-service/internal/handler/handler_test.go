@@ -0,0 +1,121 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"seungpyolee.com/pkg/model"
+	"seungpyolee.com/pkg/shared"
+	"seungpyolee.com/services/upload-service/internal/service"
+)
+
+// stubUploaderService records the upload it received, reading the file as the service would
+type stubUploaderService struct {
+	service.UploaderService
+	fileName string
+	details  model.PhotoUploadRequest
+	size     int64
+}
+
+func (s *stubUploaderService) UploadPhoto(ctx context.Context, userID, fileName string, details model.PhotoUploadRequest, fileData io.Reader) (string, bool, error) {
+	s.fileName, s.details = fileName, details
+	n, err := io.Copy(io.Discard, fileData)
+	s.size = n
+	if err != nil {
+		return "", false, fmt.Errorf("failed to read file data: %w", err)
+	}
+	return "photo-1", false, nil
+}
+
+// formPart is one part of a multipart test body; parts with a file name hold size zero bytes
+type formPart struct {
+	name, value, fileName string
+	size                  int64
+}
+
+// multipartBody writes parts as a multipart form while the request body is read
+func multipartBody(parts []formPart) (io.Reader, string) {
+	pr, pw := io.Pipe()
+	form := multipart.NewWriter(pw)
+	go func() {
+		for _, p := range parts {
+			if p.fileName == "" {
+				form.WriteField(p.name, p.value)
+				continue
+			}
+			w, err := form.CreateFormFile(p.name, p.fileName)
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+			if _, err := io.Copy(w, io.LimitReader(zeroReader{}, p.size)); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+		pw.CloseWithError(form.Close())
+	}()
+	return pr, form.FormDataContentType()
+}
+
+// zeroReader yields zero bytes without allocating
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+func TestHandleUploadPhoto(t *testing.T) {
+	file := formPart{name: "file", fileName: "a.jpg", size: 1000}
+	tests := []struct {
+		name        string
+		parts       []formPart
+		wantStatus  int
+		wantDetails model.PhotoUploadRequest
+	}{
+		{"fields before file", []formPart{{name: "title", value: "Harbour"}, {name: "altText", value: "Boats"}, file},
+			http.StatusOK, model.PhotoUploadRequest{Title: "Harbour", AltText: "Boats"}},
+		{"fields after file are ignored", []formPart{{name: "description", value: "Evening"}, file, {name: "title", value: "Late"}},
+			http.StatusOK, model.PhotoUploadRequest{Description: "Evening"}},
+		{"unknown fields are skipped", []formPart{{name: "album", value: "2024"}, file}, http.StatusOK, model.PhotoUploadRequest{}},
+		{"no file", []formPart{{name: "title", value: "Harbour"}}, http.StatusBadRequest, model.PhotoUploadRequest{}},
+		{"oversized field", []formPart{{name: "title", value: strings.Repeat("a", shared.MaxMultipartOverhead+1)}, file},
+			http.StatusBadRequest, model.PhotoUploadRequest{}},
+		{"oversized file", []formPart{{name: "file", fileName: "a.jpg", size: shared.MaxUploadFileSize + shared.MaxMultipartOverhead}},
+			http.StatusRequestEntityTooLarge, model.PhotoUploadRequest{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &stubUploaderService{}
+			h := NewUploaderHandler(svc, nil)
+			body, contentType := multipartBody(tt.parts)
+			req := httptest.NewRequest(http.MethodPost, "/api/upload", body)
+			req.Header.Set("Content-Type", contentType)
+			req.Header.Set("X-User-ID", "user-1")
+			rec := httptest.NewRecorder()
+
+			h.HandleUploadPhoto(rec, req)
+			io.Copy(io.Discard, body) // Let the writer finish after an early response
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if svc.fileName != "a.jpg" || svc.size != file.size {
+				t.Fatalf("service received %q with %d bytes, want a.jpg with %d", svc.fileName, svc.size, file.size)
+			}
+			if svc.details != tt.wantDetails {
+				t.Fatalf("details = %+v, want %+v", svc.details, tt.wantDetails)
+			}
+		})
+	}
+}
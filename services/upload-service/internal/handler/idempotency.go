@@ -0,0 +1,259 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+
+	"seungpyolee.com/pkg/model"
+	"seungpyolee.com/pkg/shared"
+	"seungpyolee.com/services/upload-service/internal/service"
+)
+
+// maxIdempotentBodySize is the largest body that can be fingerprinted: a full batch upload
+const maxIdempotentBodySize = shared.MaxBatchUploadSize + shared.MaxMultipartOverhead
+
+// fingerprintHeaders are request headers that change what a request does and so are part of its fingerprint
+var fingerprintHeaders = []string{"Upload-Length", "Upload-Metadata"}
+
+// IdempotencyMiddleware makes mutating endpoints safe to retry. A request with an
+// Idempotency-Key header is processed once per key and user; retries with the same
+// payload get the first response back with "Idempotent-Replayed: true", and reusing a
+// key for a different payload, or while the first request runs, is answered with 409.
+type IdempotencyMiddleware struct {
+	IdempotencyService service.IdempotencyService
+}
+
+func NewIdempotencyMiddleware(svc service.IdempotencyService) *IdempotencyMiddleware {
+	return &IdempotencyMiddleware{
+		IdempotencyService: svc,
+	}
+}
+
+// Wrap applies the middleware to one handler
+func (m *IdempotencyMiddleware) Wrap(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		userID := r.Header.Get("X-User-ID")
+		// Without a key there is nothing to remember; without a user the handler rejects the request
+		if key == "" || userID == "" {
+			next(w, r)
+			return
+		}
+		if len(key) > shared.MaxIdempotencyKeyLength {
+			http.Error(w, fmt.Sprintf("Idempotency-Key must be at most %d characters", shared.MaxIdempotencyKeyLength), http.StatusBadRequest)
+			return
+		}
+
+		ctx := r.Context()
+		record, err := m.IdempotencyService.Begin(ctx, userID, key)
+		switch {
+		case errors.Is(err, service.ErrIdempotencyKeyInFlight):
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		case err != nil:
+			// Requests still go through without Redis, just without retry protection
+			log.Printf("[Handler] Idempotency check failed: %v (processing without it)", err)
+			next(w, r)
+			return
+		}
+
+		// The body is hashed as it streams to the handler; nothing is buffered
+		fingerprint := newBodyFingerprint(r)
+		limited := http.MaxBytesReader(w, r.Body, maxIdempotentBodySize)
+		body := io.TeeReader(limited, fingerprint)
+
+		if record != nil {
+			sum, err := fingerprint.finish(body)
+			if err != nil {
+				writeBodyError(w, err)
+				return
+			}
+			if err := m.IdempotencyService.Matches(record, sum); err != nil {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
+			log.Printf("[Handler] Replaying response for idempotency key of user %s", userID)
+			replayResponse(w, record)
+			return
+		}
+
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{body, limited}
+		// HTTP/1.x bodies cannot be read once the response has started, so whatever the handler
+		// left unread is hashed before its first write
+		rec := &responseRecorder{ResponseWriter: w, beforeWrite: func() { fingerprint.finish(body) }}
+		next(rec, r)
+		sum, err := fingerprint.finish(body)
+		if err != nil {
+			// Without the whole body a retry cannot be told apart from a different request
+			log.Printf("[Handler] Failed to fingerprint request of user %s: %v", userID, err)
+			m.IdempotencyService.Release(context.Background(), userID, key)
+			return
+		}
+		statusCode, header := rec.result()
+		m.IdempotencyService.Complete(context.Background(), userID, key, sum, statusCode, header, rec.body.Bytes())
+	}
+}
+
+// writeBodyError reports a request body that could not be read
+func writeBodyError(w http.ResponseWriter, err error) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		http.Error(w, "Request body exceeds maximum upload size", http.StatusRequestEntityTooLarge)
+		return
+	}
+	http.Error(w, "Failed to read request body: "+err.Error(), http.StatusBadRequest)
+}
+
+// replayResponse writes a stored response again
+func replayResponse(w http.ResponseWriter, record *model.IdempotencyRecord) {
+	for name, values := range record.Header {
+		w.Header()[name] = values
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(record.StatusCode)
+	w.Write(record.Body)
+}
+
+// bodyFingerprint hashes the method, path, query, significant headers and payload of a
+// request while its body is read by someone else; it is the writer side of a TeeReader.
+// Multipart bodies are hashed part by part because clients choose a new boundary on every retry.
+type bodyFingerprint struct {
+	pw      *io.PipeWriter
+	stopped bool
+	done    chan struct{}
+	sum     string
+	err     error
+}
+
+func newBodyFingerprint(r *http.Request) *bodyFingerprint {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %s?%s\n", r.Method, r.URL.Path, r.URL.RawQuery)
+	for _, name := range fingerprintHeaders {
+		fmt.Fprintf(h, "%s: %q\n", name, r.Header.Get(name))
+	}
+	mediaType, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	pr, pw := io.Pipe()
+	f := &bodyFingerprint{pw: pw, done: make(chan struct{})}
+	go func() {
+		defer close(f.done)
+		var err error
+		if mediaType == "multipart/form-data" && params["boundary"] != "" {
+			err = hashMultipart(h, multipart.NewReader(pr, params["boundary"]))
+		} else {
+			_, err = io.Copy(h, pr)
+		}
+		// Anything after the closing boundary is not part of the form
+		pr.Close()
+		if err != nil {
+			f.err = err
+			return
+		}
+		f.sum = hex.EncodeToString(h.Sum(nil))
+	}()
+	return f
+}
+
+// Write always reports success so a failed fingerprint never fails the handler's read
+func (f *bodyFingerprint) Write(p []byte) (int, error) {
+	if !f.stopped {
+		if _, err := f.pw.Write(p); err != nil {
+			f.stopped = true
+		}
+	}
+	return len(p), nil
+}
+
+// finish reads what is left of body, the TeeReader feeding f, and returns the fingerprint.
+// Later calls return the first result.
+func (f *bodyFingerprint) finish(body io.Reader) (string, error) {
+	select {
+	case <-f.done:
+		return f.sum, f.err
+	default:
+	}
+	_, err := io.Copy(io.Discard, body)
+	f.pw.CloseWithError(err)
+	<-f.done
+	if err != nil {
+		f.sum, f.err = "", err
+	}
+	return f.sum, f.err
+}
+
+// hashMultipart hashes the name, file name and content of each part in order
+func hashMultipart(h hash.Hash, mr *multipart.Reader) error {
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "part %q %q\n", part.FormName(), part.FileName())
+		n, err := io.Copy(h, part)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "\n%d\n", n)
+	}
+}
+
+// responseRecorder passes a response through while keeping a copy to store.
+// beforeWrite, if set, runs once before the response starts.
+type responseRecorder struct {
+	http.ResponseWriter
+	beforeWrite func()
+	statusCode  int
+	header      http.Header
+	body        bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(statusCode int) {
+	if r.statusCode == 0 {
+		if r.beforeWrite != nil {
+			r.beforeWrite()
+		}
+		r.statusCode = statusCode
+		r.header = snapshotHeader(r.ResponseWriter.Header())
+	}
+	r.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (r *responseRecorder) Write(p []byte) (int, error) {
+	if r.statusCode == 0 {
+		r.WriteHeader(http.StatusOK)
+	}
+	r.body.Write(p)
+	return r.ResponseWriter.Write(p)
+}
+
+// result returns the status and headers sent, as net/http defaults them when nothing was written
+func (r *responseRecorder) result() (int, http.Header) {
+	if r.statusCode == 0 {
+		return http.StatusOK, snapshotHeader(r.ResponseWriter.Header())
+	}
+	return r.statusCode, r.header
+}
+
+// snapshotHeader copies response headers, leaving out those the server sets per response
+func snapshotHeader(header http.Header) http.Header {
+	snapshot := header.Clone()
+	snapshot.Del("Date")
+	snapshot.Del("Content-Length")
+	return snapshot
+}
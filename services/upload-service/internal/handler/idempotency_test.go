@@ -0,0 +1,224 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"seungpyolee.com/pkg/model"
+	"seungpyolee.com/services/upload-service/internal/repository"
+	"seungpyolee.com/services/upload-service/internal/service"
+)
+
+// fakeIdempotencyStore keeps idempotency records in memory like Redis would
+type fakeIdempotencyStore struct {
+	repository.RedisRepository
+	mu      sync.Mutex
+	records map[string]model.IdempotencyRecord
+}
+
+func (f *fakeIdempotencyStore) ReserveIdempotencyKey(ctx context.Context, userID, key string, record *model.IdempotencyRecord, ttl time.Duration) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.records[userID+":"+key]; ok {
+		return false, nil
+	}
+	f.records[userID+":"+key] = *record
+	return true, nil
+}
+
+func (f *fakeIdempotencyStore) GetIdempotencyRecord(ctx context.Context, userID, key string) (*model.IdempotencyRecord, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	record, ok := f.records[userID+":"+key]
+	if !ok {
+		return nil, nil
+	}
+	return &record, nil
+}
+
+func (f *fakeIdempotencyStore) SetIdempotencyRecord(ctx context.Context, userID, key string, record *model.IdempotencyRecord, ttl time.Duration) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.records[userID+":"+key] = *record
+	return nil
+}
+
+func (f *fakeIdempotencyStore) DeleteIdempotencyRecord(ctx context.Context, userID, key string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.records, userID+":"+key)
+	return nil
+}
+
+// idempotentHandler wraps a handler that counts its calls and answers with the call number
+// and the body it read, or with status when it is set
+type idempotentHandler struct {
+	wrapped  http.HandlerFunc
+	calls    int
+	status   int
+	readBody bool
+	during   func() // Runs inside the handler, while its key is in flight
+}
+
+func newIdempotentHandler() *idempotentHandler {
+	h := &idempotentHandler{readBody: true}
+	m := NewIdempotencyMiddleware(service.NewIdempotencyService(&fakeIdempotencyStore{records: map[string]model.IdempotencyRecord{}}, time.Hour))
+	h.wrapped = m.Wrap(func(w http.ResponseWriter, r *http.Request) {
+		h.calls++
+		if h.during != nil {
+			h.during()
+		}
+		var n int64
+		if h.readBody {
+			n, _ = io.Copy(io.Discard, r.Body)
+		}
+		if h.status != 0 {
+			http.Error(w, "failed", h.status)
+			return
+		}
+		fmt.Fprintf(w, "call %d read %d", h.calls, n)
+	})
+	return h
+}
+
+func (h *idempotentHandler) send(key, contentType string, body io.Reader) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/upload", body)
+	req.Header.Set("X-User-ID", "user-1")
+	req.Header.Set("Idempotency-Key", key)
+	req.Header.Set("Content-Type", contentType)
+	rec := httptest.NewRecorder()
+	h.wrapped(rec, req)
+	return rec
+}
+
+func (h *idempotentHandler) sendJSON(key, body string) *httptest.ResponseRecorder {
+	return h.send(key, "application/json", strings.NewReader(body))
+}
+
+// sendForm sends a title field and a file part encoded with the given boundary
+func (h *idempotentHandler) sendForm(t *testing.T, key, boundary, content string) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	form := multipart.NewWriter(&buf)
+	if err := form.SetBoundary(boundary); err != nil {
+		t.Fatal(err)
+	}
+	form.WriteField("title", "Harbour")
+	part, _ := form.CreateFormFile("file", "a.jpg")
+	io.WriteString(part, content)
+	form.Close()
+	return h.send(key, form.FormDataContentType(), &buf)
+}
+
+func TestIdempotencyReplaysSamePayload(t *testing.T) {
+	h := newIdempotentHandler()
+	first := h.sendJSON("key-1", `{"title":"Harbour"}`)
+	retry := h.sendJSON("key-1", `{"title":"Harbour"}`)
+
+	if h.calls != 1 {
+		t.Fatalf("handler ran %d times, want 1", h.calls)
+	}
+	if retry.Code != first.Code || retry.Body.String() != first.Body.String() {
+		t.Fatalf("retry got %d %q, want %d %q", retry.Code, retry.Body, first.Code, first.Body)
+	}
+	if retry.Header().Get("Idempotent-Replayed") != "true" || first.Header().Get("Idempotent-Replayed") != "" {
+		t.Fatalf("Idempotent-Replayed = %q on the retry and %q on the first response", retry.Header().Get("Idempotent-Replayed"), first.Header().Get("Idempotent-Replayed"))
+	}
+	if other := h.sendJSON("key-2", `{"title":"Harbour"}`); other.Header().Get("Idempotent-Replayed") != "" || h.calls != 2 {
+		t.Fatalf("a new key was replayed")
+	}
+}
+
+func TestIdempotencyRejectsDifferentPayload(t *testing.T) {
+	h := newIdempotentHandler()
+	h.sendJSON("key-1", `{"title":"Harbour"}`)
+	if rec := h.sendJSON("key-1", `{"title":"Beach"}`); rec.Code != http.StatusConflict {
+		t.Fatalf("different payload got %d, want 409", rec.Code)
+	}
+
+	// The body is fingerprinted in full even when the handler reads none of it
+	h = newIdempotentHandler()
+	h.readBody = false
+	h.sendJSON("key-1", `{"title":"Harbour"}`)
+	if rec := h.sendJSON("key-1", `{"title":"Beach"}`); rec.Code != http.StatusConflict {
+		t.Fatalf("different unread payload got %d, want 409", rec.Code)
+	}
+	if h.calls != 1 {
+		t.Fatalf("handler ran %d times, want 1", h.calls)
+	}
+}
+
+func TestIdempotencyRejectsRetryInFlight(t *testing.T) {
+	h := newIdempotentHandler()
+	var concurrent *httptest.ResponseRecorder
+	h.during = func() {
+		h.during = nil
+		concurrent = h.sendJSON("key-1", `{"title":"Harbour"}`)
+	}
+	first := h.sendJSON("key-1", `{"title":"Harbour"}`)
+
+	if concurrent.Code != http.StatusConflict {
+		t.Fatalf("retry while in flight got %d, want 409", concurrent.Code)
+	}
+	if first.Code != http.StatusOK || h.calls != 1 {
+		t.Fatalf("first request got %d after %d calls", first.Code, h.calls)
+	}
+}
+
+func TestIdempotencyReleasesKeyAfterServerError(t *testing.T) {
+	h := newIdempotentHandler()
+	h.status = http.StatusInternalServerError
+	if rec := h.sendJSON("key-1", `{"title":"Harbour"}`); rec.Code != http.StatusInternalServerError {
+		t.Fatalf("first request got %d", rec.Code)
+	}
+	h.status = 0
+	retry := h.sendJSON("key-1", `{"title":"Harbour"}`)
+	if retry.Code != http.StatusOK || retry.Header().Get("Idempotent-Replayed") != "" || h.calls != 2 {
+		t.Fatalf("retry after a server error got %d, replayed %q, calls %d", retry.Code, retry.Header().Get("Idempotent-Replayed"), h.calls)
+	}
+
+	// Client errors are stored like successes
+	h.status = http.StatusBadRequest
+	h.sendJSON("key-2", `{}`)
+	if retry := h.sendJSON("key-2", `{}`); retry.Code != http.StatusBadRequest || retry.Header().Get("Idempotent-Replayed") != "true" {
+		t.Fatalf("retry after a client error got %d, replayed %q", retry.Code, retry.Header().Get("Idempotent-Replayed"))
+	}
+}
+
+func TestIdempotencyFingerprintIgnoresBoundary(t *testing.T) {
+	h := newIdempotentHandler()
+	first := h.sendForm(t, "key-1", "boundary-first", "jpeg bytes")
+	retry := h.sendForm(t, "key-1", "boundary-retry", "jpeg bytes")
+	if retry.Code != http.StatusOK || retry.Header().Get("Idempotent-Replayed") != "true" || retry.Body.String() != first.Body.String() {
+		t.Fatalf("retry with a new boundary got %d, replayed %q", retry.Code, retry.Header().Get("Idempotent-Replayed"))
+	}
+	if changed := h.sendForm(t, "key-1", "boundary-retry", "other bytes"); changed.Code != http.StatusConflict {
+		t.Fatalf("retry with a different file got %d, want 409", changed.Code)
+	}
+}
+
+func TestIdempotencyStreamsBody(t *testing.T) {
+	h := newIdempotentHandler()
+	const size = 64 << 20
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	rec := h.send("key-1", "application/octet-stream", io.LimitReader(zeroReader{}, size))
+	runtime.ReadMemStats(&after)
+
+	if want := fmt.Sprintf("call 1 read %d", size); rec.Body.String() != want {
+		t.Fatalf("response = %q, want %q", rec.Body, want)
+	}
+	// A spooled or buffered body would allocate at least its size
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > size/8 {
+		t.Fatalf("fingerprinting a %d MB body allocated %d bytes", size>>20, allocated)
+	}
+}
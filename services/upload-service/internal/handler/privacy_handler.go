@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"seungpyolee.com/pkg/model"
+	"seungpyolee.com/services/upload-service/internal/service"
+)
+
+// HandleUpdatePhotoPrivacy shares or unshares a photo and sets its privacy override
+// Body: {"shared": true, "privacyMode": "strip_all"}; an empty privacyMode follows the user's setting
+func (h *UploaderHandler) HandleUpdatePhotoPrivacy(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("X-User-ID")
+	if userID == "" {
+		http.Error(w, "X-User-ID header is required", http.StatusUnauthorized)
+		return
+	}
+
+	photoID := r.PathValue("photoId")
+	if photoID == "" {
+		http.Error(w, "Photo ID is required", http.StatusBadRequest)
+		return
+	}
+
+	var update model.PhotoPrivacyRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&update); err != nil {
+		http.Error(w, "Invalid JSON body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	photo, err := h.UploaderService.UpdatePhotoPrivacy(ctx, userID, photoID, update)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidPrivacySettings):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, service.ErrPhotoNotFound):
+			http.Error(w, "Photo not found", http.StatusNotFound)
+		case errors.Is(err, service.ErrPhotoForbidden):
+			http.Error(w, "Unauthorized", http.StatusForbidden)
+		case errors.Is(err, service.ErrPhotoProcessing):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			log.Printf("[Handler] Privacy update failed: %v", err)
+			http.Error(w, "Failed to update photo privacy: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(photo)
+
+	// Record API call to analytics (async)
+	if h.AnalyticsClient != nil {
+		h.AnalyticsClient.RecordAPICall("/api/photos/privacy", userID)
+	}
+}
+
+// HandleGetPrivacySettings returns the user's default privacy mode for shared photos
+func (h *UploaderHandler) HandleGetPrivacySettings(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("X-User-ID")
+	if userID == "" {
+		http.Error(w, "X-User-ID header is required", http.StatusUnauthorized)
+		return
+	}
+
+	settings, err := h.UploaderService.GetPrivacySettings(r.Context(), userID)
+	if err != nil {
+		log.Printf("[Handler] Failed to get privacy settings: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(settings)
+}
+
+// HandleUpdatePrivacySettings changes the user's default privacy mode
+// Body: {"privacyMode": "none" | "strip_gps" | "strip_all"}
+func (h *UploaderHandler) HandleUpdatePrivacySettings(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("X-User-ID")
+	if userID == "" {
+		http.Error(w, "X-User-ID header is required", http.StatusUnauthorized)
+		return
+	}
+
+	var req model.PrivacySettings
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	settings, err := h.UploaderService.UpdatePrivacySettings(r.Context(), userID, req.PrivacyMode)
+	if errors.Is(err, service.ErrInvalidPrivacySettings) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("[Handler] Failed to update privacy settings: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(settings)
+
+	// Record API call to analytics (async)
+	if h.AnalyticsClient != nil {
+		h.AnalyticsClient.RecordAPICall("/api/settings/privacy", userID)
+	}
+}
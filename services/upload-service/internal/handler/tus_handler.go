@@ -0,0 +1,228 @@
+package handler
+
+import (
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"seungpyolee.com/pkg/model"
+	"seungpyolee.com/pkg/shared"
+	"seungpyolee.com/services/upload-service/internal/service"
+)
+
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,termination,expiration"
+	tusBasePath   = "/api/upload/tus/"
+)
+
+// ResumableUploadHandler serves the tus 1.0 resumable upload protocol
+// See https://tus.io/protocols/resumable-upload
+type ResumableUploadHandler struct {
+	ResumableService service.ResumableUploadService
+	AnalyticsClient  *service.AnalyticsClient
+}
+
+func NewResumableUploadHandler(svc service.ResumableUploadService, analyticsClient *service.AnalyticsClient) *ResumableUploadHandler {
+	return &ResumableUploadHandler{
+		ResumableService: svc,
+		AnalyticsClient:  analyticsClient,
+	}
+}
+
+// HandleOptions advertises the supported tus version, extensions and maximum size
+func (h *ResumableUploadHandler) HandleOptions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Tus-Version", tusVersion)
+	w.Header().Set("Tus-Extension", tusExtensions)
+	w.Header().Set("Tus-Max-Size", strconv.FormatInt(shared.MaxUploadFileSize, 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleCreate creates a new upload (creation extension)
+// Expected headers: "Upload-Length", "Upload-Metadata" with filename and optional title, description, altText
+func (h *ResumableUploadHandler) HandleCreate(w http.ResponseWriter, r *http.Request) {
+	userID, ok := tusPreamble(w, r)
+	if !ok {
+		return
+	}
+
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil {
+		http.Error(w, "Upload-Length header is required", http.StatusBadRequest)
+		return
+	}
+
+	metadata, err := parseUploadMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		http.Error(w, "Invalid Upload-Metadata: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	details := model.PhotoUploadRequest{
+		Title:       metadata["title"],
+		Description: metadata["description"],
+		AltText:     metadata["altText"],
+	}
+
+	ctx := r.Context()
+	upload, err := h.ResumableService.CreateUpload(ctx, userID, length, metadata["filename"], details)
+	if err != nil {
+		writeTusError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", tusBasePath+upload.UploadID)
+	w.Header().Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	w.WriteHeader(http.StatusCreated)
+
+	// Record API call to analytics (async)
+	if h.AnalyticsClient != nil {
+		h.AnalyticsClient.RecordAPICall("/api/upload/tus", userID)
+	}
+}
+
+// HandleHead reports the current offset of an upload
+func (h *ResumableUploadHandler) HandleHead(w http.ResponseWriter, r *http.Request) {
+	userID, ok := tusPreamble(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	upload, err := h.ResumableService.GetUpload(ctx, userID, r.PathValue("uploadId"))
+	if err != nil {
+		writeTusError(w, err)
+		return
+	}
+
+	writeUploadState(w, upload)
+	w.Header().Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandlePatch appends a chunk at the offset given by "Upload-Offset"
+func (h *ResumableUploadHandler) HandlePatch(w http.ResponseWriter, r *http.Request) {
+	userID, ok := tusPreamble(w, r)
+	if !ok {
+		return
+	}
+
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		http.Error(w, "Content-Type must be application/offset+octet-stream", http.StatusUnsupportedMediaType)
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		http.Error(w, "Upload-Offset header is required", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	upload, err := h.ResumableService.AppendChunk(ctx, userID, r.PathValue("uploadId"), offset, r.Body)
+	if err != nil {
+		if upload != nil {
+			writeUploadState(w, upload)
+		}
+		writeTusError(w, err)
+		return
+	}
+
+	writeUploadState(w, upload)
+	w.WriteHeader(http.StatusNoContent)
+
+	// Record API call to analytics (async)
+	if h.AnalyticsClient != nil && upload.PhotoID != "" {
+		h.AnalyticsClient.RecordAPICall("/api/upload/tus", userID)
+	}
+}
+
+// HandleTerminate discards an upload (termination extension)
+func (h *ResumableUploadHandler) HandleTerminate(w http.ResponseWriter, r *http.Request) {
+	userID, ok := tusPreamble(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	if err := h.ResumableService.TerminateUpload(ctx, userID, r.PathValue("uploadId")); err != nil {
+		writeTusError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// tusPreamble checks the user and protocol version headers common to every tus request
+func tusPreamble(w http.ResponseWriter, r *http.Request) (string, bool) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+
+	userID := r.Header.Get("X-User-ID")
+	if userID == "" {
+		http.Error(w, "X-User-ID header is required", http.StatusUnauthorized)
+		return "", false
+	}
+	if r.Header.Get("Tus-Resumable") != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		http.Error(w, "Unsupported tus version", http.StatusPreconditionFailed)
+		return "", false
+	}
+	return userID, true
+}
+
+// writeUploadState sets the offset, expiry and (once processed) photo ID and duplicate headers
+func writeUploadState(w http.ResponseWriter, upload *model.ResumableUpload) {
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	w.Header().Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	if upload.PhotoID != "" {
+		w.Header().Set("X-Photo-ID", upload.PhotoID)
+	}
+	if upload.Duplicate {
+		w.Header().Set("X-Photo-Duplicate", "true")
+	}
+}
+
+// writeTusError maps service errors to the status codes defined by the tus protocol
+func writeTusError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidPhotoDetails):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, service.ErrUnsupportedMediaType):
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+	case errors.Is(err, service.ErrUploadNotFound):
+		http.Error(w, "Upload not found", http.StatusNotFound)
+	case errors.Is(err, service.ErrUploadForbidden):
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+	case errors.Is(err, service.ErrUploadOffsetMismatch):
+		http.Error(w, "Upload-Offset does not match current offset", http.StatusConflict)
+	case errors.Is(err, service.ErrUploadLocked):
+		http.Error(w, "Upload is in use by another request", http.StatusLocked)
+	case errors.Is(err, service.ErrUploadTooLarge):
+		http.Error(w, "Upload exceeds allowed size", http.StatusRequestEntityTooLarge)
+	default:
+		log.Printf("[Handler] Resumable upload failed: %v", err)
+		http.Error(w, "Failed to process upload: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// parseUploadMetadata decodes "key base64value,key2 base64value2"; values may be omitted
+func parseUploadMetadata(header string) (map[string]string, error) {
+	metadata := map[string]string{}
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+	for _, pair := range strings.Split(header, ",") {
+		key, encoded, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, errors.New("empty key")
+		}
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, errors.New("value of " + key + " is not valid base64")
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
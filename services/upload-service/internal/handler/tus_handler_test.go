@@ -0,0 +1,189 @@
+package handler
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"seungpyolee.com/pkg/model"
+	"seungpyolee.com/services/upload-service/internal/service"
+)
+
+func TestParseUploadMetadata(t *testing.T) {
+	b64 := func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) }
+
+	tests := []struct {
+		name    string
+		header  string
+		want    map[string]string
+		wantErr bool
+	}{
+		{"empty header", "", map[string]string{}, false},
+		{"blank header", "   ", map[string]string{}, false},
+		{"single pair", "filename " + b64("a.jpg"), map[string]string{"filename": "a.jpg"}, false},
+		{"several pairs with spaces", "filename " + b64("a.jpg") + ", title " + b64("Sunset over Busan"),
+			map[string]string{"filename": "a.jpg", "title": "Sunset over Busan"}, false},
+		{"key without value", "filename " + b64("a.jpg") + ",is_confidential",
+			map[string]string{"filename": "a.jpg", "is_confidential": ""}, false},
+		{"utf-8 value", "title " + b64("서울 야경"), map[string]string{"title": "서울 야경"}, false},
+		{"value with a space", "filename a b", nil, true},
+		{"empty pair", "filename " + b64("a.jpg") + ",,", nil, true},
+		{"invalid base64", "filename not-base64!", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseUploadMetadata(tt.header)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseUploadMetadata(%q) error = %v, wantErr %v", tt.header, err, tt.wantErr)
+			}
+			if !tt.wantErr && !maps.Equal(got, tt.want) {
+				t.Fatalf("parseUploadMetadata(%q) = %v, want %v", tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
+// stubResumableService returns a fixed upload state and error and records the PATCH it received
+type stubResumableService struct {
+	service.ResumableUploadService
+	upload     *model.ResumableUpload
+	err        error
+	offset     int64
+	body       string
+	terminated string
+}
+
+func (s *stubResumableService) GetUpload(ctx context.Context, userID, uploadID string) (*model.ResumableUpload, error) {
+	return s.upload, s.err
+}
+
+func (s *stubResumableService) AppendChunk(ctx context.Context, userID, uploadID string, offset int64, chunk io.Reader) (*model.ResumableUpload, error) {
+	data, _ := io.ReadAll(chunk)
+	s.offset, s.body = offset, string(data)
+	return s.upload, s.err
+}
+
+func (s *stubResumableService) TerminateUpload(ctx context.Context, userID, uploadID string) error {
+	s.terminated = uploadID
+	return s.err
+}
+
+// serveTus routes one request through the tus endpoints as main.go registers them
+func serveTus(svc service.ResumableUploadService, method, offset, contentType, body string) *httptest.ResponseRecorder {
+	h := NewResumableUploadHandler(svc, nil)
+	mux := http.NewServeMux()
+	mux.HandleFunc("HEAD /api/upload/tus/{uploadId}", h.HandleHead)
+	mux.HandleFunc("PATCH /api/upload/tus/{uploadId}", h.HandlePatch)
+	mux.HandleFunc("DELETE /api/upload/tus/{uploadId}", h.HandleTerminate)
+
+	req := httptest.NewRequest(method, "/api/upload/tus/upload-1", strings.NewReader(body))
+	req.Header.Set("X-User-ID", "user-1")
+	req.Header.Set("Tus-Resumable", tusVersion)
+	if offset != "" {
+		req.Header.Set("Upload-Offset", offset)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHandlePatch(t *testing.T) {
+	const chunkType = "application/offset+octet-stream"
+	expires := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	state := func(offset int64, photoID string) *model.ResumableUpload {
+		return &model.ResumableUpload{UploadID: "upload-1", Length: 10, Offset: offset, PhotoID: photoID, ExpiresAt: expires}
+	}
+
+	tests := []struct {
+		name        string
+		svc         *stubResumableService
+		offset      string
+		contentType string
+		wantStatus  int
+		wantOffset  string
+		wantPhotoID string
+	}{
+		{"chunk staged", &stubResumableService{upload: state(6, "")}, "0", chunkType, http.StatusNoContent, "6", ""},
+		{"upload completed", &stubResumableService{upload: state(10, "photo-1")}, "6", chunkType, http.StatusNoContent, "10", "photo-1"},
+		{"offset mismatch reports the current offset", &stubResumableService{upload: state(6, ""), err: service.ErrUploadOffsetMismatch}, "0", chunkType, http.StatusConflict, "6", ""},
+		{"interrupted chunk reports progress", &stubResumableService{upload: state(8, ""), err: io.ErrUnexpectedEOF}, "6", chunkType, http.StatusInternalServerError, "8", ""},
+		{"rejected content", &stubResumableService{upload: state(10, ""), err: service.ErrUnsupportedMediaType}, "6", chunkType, http.StatusUnsupportedMediaType, "10", ""},
+		{"extra bytes", &stubResumableService{upload: state(10, ""), err: service.ErrUploadTooLarge}, "6", chunkType, http.StatusRequestEntityTooLarge, "10", ""},
+		{"locked", &stubResumableService{err: service.ErrUploadLocked}, "6", chunkType, http.StatusLocked, "", ""},
+		{"unknown upload", &stubResumableService{err: service.ErrUploadNotFound}, "0", chunkType, http.StatusNotFound, "", ""},
+		{"another user's upload", &stubResumableService{err: service.ErrUploadForbidden}, "0", chunkType, http.StatusForbidden, "", ""},
+		{"wrong content type", &stubResumableService{}, "0", "application/octet-stream", http.StatusUnsupportedMediaType, "", ""},
+		{"missing offset", &stubResumableService{}, "", chunkType, http.StatusBadRequest, "", ""},
+		{"negative offset", &stubResumableService{}, "-1", chunkType, http.StatusBadRequest, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serveTus(tt.svc, http.MethodPatch, tt.offset, tt.contentType, "chunk")
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if got := rec.Header().Get("Upload-Offset"); got != tt.wantOffset {
+				t.Fatalf("Upload-Offset = %q, want %q", got, tt.wantOffset)
+			}
+			if got := rec.Header().Get("X-Photo-ID"); got != tt.wantPhotoID {
+				t.Fatalf("X-Photo-ID = %q, want %q", got, tt.wantPhotoID)
+			}
+			if rec.Header().Get("Tus-Resumable") != tusVersion {
+				t.Fatalf("Tus-Resumable header missing")
+			}
+			if tt.wantStatus == http.StatusNoContent && (tt.svc.body != "chunk" || strconv.FormatInt(tt.svc.offset, 10) != tt.offset) {
+				t.Fatalf("service received offset %d, body %q", tt.svc.offset, tt.svc.body)
+			}
+		})
+	}
+}
+
+func TestHandleHead(t *testing.T) {
+	svc := &stubResumableService{upload: &model.ResumableUpload{UploadID: "upload-1", Length: 10, Offset: 4, ExpiresAt: time.Now().Add(time.Hour)}}
+	rec := serveTus(svc, http.MethodHead, "", "", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	if rec.Header().Get("Upload-Offset") != "4" || rec.Header().Get("Upload-Length") != "10" || rec.Header().Get("Cache-Control") != "no-store" {
+		t.Fatalf("headers = %v", rec.Header())
+	}
+
+	rec = serveTus(&stubResumableService{err: service.ErrUploadNotFound}, http.MethodHead, "", "", "")
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("unknown upload: status = %d, want 404", rec.Code)
+	}
+}
+
+func TestHandleTerminate(t *testing.T) {
+	svc := &stubResumableService{}
+	if rec := serveTus(svc, http.MethodDelete, "", "", ""); rec.Code != http.StatusNoContent || svc.terminated != "upload-1" {
+		t.Fatalf("status = %d, terminated %q; want 204, upload-1", rec.Code, svc.terminated)
+	}
+	if rec := serveTus(&stubResumableService{err: service.ErrUploadNotFound}, http.MethodDelete, "", "", ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("unknown upload: status = %d, want 404", rec.Code)
+	}
+	if rec := serveTus(&stubResumableService{err: service.ErrUploadLocked}, http.MethodDelete, "", "", ""); rec.Code != http.StatusLocked {
+		t.Fatalf("locked upload: status = %d, want 423", rec.Code)
+	}
+}
+
+func TestTusVersionRequired(t *testing.T) {
+	h := NewResumableUploadHandler(&stubResumableService{}, nil)
+	req := httptest.NewRequest(http.MethodHead, "/api/upload/tus/upload-1", nil)
+	req.Header.Set("X-User-ID", "user-1")
+	rec := httptest.NewRecorder()
+	h.HandleHead(rec, req)
+	if rec.Code != http.StatusPreconditionFailed || rec.Header().Get("Tus-Version") != tusVersion {
+		t.Fatalf("status = %d, Tus-Version %q; want 412, %s", rec.Code, rec.Header().Get("Tus-Version"), tusVersion)
+	}
+}
@@ -3,16 +3,35 @@ package repository
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"sync"
 	"time"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blockblob"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
 )
 
+// stageBlockSize is the size of each block staged by UploadBlobStream
+const stageBlockSize = 4 << 20
+
+// blockBufferPool reuses block buffers across concurrent uploads
+var blockBufferPool = sync.Pool{
+	New: func() any {
+		buf := make([]byte, stageBlockSize)
+		return &buf
+	},
+}
+
+// ErrBlobNotFound is returned by DeleteBlob when the blob does not exist
+var ErrBlobNotFound = errors.New("blob not found")
+
 type AzureBlobRepositoryImpl struct {
 	client        *azblob.Client
 	containerName string
@@ -45,36 +64,103 @@ func NewAzureBlobRepository(connectionString, containerName string) (*AzureBlobR
 
 // UploadBlob uploads a file to Azure Blob Storage and returns the blob URL
 func (r *AzureBlobRepositoryImpl) UploadBlob(ctx context.Context, blobName string, fileData io.Reader, contentType string) (string, error) {
-	containerClient := r.client.ServiceClient().NewContainerClient(r.containerName)
-	blockBlobClient := containerClient.NewBlockBlobClient(blobName)
-	fileBytes, err := io.ReadAll(fileData)
+	blobURL, _, err := r.UploadBlobStream(ctx, blobName, fileData, contentType)
+	return blobURL, err
+}
+
+// UploadBlobStream uploads a file by staging fixed-size blocks as data arrives and
+// committing the block list at the end, so at most one block is held in memory.
+// Returns the blob URL and the number of bytes uploaded.
+func (r *AzureBlobRepositoryImpl) UploadBlobStream(ctx context.Context, blobName string, fileData io.Reader, contentType string) (string, int64, error) {
+	blockIDs, size, err := r.StageBlocks(ctx, blobName, 0, fileData)
 	if err != nil {
-		return "", fmt.Errorf("failed to read file data: %w", err)
+		return "", size, err
 	}
+	blobURL, err := r.CommitBlocks(ctx, blobName, blockIDs, contentType)
+	if err != nil {
+		return "", size, err
+	}
+	return blobURL, size, nil
+}
 
-	// Upload blob - Azure SDK requires ReadSeekCloser
-	uploadOptions := &blockblob.UploadOptions{}
+// StageBlocks reads fileData in fixed-size blocks and stages each one as an uncommitted
+// block of blobName, numbering block IDs from firstBlock. The IDs and byte count of the
+// blocks staged before any error are always returned, so callers can resume from there.
+func (r *AzureBlobRepositoryImpl) StageBlocks(ctx context.Context, blobName string, firstBlock int, fileData io.Reader) ([]string, int64, error) {
+	containerClient := r.client.ServiceClient().NewContainerClient(r.containerName)
+	blockBlobClient := containerClient.NewBlockBlobClient(blobName)
 
-	// bytes.Reader implements Read and Seek, wrap with NopCloser for Close method
-	fileReader := &readSeekCloser{Reader: bytes.NewReader(fileBytes)}
+	bufPtr := blockBufferPool.Get().(*[]byte)
+	defer blockBufferPool.Put(bufPtr)
+	buf := *bufPtr
+
+	var blockIDs []string
+	var size int64
+	for {
+		n, readErr := io.ReadFull(fileData, buf)
+		if n > 0 {
+			index := firstBlock + len(blockIDs)
+			blockID := stageBlockID(index)
+			// bytes.Reader implements Read and Seek, wrap with NopCloser for Close method
+			block := &readSeekCloser{Reader: bytes.NewReader(buf[:n])}
+			if _, err := blockBlobClient.StageBlock(ctx, blockID, block, nil); err != nil {
+				return blockIDs, size, fmt.Errorf("failed to stage block %d of blob %s: %w", index, blobName, err)
+			}
+			blockIDs = append(blockIDs, blockID)
+			size += int64(n)
+		}
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			return blockIDs, size, nil
+		}
+		if readErr != nil {
+			return blockIDs, size, fmt.Errorf("failed to read file data: %w", readErr)
+		}
+	}
+}
 
-	_, err = blockBlobClient.Upload(ctx, fileReader, uploadOptions)
-	if err != nil {
-		return "", fmt.Errorf("failed to upload blob %s: %w", blobName, err)
+// CommitBlocks commits previously staged blocks, in order, as the content of blobName
+func (r *AzureBlobRepositoryImpl) CommitBlocks(ctx context.Context, blobName string, blockIDs []string, contentType string) (string, error) {
+	containerClient := r.client.ServiceClient().NewContainerClient(r.containerName)
+	blockBlobClient := containerClient.NewBlockBlobClient(blobName)
+
+	commitOptions := &blockblob.CommitBlockListOptions{
+		HTTPHeaders: &blob.HTTPHeaders{BlobContentType: &contentType},
+	}
+	if _, err := blockBlobClient.CommitBlockList(ctx, blockIDs, commitOptions); err != nil {
+		return "", fmt.Errorf("failed to commit blob %s: %w", blobName, err)
 	}
 
 	// Get blob URL
 	blobURL := blockBlobClient.URL()
-	log.Printf("[Azure] Successfully uploaded blob: %s -> %s", blobName, blobURL)
+	log.Printf("[Azure] Successfully uploaded blob: %s (%d blocks) -> %s", blobName, len(blockIDs), blobURL)
 	return blobURL, nil
 }
 
+// OpenBlob returns a streaming reader over the blob content; the caller must close it
+func (r *AzureBlobRepositoryImpl) OpenBlob(ctx context.Context, blobName string) (io.ReadCloser, error) {
+	containerClient := r.client.ServiceClient().NewContainerClient(r.containerName)
+	blockBlobClient := containerClient.NewBlockBlobClient(blobName)
+
+	resp, err := blockBlobClient.DownloadStream(ctx, nil)
+	if bloberror.HasCode(err, bloberror.BlobNotFound) {
+		return nil, fmt.Errorf("%w: %s", ErrBlobNotFound, blobName)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to download blob %s: %w", blobName, err)
+	}
+	return resp.Body, nil
+}
+
 // DeleteBlob removes a file from Azure Blob Storage
+// Returns an error wrapping ErrBlobNotFound if the blob does not exist
 func (r *AzureBlobRepositoryImpl) DeleteBlob(ctx context.Context, blobName string) error {
 	containerClient := r.client.ServiceClient().NewContainerClient(r.containerName)
 	blockBlobClient := containerClient.NewBlockBlobClient(blobName)
 
 	_, err := blockBlobClient.Delete(ctx, nil)
+	if bloberror.HasCode(err, bloberror.BlobNotFound) {
+		return fmt.Errorf("%w: %s", ErrBlobNotFound, blobName)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to delete blob %s: %w", blobName, err)
 	}
@@ -83,6 +169,11 @@ func (r *AzureBlobRepositoryImpl) DeleteBlob(ctx context.Context, blobName strin
 	return nil
 }
 
+// stageBlockID returns the base64 block ID for the i-th block; all IDs of a blob must have equal length
+func stageBlockID(i int) string {
+	return base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("block-%08d", i)))
+}
+
 // readSeekCloser wraps bytes.Reader to implement io.ReadSeekCloser
 type readSeekCloser struct {
 	*bytes.Reader
@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+)
+
+// discardTransport answers Blob Storage requests locally, reading and dropping every body
+type discardTransport struct {
+	mu     sync.Mutex
+	staged int64 // Bytes received by Put Block
+}
+
+func (t *discardTransport) Do(req *http.Request) (*http.Response, error) {
+	var n int64
+	if req.Body != nil {
+		n, _ = io.Copy(io.Discard, req.Body)
+		req.Body.Close()
+	}
+	if req.URL.Query().Get("comp") == "block" {
+		t.mu.Lock()
+		t.staged += n
+		t.mu.Unlock()
+	}
+	header := http.Header{}
+	header.Set("ETag", `"0x1"`)
+	header.Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+	return &http.Response{
+		StatusCode: http.StatusCreated,
+		Header:     header,
+		Body:       http.NoBody,
+		Request:    req,
+	}, nil
+}
+
+func newDiscardBlobRepository(tb testing.TB) (*AzureBlobRepositoryImpl, *discardTransport) {
+	transport := &discardTransport{}
+	options := &azblob.ClientOptions{}
+	options.Transport = transport
+	client, err := azblob.NewClientWithNoCredential("https://account.blob.core.windows.net/", options)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return &AzureBlobRepositoryImpl{client: client, containerName: "photos"}, transport
+}
+
+// zeroReader yields zero bytes without allocating
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+func TestStageBlocks(t *testing.T) {
+	repo, transport := newDiscardBlobRepository(t)
+	size := int64(2*stageBlockSize + 100)
+
+	blockIDs, n, err := repo.StageBlocks(context.Background(), "user-1/a.jpg", 3, io.LimitReader(zeroReader{}, size))
+	if err != nil {
+		t.Fatalf("StageBlocks() error = %v", err)
+	}
+	if n != size || transport.staged != size {
+		t.Fatalf("StageBlocks() staged %d bytes, transport received %d, want %d", n, transport.staged, size)
+	}
+	want := []string{stageBlockID(3), stageBlockID(4), stageBlockID(5)}
+	if strings.Join(blockIDs, ",") != strings.Join(want, ",") {
+		t.Fatalf("block IDs = %v, want %v", blockIDs, want)
+	}
+}
+
+// allocatedPerStage stages n streams of size bytes and returns the bytes allocated per stream
+func allocatedPerStage(tb testing.TB, repo *AzureBlobRepositoryImpl, size int64, n int) uint64 {
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	for i := 0; i < n; i++ {
+		if _, _, err := repo.StageBlocks(context.Background(), "user-1/large.jpg", 0, io.LimitReader(zeroReader{}, size)); err != nil {
+			tb.Fatalf("StageBlocks: %v", err)
+		}
+	}
+	runtime.ReadMemStats(&after)
+	return (after.TotalAlloc - before.TotalAlloc) / uint64(n)
+}
+
+// BenchmarkStageBlocksStreaming stages streams of growing size through the Blob Storage client
+// and fails if a stream allocates a sizeable share of its payload, which would mean it is
+// being buffered rather than sent one pooled block at a time
+func BenchmarkStageBlocksStreaming(b *testing.B) {
+	repo, _ := newDiscardBlobRepository(b)
+	for _, size := range []int64{16 * stageBlockSize, 64 * stageBlockSize} {
+		b.Run(fmt.Sprintf("%dMB", size>>20), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(size)
+			b.ResetTimer()
+			perStage := allocatedPerStage(b, repo, size, b.N)
+			// Each block costs a few kilobytes of request overhead, far below its 4 MB of data
+			if limit := uint64(size) / 64; perStage > limit {
+				b.Fatalf("%d MB stream allocated %d bytes, limit %d", size>>20, perStage, limit)
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"log"
 	"time"
 
@@ -13,6 +14,12 @@ import (
 	"go.mongodb.org/mongo-driver/v2/mongo/options"
 )
 
+// ErrDuplicatePhoto is returned by SavePhoto when the user already has a photo with the same checksum
+var ErrDuplicatePhoto = errors.New("photo with the same content already exists")
+
+// ErrPhotoNotFound is returned by updates when no photo has the given ID
+var ErrPhotoNotFound = errors.New("photo not found")
+
 type CosmosDBRepoImpl struct {
 	client    *mongo.Client
 	photoColl *mongo.Collection
@@ -46,6 +53,62 @@ func NewCosmosDBRepository(uri, dbName string) *CosmosDBRepoImpl {
 	}
 	photoColl.Indexes().CreateOne(ctx, indexModel)
 
+	// Geospatial queries are always scoped to one user; photos without a location are not indexed
+	geoIndexModel := mongo.IndexModel{
+		Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "location", Value: "2dsphere"}},
+	}
+	if _, err := photoColl.Indexes().CreateOne(ctx, geoIndexModel); err != nil {
+		log.Printf("[Cosmos] Failed to create location index: %v", err)
+	}
+
+	// Place filters and grouping in read-service
+	placeIndexModel := mongo.IndexModel{
+		Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "place.country_code", Value: 1}, {Key: "place.region", Value: 1}, {Key: "place.city", Value: 1}},
+	}
+	if _, err := photoColl.Indexes().CreateOne(ctx, placeIndexModel); err != nil {
+		log.Printf("[Cosmos] Failed to create place index: %v", err)
+	}
+
+	// Gallery sorts and date range filters in read-service; _id breaks ties between equal values
+	for _, field := range []string{"uploaded_at", "metadata.date_time_original", "file_name", "file_size"} {
+		sortIndexModel := mongo.IndexModel{
+			Keys: bson.D{{Key: "user_id", Value: 1}, {Key: field, Value: -1}, {Key: "_id", Value: -1}},
+		}
+		if _, err := photoColl.Indexes().CreateOne(ctx, sortIndexModel); err != nil {
+			log.Printf("[Cosmos] Failed to create %s index: %v", field, err)
+		}
+	}
+
+	// Time-of-day queries on the local capture time in read-service
+	timeOfDayIndexModel := mongo.IndexModel{
+		Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "metadata.local_minute_of_day", Value: 1}},
+	}
+	if _, err := photoColl.Indexes().CreateOne(ctx, timeOfDayIndexModel); err != nil {
+		log.Printf("[Cosmos] Failed to create time of day index: %v", err)
+	}
+
+	// Similar-photo candidates in read-service: photos sharing a byte of the perceptual hash
+	similarIndexModel := mongo.IndexModel{
+		Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "perceptual_bands", Value: 1}},
+	}
+	if _, err := photoColl.Indexes().CreateOne(ctx, similarIndexModel); err != nil {
+		log.Printf("[Cosmos] Failed to create perceptual band index: %v", err)
+	}
+
+	// Content deduplication: one photo per user and checksum. Documents without a checksum
+	// predate it and are left out of the index.
+	checksumIndexModel := mongo.IndexModel{
+		Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "checksum", Value: 1}},
+		Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{
+			"checksum": bson.M{"$gt": ""},
+		}),
+	}
+	if _, err := photoColl.Indexes().CreateOne(ctx, checksumIndexModel); err != nil {
+		log.Printf("[Cosmos] Failed to create checksum index: %v", err)
+	}
+
+	backfillFileSizes(photoColl)
+
 	userColl := db.Collection("users")
 
 	return &CosmosDBRepoImpl{
@@ -55,9 +118,36 @@ func NewCosmosDBRepository(uri, dbName string) *CosmosDBRepoImpl {
 	}
 }
 
-// SavePhoto inserts a new photo document
+// backfillFileSizes gives documents stored without a file size the size of their original
+// variant, or 0. Gallery sorts by size treat a missing size as null, which sorts before 0
+// but cannot be expressed in a page cursor, so every document needs a number.
+func backfillFileSizes(photoColl *mongo.Collection) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"file_size": bson.M{"$ifNull": bson.A{bson.M{"$arrayElemAt": bson.A{"$variants.size", 0}}, 0}},
+		}}},
+	}
+	result, err := photoColl.UpdateMany(ctx, bson.M{"file_size": nil}, update)
+	if err != nil {
+		log.Printf("[Cosmos] Failed to backfill file sizes: %v", err)
+		return
+	}
+	if result.ModifiedCount > 0 {
+		log.Printf("[Cosmos] Backfilled file size of %d photos", result.ModifiedCount)
+	}
+}
+
+// SavePhoto inserts a new photo document, or returns ErrDuplicatePhoto if the user already
+// stored the same content
 func (r *CosmosDBRepoImpl) SavePhoto(ctx context.Context, photo model.Photo) error {
 	_, err := r.photoColl.InsertOne(ctx, photo)
+	if mongo.IsDuplicateKeyError(err) {
+		log.Printf("[Cosmos] Photo %s duplicates content of user %s", photo.PhotoID, photo.UserID)
+		return ErrDuplicatePhoto
+	}
 	if err != nil {
 		log.Printf("[Cosmos] Failed to save photo: %v", err)
 		return err
@@ -66,10 +156,18 @@ func (r *CosmosDBRepoImpl) SavePhoto(ctx context.Context, photo model.Photo) err
 	return nil
 }
 
-// GetPhotosByUserID retrieves all photos for a specific user
-func (r *CosmosDBRepoImpl) GetPhotosByUserID(ctx context.Context, userID string) ([]model.Photo, error) {
+// GetPhotosPage retrieves up to limit photos of a user, newest upload first, starting after
+// the cursor when one is given
+func (r *CosmosDBRepoImpl) GetPhotosPage(ctx context.Context, userID string, after *model.PhotoCursor, limit int64) ([]model.Photo, error) {
 	filter := bson.M{"user_id": userID}
-	opts := options.Find().SetSort(bson.M{"uploaded_at": -1})
+	if after != nil {
+		// Listings here are only ordered by upload time, see model.DefaultPhotoSort
+		filter["$or"] = bson.A{
+			bson.M{"uploaded_at": bson.M{"$lt": after.Value}},
+			bson.M{"uploaded_at": after.Value, "_id": bson.M{"$lt": after.PhotoID}},
+		}
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "uploaded_at", Value: -1}, {Key: "_id", Value: -1}}).SetLimit(limit)
 
 	cursor, err := r.photoColl.Find(ctx, filter, opts)
 	if err != nil {
@@ -80,12 +178,62 @@ func (r *CosmosDBRepoImpl) GetPhotosByUserID(ctx context.Context, userID string)
 
 	var photos []model.Photo
 	if err := cursor.All(ctx, &photos); err != nil {
+		log.Printf("[Cosmos] Failed to decode photos: %v", err)
 		return nil, err
 	}
-
 	return photos, nil
 }
 
+// FindPhotoIDsByChecksum maps each of the checksums the user already stored to the ID of the photo.
+// Photos whose processing failed are left out so their content can be uploaded again.
+func (r *CosmosDBRepoImpl) FindPhotoIDsByChecksum(ctx context.Context, userID string, checksums []string) (map[string]string, error) {
+	filter := bson.M{
+		"user_id":  userID,
+		"checksum": bson.M{"$in": checksums},
+		"status":   bson.M{"$ne": model.PhotoStatusFailed},
+	}
+	opts := options.Find().SetProjection(bson.M{"_id": 1, "checksum": 1})
+
+	cursor, err := r.photoColl.Find(ctx, filter, opts)
+	if err != nil {
+		log.Printf("[Cosmos] Failed to query checksums for user %s: %v", userID, err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var docs []struct {
+		PhotoID  string `bson:"_id"`
+		Checksum string `bson:"checksum"`
+	}
+	if err := cursor.All(ctx, &docs); err != nil {
+		log.Printf("[Cosmos] Failed to decode checksums: %v", err)
+		return nil, err
+	}
+
+	photoIDs := make(map[string]string, len(docs))
+	for _, d := range docs {
+		photoIDs[d.Checksum] = d.PhotoID
+	}
+	return photoIDs, nil
+}
+
+// DeleteFailedPhotoByChecksum removes the user's photo with the given checksum if its processing
+// failed, returning the removed document so its blobs can be deleted
+func (r *CosmosDBRepoImpl) DeleteFailedPhotoByChecksum(ctx context.Context, userID, checksum string) (model.Photo, bool, error) {
+	var photo model.Photo
+	filter := bson.M{"user_id": userID, "checksum": checksum, "status": model.PhotoStatusFailed}
+	err := r.photoColl.FindOneAndDelete(ctx, filter).Decode(&photo)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return model.Photo{}, false, nil
+	}
+	if err != nil {
+		log.Printf("[Cosmos] Failed to delete failed photo of user %s: %v", userID, err)
+		return model.Photo{}, false, err
+	}
+	log.Printf("[Cosmos] Failed photo deleted: %s by user %s", photo.PhotoID, userID)
+	return photo, true, nil
+}
+
 // GetPhotoByID retrieves a single photo by ID
 func (r *CosmosDBRepoImpl) GetPhotoByID(ctx context.Context, photoID string) (model.Photo, error) {
 	var photo model.Photo
@@ -118,3 +266,191 @@ func (r *CosmosDBRepoImpl) UpdatePhotoMetadata(ctx context.Context, photoID stri
 	}
 	return nil
 }
+
+// UpdatePhotoDetails updates the user-editable title, description and alt text.
+// Only non-nil fields of update are written. Returns ErrPhotoNotFound if the photo is gone.
+func (r *CosmosDBRepoImpl) UpdatePhotoDetails(ctx context.Context, photoID string, update model.PhotoUpdateRequest) error {
+	set := bson.M{}
+	if update.Title != nil {
+		set["title"] = *update.Title
+	}
+	if update.Description != nil {
+		set["description"] = *update.Description
+	}
+	if update.AltText != nil {
+		set["alt_text"] = *update.AltText
+	}
+	if len(set) == 0 {
+		return nil
+	}
+
+	result, err := r.photoColl.UpdateOne(ctx, bson.M{"_id": photoID}, bson.M{"$set": set})
+	if err != nil {
+		log.Printf("[Cosmos] Failed to update details for photo %s: %v", photoID, err)
+		return err
+	}
+	if result.MatchedCount == 0 {
+		log.Printf("[Cosmos] Photo not found: %s", photoID)
+		return ErrPhotoNotFound
+	}
+	return nil
+}
+
+// DeletePhoto removes a photo document owned by userID
+// Returns false if no matching document was found
+func (r *CosmosDBRepoImpl) DeletePhoto(ctx context.Context, userID, photoID string) (bool, error) {
+	result, err := r.photoColl.DeleteOne(ctx, bson.M{"_id": photoID, "user_id": userID})
+	if err != nil {
+		log.Printf("[Cosmos] Failed to delete photo %s: %v", photoID, err)
+		return false, err
+	}
+	if result.DeletedCount == 0 {
+		log.Printf("[Cosmos] Photo not found for deletion: %s", photoID)
+		return false, nil
+	}
+	log.Printf("[Cosmos] Photo deleted: %s by user %s", photoID, userID)
+	return true, nil
+}
+
+// UpdatePhotoPrivacy writes the sharing flag, privacy override, applied mode and variants of a photo
+func (r *CosmosDBRepoImpl) UpdatePhotoPrivacy(ctx context.Context, photo model.Photo) error {
+	update := bson.M{
+		"$set": bson.M{
+			"shared":                  photo.Shared,
+			"privacy_mode":            photo.PrivacyMode,
+			"applied_privacy":         photo.AppliedPrivacy,
+			"applied_privacy_version": photo.AppliedPrivacyVersion,
+			"variants":                photo.Variants,
+		},
+	}
+	result, err := r.photoColl.UpdateOne(ctx, bson.M{"_id": photo.PhotoID}, update)
+	if err != nil {
+		log.Printf("[Cosmos] Failed to update privacy for photo %s: %v", photo.PhotoID, err)
+		return err
+	}
+	if result.MatchedCount == 0 {
+		log.Printf("[Cosmos] Photo not found: %s", photo.PhotoID)
+	}
+	return nil
+}
+
+// SaveAppliedPrivacy writes the applied mode, its version and the variants of a photo that
+// follows its owner's privacy setting. Returns false, writing nothing, if the photo was deleted,
+// got its own mode, or already has a mode of the same or a later version applied.
+func (r *CosmosDBRepoImpl) SaveAppliedPrivacy(ctx context.Context, photo model.Photo) (bool, error) {
+	filter := bson.M{
+		"_id":                     photo.PhotoID,
+		"privacy_mode":            bson.M{"$in": bson.A{"", nil}},
+		"applied_privacy_version": bson.M{"$not": bson.M{"$gte": photo.AppliedPrivacyVersion}},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"applied_privacy":         photo.AppliedPrivacy,
+			"applied_privacy_version": photo.AppliedPrivacyVersion,
+			"variants":                photo.Variants,
+		},
+	}
+	result, err := r.photoColl.UpdateOne(ctx, filter, update)
+	if err != nil {
+		log.Printf("[Cosmos] Failed to save applied privacy for photo %s: %v", photo.PhotoID, err)
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+// UpdatePhotoStatus records the processing state of a photo.
+// Returns false if the photo no longer exists.
+func (r *CosmosDBRepoImpl) UpdatePhotoStatus(ctx context.Context, photoID, status string, attempts int, processingError string) (bool, error) {
+	update := bson.M{
+		"$set": bson.M{
+			"status":              status,
+			"processing_attempts": attempts,
+			"processing_error":    processingError,
+		},
+	}
+	result, err := r.photoColl.UpdateOne(ctx, bson.M{"_id": photoID}, update)
+	if err != nil {
+		log.Printf("[Cosmos] Failed to update status of photo %s: %v", photoID, err)
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+// SaveProcessedPhoto writes what background processing derived from the original: metadata,
+// variants, hashes, place and applied privacy mode, and marks the photo ready.
+// Returns false if the photo was deleted or marked failed in the meantime.
+func (r *CosmosDBRepoImpl) SaveProcessedPhoto(ctx context.Context, photo model.Photo) (bool, error) {
+	set := bson.M{
+		"metadata":                photo.Metadata,
+		"variants":                photo.Variants,
+		"applied_privacy":         photo.AppliedPrivacy,
+		"applied_privacy_version": photo.AppliedPrivacyVersion,
+		"status":                  model.PhotoStatusReady,
+		"processing_error":        "",
+		"processed_at":            photo.ProcessedAt,
+	}
+	// Undecodable images have no hashes; leave the fields out so they stay unindexed
+	if photo.PerceptualHash != "" {
+		set["perceptual_hash"] = photo.PerceptualHash
+		set["perceptual_bands"] = photo.PerceptualBands
+		set["color_histogram"] = photo.ColorHistogram
+	}
+	if photo.Place != nil {
+		set["place"] = photo.Place
+	}
+	// A photo marked failed has had its derived blobs deleted; a stalled attempt must not revive it
+	filter := bson.M{"_id": photo.PhotoID, "status": bson.M{"$ne": model.PhotoStatusFailed}}
+	result, err := r.photoColl.UpdateOne(ctx, filter, bson.M{"$set": set})
+	if err != nil {
+		log.Printf("[Cosmos] Failed to save processed photo %s: %v", photo.PhotoID, err)
+		return false, err
+	}
+	if result.MatchedCount == 0 {
+		log.Printf("[Cosmos] Photo not found: %s", photo.PhotoID)
+		return false, nil
+	}
+	return true, nil
+}
+
+// GetUserPrivacyMode returns the user's default privacy mode, or "" if none was set, and the
+// version of the setting, which counts its changes
+func (r *CosmosDBRepoImpl) GetUserPrivacyMode(ctx context.Context, userID string) (string, int64, error) {
+	var user struct {
+		PrivacyMode    string `bson:"privacy_mode"`
+		PrivacyVersion int64  `bson:"privacy_version"`
+	}
+	opts := options.FindOne().SetProjection(bson.M{"privacy_mode": 1, "privacy_version": 1})
+	err := r.userColl.FindOne(ctx, bson.M{"_id": userID}, opts).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return "", 0, nil
+	}
+	if err != nil {
+		log.Printf("[Cosmos] Failed to get privacy mode for user %s: %v", userID, err)
+		return "", 0, err
+	}
+	return user.PrivacyMode, user.PrivacyVersion, nil
+}
+
+// SetUserPrivacyMode stores the user's default privacy mode, creating the user document if
+// needed, and returns the new version of the setting
+func (r *CosmosDBRepoImpl) SetUserPrivacyMode(ctx context.Context, userID, mode string) (int64, error) {
+	update := bson.M{
+		"$set": bson.M{
+			"privacy_mode": mode,
+			"updated_at":   time.Now(),
+		},
+		"$inc": bson.M{"privacy_version": 1},
+	}
+	opts := options.FindOneAndUpdate().
+		SetUpsert(true).
+		SetReturnDocument(options.After).
+		SetProjection(bson.M{"privacy_version": 1})
+	var user struct {
+		PrivacyVersion int64 `bson:"privacy_version"`
+	}
+	if err := r.userColl.FindOneAndUpdate(ctx, bson.M{"_id": userID}, update, opts).Decode(&user); err != nil {
+		log.Printf("[Cosmos] Failed to set privacy mode for user %s: %v", userID, err)
+		return 0, err
+	}
+	return user.PrivacyVersion, nil
+}
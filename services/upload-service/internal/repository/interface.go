@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"io"
+	"time"
 
 	"seungpyolee.com/pkg/model"
 )
@@ -10,14 +11,30 @@ import (
 // CosmosDBRepository handles photo metadata persistence in MongoDB
 type CosmosDBRepository interface {
 	SavePhoto(ctx context.Context, photo model.Photo) error
-	GetPhotosByUserID(ctx context.Context, userID string) ([]model.Photo, error)
+	GetPhotosPage(ctx context.Context, userID string, after *model.PhotoCursor, limit int64) ([]model.Photo, error)
 	GetPhotoByID(ctx context.Context, photoID string) (model.Photo, error)
+	FindPhotoIDsByChecksum(ctx context.Context, userID string, checksums []string) (map[string]string, error)
+	DeleteFailedPhotoByChecksum(ctx context.Context, userID, checksum string) (photo model.Photo, found bool, err error)
 	UpdatePhotoMetadata(ctx context.Context, photoID string, metadata model.PhotoMetadata) error
+	UpdatePhotoDetails(ctx context.Context, photoID string, update model.PhotoUpdateRequest) error
+	DeletePhoto(ctx context.Context, userID, photoID string) (deleted bool, err error)
+	UpdatePhotoPrivacy(ctx context.Context, photo model.Photo) error
+	SaveAppliedPrivacy(ctx context.Context, photo model.Photo) (saved bool, err error)
+	UpdatePhotoStatus(ctx context.Context, photoID, status string, attempts int, processingError string) (found bool, err error)
+	SaveProcessedPhoto(ctx context.Context, photo model.Photo) (found bool, err error)
+
+	// Per-user settings
+	GetUserPrivacyMode(ctx context.Context, userID string) (mode string, version int64, err error)
+	SetUserPrivacyMode(ctx context.Context, userID, mode string) (version int64, err error)
 }
 
 // AzureBlobRepository handles photo file storage in Azure Blob Storage
 type AzureBlobRepository interface {
 	UploadBlob(ctx context.Context, blobName string, fileData io.Reader, contentType string) (blobURL string, error error)
+	UploadBlobStream(ctx context.Context, blobName string, fileData io.Reader, contentType string) (blobURL string, size int64, err error)
+	StageBlocks(ctx context.Context, blobName string, firstBlock int, fileData io.Reader) (blockIDs []string, size int64, err error)
+	CommitBlocks(ctx context.Context, blobName string, blockIDs []string, contentType string) (blobURL string, err error)
+	OpenBlob(ctx context.Context, blobName string) (io.ReadCloser, error)
 	DeleteBlob(ctx context.Context, blobName string) error
 }
 
@@ -27,8 +44,40 @@ type RedisRepository interface {
 	GetPhotoMetadata(ctx context.Context, photoID string) (*model.Photo, error)
 	DeletePhotoCache(ctx context.Context, photoID string) error
 
-	// Gallery list caching
-	GetGalleryCache(ctx context.Context, userID string) ([]model.Photo, error)
-	SetGalleryCache(ctx context.Context, userID string, photos []model.Photo) error
+	// Gallery pages are cached by read-service; writes invalidate them
 	InvalidateGalleryCache(ctx context.Context, userID string) error
+	// Capture-date timelines are cached by read-service; adding, removing or redating photos invalidates them
+	InvalidateTimelineCache(ctx context.Context, userID string) error
+	// "On this day" results are cached by read-service for the same reasons
+	InvalidateMemoriesCache(ctx context.Context, userID string) error
+	// Similar-photo results are cached by read-service; adding or removing photos invalidates them
+	InvalidateSimilarCache(ctx context.Context, userID string) error
+
+	// Resumable (tus) upload state
+	SetResumableUpload(ctx context.Context, upload *model.ResumableUpload) error
+	GetResumableUpload(ctx context.Context, uploadID string) (*model.ResumableUpload, error)
+	DeleteResumableUpload(ctx context.Context, uploadID string) error
+	LockResumableUpload(ctx context.Context, uploadID string, ttl time.Duration) (bool, error)
+	UnlockResumableUpload(ctx context.Context, uploadID string) error
+
+	// Idempotency-Key records, scoped to the user who sent the key
+	ReserveIdempotencyKey(ctx context.Context, userID, key string, record *model.IdempotencyRecord, ttl time.Duration) (bool, error)
+	GetIdempotencyRecord(ctx context.Context, userID, key string) (*model.IdempotencyRecord, error)
+	SetIdempotencyRecord(ctx context.Context, userID, key string, record *model.IdempotencyRecord, ttl time.Duration) error
+	DeleteIdempotencyRecord(ctx context.Context, userID, key string) error
+
+	// Background processing queue; delivered jobs stay pending until acknowledged
+	EnsureProcessingQueue(ctx context.Context) error
+	EnqueueProcessingJob(ctx context.Context, job *model.ProcessingJob) error
+	ReadProcessingJobs(ctx context.Context, consumer string, count int, block time.Duration) ([]QueuedJob, error)
+	ClaimStaleProcessingJobs(ctx context.Context, consumer string, minIdle time.Duration, count int) ([]QueuedJob, error)
+	AckProcessingJob(ctx context.Context, id string) error
+	DeadLetterProcessingJob(ctx context.Context, queued QueuedJob, reason string) error
+}
+
+// QueuedJob is a processing job as delivered from the queue
+type QueuedJob struct {
+	ID         string // Stream entry ID, used to acknowledge the job
+	Job        model.ProcessingJob
+	Deliveries int64 // How often the job has been handed to a worker, including this time
 }
@@ -5,6 +5,8 @@ import (
 	"context"
 	"encoding/json"
 	"log"
+	"strings"
+	"time"
 
 	"github.com/redis/go-redis/v9"
 	"seungpyolee.com/pkg/model"
@@ -69,47 +71,322 @@ func (r *RedisRepoImpl) DeletePhotoCache(ctx context.Context, photoID string) er
 	return err
 }
 
-// GetGalleryCache retrieves cached gallery list for a user
-func (r *RedisRepoImpl) GetGalleryCache(ctx context.Context, userID string) ([]model.Photo, error) {
+// InvalidateGalleryCache removes all gallery pages read-service cached for a user
+func (r *RedisRepoImpl) InvalidateGalleryCache(ctx context.Context, userID string) error {
 	key := "gallery:" + userID
+	err := r.client.Del(ctx, key).Err()
+	if err != nil && err != redis.Nil {
+		log.Printf("[Redis] Failed to invalidate gallery cache for user %s: %v", userID, err)
+	}
+	return err
+}
+
+// InvalidateTimelineCache removes all timelines read-service cached for a user
+func (r *RedisRepoImpl) InvalidateTimelineCache(ctx context.Context, userID string) error {
+	key := "timeline:" + userID
+	err := r.client.Del(ctx, key).Err()
+	if err != nil && err != redis.Nil {
+		log.Printf("[Redis] Failed to invalidate timeline cache for user %s: %v", userID, err)
+	}
+	return err
+}
+
+// InvalidateMemoriesCache removes all "on this day" results read-service cached for a user
+func (r *RedisRepoImpl) InvalidateMemoriesCache(ctx context.Context, userID string) error {
+	key := "memories:" + userID
+	err := r.client.Del(ctx, key).Err()
+	if err != nil && err != redis.Nil {
+		log.Printf("[Redis] Failed to invalidate memories cache for user %s: %v", userID, err)
+	}
+	return err
+}
+
+// InvalidateSimilarCache removes all similar-photo results read-service cached for a user
+func (r *RedisRepoImpl) InvalidateSimilarCache(ctx context.Context, userID string) error {
+	key := "similar:" + userID
+	err := r.client.Del(ctx, key).Err()
+	if err != nil && err != redis.Nil {
+		log.Printf("[Redis] Failed to invalidate similar cache for user %s: %v", userID, err)
+	}
+	return err
+}
+
+// SetResumableUpload stores tus upload state until the upload expires
+func (r *RedisRepoImpl) SetResumableUpload(ctx context.Context, upload *model.ResumableUpload) error {
+	data, err := json.Marshal(upload)
+	if err != nil {
+		log.Printf("[Redis] Failed to marshal resumable upload: %v", err)
+		return err
+	}
+	key := "tus:" + upload.UploadID
+	err = r.client.Set(ctx, key, data, time.Until(upload.ExpiresAt)).Err()
+	if err != nil {
+		log.Printf("[Redis] Failed to store resumable upload %s: %v", upload.UploadID, err)
+	}
+	return err
+}
+
+// GetResumableUpload retrieves tus upload state; returns nil if unknown or expired
+func (r *RedisRepoImpl) GetResumableUpload(ctx context.Context, uploadID string) (*model.ResumableUpload, error) {
+	key := "tus:" + uploadID
 	val, err := r.client.Get(ctx, key).Result()
 	if err == redis.Nil {
-		return nil, nil // Cache miss
+		return nil, nil
+	}
+	if err != nil {
+		log.Printf("[Redis] Failed to get resumable upload %s: %v", uploadID, err)
+		return nil, err
+	}
+
+	var upload model.ResumableUpload
+	if err := json.Unmarshal([]byte(val), &upload); err != nil {
+		log.Printf("[Redis] Failed to unmarshal resumable upload: %v", err)
+		return nil, err
+	}
+	return &upload, nil
+}
+
+// DeleteResumableUpload removes tus upload state
+func (r *RedisRepoImpl) DeleteResumableUpload(ctx context.Context, uploadID string) error {
+	key := "tus:" + uploadID
+	err := r.client.Del(ctx, key).Err()
+	if err != nil && err != redis.Nil {
+		log.Printf("[Redis] Failed to delete resumable upload %s: %v", uploadID, err)
+	}
+	return err
+}
+
+// LockResumableUpload takes an exclusive lock on an upload; returns false if already held
+func (r *RedisRepoImpl) LockResumableUpload(ctx context.Context, uploadID string, ttl time.Duration) (bool, error) {
+	key := "tus:" + uploadID + ":lock"
+	ok, err := r.client.SetNX(ctx, key, 1, ttl).Result()
+	if err != nil {
+		log.Printf("[Redis] Failed to lock resumable upload %s: %v", uploadID, err)
+	}
+	return ok, err
+}
+
+// UnlockResumableUpload releases the lock taken by LockResumableUpload
+func (r *RedisRepoImpl) UnlockResumableUpload(ctx context.Context, uploadID string) error {
+	key := "tus:" + uploadID + ":lock"
+	err := r.client.Del(ctx, key).Err()
+	if err != nil && err != redis.Nil {
+		log.Printf("[Redis] Failed to unlock resumable upload %s: %v", uploadID, err)
+	}
+	return err
+}
+
+func idempotencyKey(userID, key string) string {
+	return "idempotency:" + userID + ":" + key
+}
+
+// ReserveIdempotencyKey stores record unless the key is already taken; returns false if it was
+func (r *RedisRepoImpl) ReserveIdempotencyKey(ctx context.Context, userID, key string, record *model.IdempotencyRecord, ttl time.Duration) (bool, error) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		log.Printf("[Redis] Failed to marshal idempotency record: %v", err)
+		return false, err
 	}
+	ok, err := r.client.SetNX(ctx, idempotencyKey(userID, key), data, ttl).Result()
 	if err != nil {
-		log.Printf("[Redis] Failed to get gallery cache for user %s: %v", userID, err)
-		return nil, nil // Non-fatal
+		log.Printf("[Redis] Failed to reserve idempotency key for user %s: %v", userID, err)
 	}
+	return ok, err
+}
 
-	var photos []model.Photo
-	if err := json.Unmarshal([]byte(val), &photos); err != nil {
-		log.Printf("[Redis] Failed to unmarshal gallery: %v", err)
+// GetIdempotencyRecord retrieves the record of an idempotency key; returns nil if unknown or expired
+func (r *RedisRepoImpl) GetIdempotencyRecord(ctx context.Context, userID, key string) (*model.IdempotencyRecord, error) {
+	val, err := r.client.Get(ctx, idempotencyKey(userID, key)).Result()
+	if err == redis.Nil {
 		return nil, nil
 	}
-	return photos, nil
+	if err != nil {
+		log.Printf("[Redis] Failed to get idempotency record for user %s: %v", userID, err)
+		return nil, err
+	}
+
+	var record model.IdempotencyRecord
+	if err := json.Unmarshal([]byte(val), &record); err != nil {
+		log.Printf("[Redis] Failed to unmarshal idempotency record: %v", err)
+		return nil, err
+	}
+	return &record, nil
 }
 
-// SetGalleryCache stores gallery list in cache with short TTL
-func (r *RedisRepoImpl) SetGalleryCache(ctx context.Context, userID string, photos []model.Photo) error {
-	data, err := json.Marshal(photos)
+// SetIdempotencyRecord replaces the record of an idempotency key
+func (r *RedisRepoImpl) SetIdempotencyRecord(ctx context.Context, userID, key string, record *model.IdempotencyRecord, ttl time.Duration) error {
+	data, err := json.Marshal(record)
 	if err != nil {
-		log.Printf("[Redis] Failed to marshal gallery: %v", err)
+		log.Printf("[Redis] Failed to marshal idempotency record: %v", err)
 		return err
 	}
-	key := "gallery:" + userID
-	err = r.client.Set(ctx, key, data, shared.ShortCacheTTL).Err()
+	err = r.client.Set(ctx, idempotencyKey(userID, key), data, ttl).Err()
 	if err != nil {
-		log.Printf("[Redis] Failed to cache gallery for user %s: %v", userID, err)
+		log.Printf("[Redis] Failed to store idempotency record for user %s: %v", userID, err)
 	}
 	return err
 }
 
-// InvalidateGalleryCache removes gallery cache for a user
-func (r *RedisRepoImpl) InvalidateGalleryCache(ctx context.Context, userID string) error {
-	key := "gallery:" + userID
-	err := r.client.Del(ctx, key).Err()
+// DeleteIdempotencyRecord forgets an idempotency key
+func (r *RedisRepoImpl) DeleteIdempotencyRecord(ctx context.Context, userID, key string) error {
+	err := r.client.Del(ctx, idempotencyKey(userID, key)).Err()
 	if err != nil && err != redis.Nil {
-		log.Printf("[Redis] Failed to invalidate gallery cache for user %s: %v", userID, err)
+		log.Printf("[Redis] Failed to delete idempotency record for user %s: %v", userID, err)
+	}
+	return err
+}
+
+// Background processing queue: a stream read by one consumer group. Jobs are deleted once
+// acknowledged; jobs that use up their retries are copied to the dead-letter stream.
+const (
+	processingStream      = "photo-processing"
+	processingGroup       = "photo-processors"
+	processingDeadLetters = "photo-processing:dead"
+
+	// Oldest dead letters are trimmed beyond this many
+	maxProcessingDeadLetters = 10000
+)
+
+// EnsureProcessingQueue creates the processing stream and its consumer group if missing
+func (r *RedisRepoImpl) EnsureProcessingQueue(ctx context.Context) error {
+	err := r.client.XGroupCreateMkStream(ctx, processingStream, processingGroup, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		log.Printf("[Redis] Failed to create processing consumer group: %v", err)
+		return err
+	}
+	return nil
+}
+
+// EnqueueProcessingJob appends a job to the processing stream
+func (r *RedisRepoImpl) EnqueueProcessingJob(ctx context.Context, job *model.ProcessingJob) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		log.Printf("[Redis] Failed to marshal processing job: %v", err)
+		return err
+	}
+	err = r.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: processingStream,
+		Values: map[string]interface{}{"job": data},
+	}).Err()
+	if err != nil {
+		log.Printf("[Redis] Failed to enqueue processing of photo %s: %v", job.PhotoID, err)
+	}
+	return err
+}
+
+// ReadProcessingJobs delivers up to count new jobs to consumer, waiting up to block for one
+func (r *RedisRepoImpl) ReadProcessingJobs(ctx context.Context, consumer string, count int, block time.Duration) ([]QueuedJob, error) {
+	streams, err := r.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    processingGroup,
+		Consumer: consumer,
+		Streams:  []string{processingStream, ">"},
+		Count:    int64(count),
+		Block:    block,
+	}).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var jobs []QueuedJob
+	for _, stream := range streams {
+		for _, msg := range stream.Messages {
+			jobs = append(jobs, decodeQueuedJob(msg, 1))
+		}
+	}
+	return jobs, nil
+}
+
+// ClaimStaleProcessingJobs hands consumer up to count jobs that were delivered at least
+// minIdle ago without being acknowledged: failed attempts and jobs of workers that died
+func (r *RedisRepoImpl) ClaimStaleProcessingJobs(ctx context.Context, consumer string, minIdle time.Duration, count int) ([]QueuedJob, error) {
+	pending, err := r.client.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: processingStream,
+		Group:  processingGroup,
+		Idle:   minIdle,
+		Start:  "-",
+		End:    "+",
+		Count:  int64(count),
+	}).Result()
+	if err != nil || len(pending) == 0 {
+		return nil, err
+	}
+
+	ids := make([]string, len(pending))
+	deliveries := make(map[string]int64, len(pending))
+	for i, p := range pending {
+		ids[i] = p.ID
+		deliveries[p.ID] = p.RetryCount + 1
+	}
+	// Another worker may claim the same jobs first; XCLAIM re-checks the idle time and skips them
+	msgs, err := r.client.XClaim(ctx, &redis.XClaimArgs{
+		Stream:   processingStream,
+		Group:    processingGroup,
+		Consumer: consumer,
+		MinIdle:  minIdle,
+		Messages: ids,
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := make([]QueuedJob, 0, len(msgs))
+	for _, msg := range msgs {
+		jobs = append(jobs, decodeQueuedJob(msg, deliveries[msg.ID]))
+	}
+	return jobs, nil
+}
+
+// decodeQueuedJob decodes a stream entry. Undecodable entries come back with an empty job, which
+// workers dead-letter.
+func decodeQueuedJob(msg redis.XMessage, deliveries int64) QueuedJob {
+	queued := QueuedJob{ID: msg.ID, Deliveries: deliveries}
+	data, _ := msg.Values["job"].(string)
+	if err := json.Unmarshal([]byte(data), &queued.Job); err != nil {
+		log.Printf("[Redis] Failed to unmarshal processing job %s: %v", msg.ID, err)
+	}
+	return queued
+}
+
+// AckProcessingJob acknowledges a job and removes it from the stream
+func (r *RedisRepoImpl) AckProcessingJob(ctx context.Context, id string) error {
+	pipe := r.client.TxPipeline()
+	pipe.XAck(ctx, processingStream, processingGroup, id)
+	pipe.XDel(ctx, processingStream, id)
+	_, err := pipe.Exec(ctx)
+	if err != nil {
+		log.Printf("[Redis] Failed to acknowledge processing job %s: %v", id, err)
+	}
+	return err
+}
+
+// DeadLetterProcessingJob moves a job that will not be retried to the dead-letter stream
+func (r *RedisRepoImpl) DeadLetterProcessingJob(ctx context.Context, queued QueuedJob, reason string) error {
+	data, err := json.Marshal(queued.Job)
+	if err != nil {
+		log.Printf("[Redis] Failed to marshal processing job: %v", err)
+		return err
+	}
+	pipe := r.client.TxPipeline()
+	pipe.XAdd(ctx, &redis.XAddArgs{
+		Stream: processingDeadLetters,
+		MaxLen: maxProcessingDeadLetters,
+		Approx: true,
+		Values: map[string]interface{}{
+			"job":        data,
+			"entryId":    queued.ID,
+			"deliveries": queued.Deliveries,
+			"reason":     reason,
+			"failedAt":   time.Now().UTC().Format(time.RFC3339),
+		},
+	})
+	pipe.XAck(ctx, processingStream, processingGroup, queued.ID)
+	pipe.XDel(ctx, processingStream, queued.ID)
+	_, err = pipe.Exec(ctx)
+	if err != nil {
+		log.Printf("[Redis] Failed to dead-letter processing job %s: %v", queued.ID, err)
 	}
 	return err
 }
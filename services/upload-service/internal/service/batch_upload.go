@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"sync"
+
+	"seungpyolee.com/pkg/model"
+	"seungpyolee.com/pkg/shared"
+)
+
+// BatchFile is one file of a batch upload; Open is called when a worker picks it up
+type BatchFile struct {
+	FileName string
+	Size     int64
+	Open     func() (io.ReadCloser, error)
+}
+
+// BatchUploadResult reports the outcome for one file, in request order
+type BatchUploadResult struct {
+	Index     int                `json:"index"`
+	FileName  string             `json:"fileName"`
+	PhotoID   string             `json:"photoId,omitempty"`
+	Duplicate bool               `json:"duplicate,omitempty"` // PhotoID is an earlier upload of the same content
+	Status    string             `json:"status,omitempty"`    // Processing state of a newly stored photo
+	Error     *model.ErrorDetail `json:"error,omitempty"`
+}
+
+// UploadPhotos uploads files with at most shared.BatchUploadConcurrency running at once.
+// A failing file only fails its own result. The gallery cache is invalidated once at the
+// end if anything new was stored.
+func (s *uploaderServiceImpl) UploadPhotos(ctx context.Context, userID string, files []BatchFile) []BatchUploadResult {
+	results := make([]BatchUploadResult, len(files))
+	sem := make(chan struct{}, shared.BatchUploadConcurrency)
+	var wg sync.WaitGroup
+
+	for i, f := range files {
+		results[i] = BatchUploadResult{Index: i, FileName: f.FileName}
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(result *BatchUploadResult, f BatchFile) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			photoID, duplicate, err := s.uploadBatchFile(ctx, userID, f)
+			if err != nil {
+				log.Printf("[Service] Batch file %q failed: %v", f.FileName, err)
+				result.Error = batchErrorDetail(err)
+				return
+			}
+			result.PhotoID, result.Duplicate = photoID, duplicate
+			if !duplicate {
+				result.Status = model.PhotoStatusPending
+			}
+		}(&results[i], f)
+	}
+	wg.Wait()
+
+	uploaded := 0
+	for _, r := range results {
+		if r.PhotoID != "" && !r.Duplicate {
+			uploaded++
+		}
+	}
+	if uploaded > 0 {
+		s.invalidateUserCaches(ctx, userID)
+	}
+
+	log.Printf("[Service] Batch upload by user %s: %d of %d files stored", userID, uploaded, len(files))
+	return results
+}
+
+func (s *uploaderServiceImpl) uploadBatchFile(ctx context.Context, userID string, f BatchFile) (string, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return "", false, err
+	}
+	if f.Size > shared.MaxUploadFileSize {
+		return "", false, ErrUploadTooLarge
+	}
+
+	file, err := f.Open()
+	if err != nil {
+		return "", false, err
+	}
+	defer file.Close()
+
+	return s.storePhoto(ctx, userID, f.FileName, model.PhotoUploadRequest{}, file)
+}
+
+// batchErrorDetail converts an upload error into the structured error returned per file
+func batchErrorDetail(err error) *model.ErrorDetail {
+	code := "upload_failed"
+	switch {
+	case errors.Is(err, ErrInvalidPhotoDetails):
+		code = "invalid_details"
+	case errors.Is(err, ErrUnsupportedMediaType):
+		code = "unsupported_media_type"
+	case errors.Is(err, ErrUploadTooLarge):
+		code = "file_too_large"
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		code = "cancelled"
+	}
+	return &model.ErrorDetail{
+		Code:    code,
+		Message: err.Error(),
+		Target:  "file",
+	}
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"seungpyolee.com/pkg/model"
+)
+
+// UpdateCaptureDate replaces the capture date of a photo owned by userID with one supplied
+// by the owner, who knows better than any inferred source
+func (s *uploaderServiceImpl) UpdateCaptureDate(ctx context.Context, userID, photoID string, req model.CaptureDateRequest) (*model.Photo, error) {
+	photo, err := s.cosmosRepo.GetPhotoByID(ctx, photoID)
+	if err != nil {
+		log.Printf("[Service] Failed to fetch photo %s: %v", photoID, err)
+		return nil, err
+	}
+	if photo.PhotoID == "" {
+		return nil, ErrPhotoNotFound
+	}
+	if photo.UserID != userID {
+		return nil, ErrPhotoForbidden
+	}
+	// Processing rewrites the metadata when it finishes
+	if photo.Processing() {
+		return nil, ErrPhotoProcessing
+	}
+
+	metadata := photo.Metadata
+	if err := applyCaptureDateRequest(req, &metadata); err != nil {
+		return nil, err
+	}
+
+	if err := s.cosmosRepo.UpdatePhotoMetadata(ctx, photoID, metadata); err != nil {
+		log.Printf("[Service] Failed to update capture date for photo %s: %v", photoID, err)
+		return nil, err
+	}
+	photo.Metadata = metadata
+
+	// The single-photo cache and every per-user listing now hold the old date
+	if err := s.redisRepo.DeletePhotoCache(ctx, photoID); err != nil {
+		log.Printf("[Service] Failed to invalidate photo cache: %v (non-fatal)", err)
+	}
+	s.invalidateUserCaches(ctx, userID)
+
+	log.Printf("[Service] Capture date corrected: %s by user %s", photoID, userID)
+	return &photo, nil
+}
+
+// applyCaptureDateRequest validates req and writes the corrected date into metadata.
+// An RFC 3339 time fixes the instant; a local time is placed in req.TimeZone, else in
+// the zone the photo already has, else in UTC.
+func applyCaptureDateRequest(req model.CaptureDateRequest, metadata *model.PhotoMetadata) error {
+	value := strings.TrimSpace(req.DateTime)
+	if value == "" {
+		return fmt.Errorf("%w: dateTime is required", ErrInvalidCaptureDate)
+	}
+
+	var loc *time.Location
+	zoneName, zoneSource := metadata.TimeZone, metadata.TimeZoneSource
+	if name := strings.TrimSpace(req.TimeZone); name != "" {
+		l, ok := parseZone(name)
+		if !ok {
+			return fmt.Errorf("%w: unknown time zone %q", ErrInvalidCaptureDate, name)
+		}
+		loc, zoneName, zoneSource = l, name, model.TimeZoneSourceUser
+	} else if l, ok := parseZone(zoneName); ok {
+		loc = l
+	} else if seconds, ok := currentOffset(*metadata); ok && zoneName != "" {
+		// Zones such as the nautical "UTC+9" are not in the zone database; keep their offset
+		loc = time.FixedZone(zoneName, seconds)
+	} else {
+		loc, zoneName, zoneSource = time.UTC, "", model.TimeZoneSourceUnknown
+	}
+
+	var wall time.Time
+	dateOnly := false
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		if strings.TrimSpace(req.TimeZone) == "" {
+			// Without an explicit zone the offset in the value is the zone
+			_, seconds := t.Zone()
+			zoneName = formatUTCOffset(seconds)
+			loc, zoneSource = time.FixedZone(zoneName, seconds), model.TimeZoneSourceUser
+		}
+		local := t.In(loc)
+		wall = time.Date(local.Year(), local.Month(), local.Day(), local.Hour(), local.Minute(), local.Second(), local.Nanosecond(), time.UTC)
+	} else if t, err := time.Parse(localDateTimeLayout+".999999999", value); err == nil {
+		wall = t
+	} else if t, err := time.Parse("2006-01-02T15:04", value); err == nil {
+		wall = t
+	} else if t, err := time.Parse("2006-01-02", value); err == nil {
+		wall, dateOnly = t, true
+	} else {
+		return fmt.Errorf("%w: dateTime must be RFC 3339 or YYYY-MM-DD[THH:MM[:SS]]", ErrInvalidCaptureDate)
+	}
+
+	instant := time.Date(wall.Year(), wall.Month(), wall.Day(), wall.Hour(), wall.Minute(), wall.Second(), wall.Nanosecond(), loc)
+	if instant.After(time.Now().Add(48 * time.Hour)) {
+		return fmt.Errorf("%w: dateTime is in the future", ErrInvalidCaptureDate)
+	}
+
+	metadata.DateTimeOriginal = instant.UTC()
+	metadata.LocalDateTimeOriginal = wall.Format(localDateTimeLayout)
+	metadata.LocalMinuteOfDay = nil
+	if !dateOnly {
+		minute := wall.Hour()*60 + wall.Minute()
+		metadata.LocalMinuteOfDay = &minute
+	}
+	metadata.TimeZone = zoneName
+	metadata.TimeZoneSource = zoneSource
+	metadata.DateSource = model.DateSourceUser
+	metadata.DateConfidence = model.DateConfidenceHigh
+	return nil
+}
+
+// parseZone resolves a "+09:00" offset or an IANA zone name
+func parseZone(name string) (*time.Location, bool) {
+	if name == "" {
+		return nil, false
+	}
+	if seconds, ok := parseUTCOffset(name); ok {
+		return time.FixedZone(name, seconds), true
+	}
+	// "Local" would be the server's zone, not the photo's
+	loc, err := time.LoadLocation(name)
+	if err != nil || name == "Local" {
+		return nil, false
+	}
+	return loc, true
+}
+
+// currentOffset derives the UTC offset of the stored capture time from its instant and wall clock
+func currentOffset(metadata model.PhotoMetadata) (int, bool) {
+	wall, err := time.Parse(localDateTimeLayout, metadata.LocalDateTimeOriginal)
+	if err != nil || metadata.DateTimeOriginal.IsZero() {
+		return 0, false
+	}
+	return int(wall.Sub(metadata.DateTimeOriginal.Truncate(time.Second)).Seconds()), true
+}
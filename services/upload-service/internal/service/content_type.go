@@ -0,0 +1,153 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// sniffLen is how many leading bytes are inspected to detect the content type
+const sniffLen = 32
+
+// Mismatch policies applied when the file extension disagrees with the detected content
+const (
+	// MismatchUseContent stores the photo under the type detected from its bytes
+	MismatchUseContent = "content"
+	// MismatchReject refuses the upload
+	MismatchReject = "reject"
+)
+
+// SupportedContentTypes lists every image type the sniffer can recognise
+var SupportedContentTypes = []string{
+	"image/jpeg",
+	"image/png",
+	"image/gif",
+	"image/webp",
+	"image/tiff",
+	"image/heic",
+	"image/heif",
+}
+
+// extensionContentTypes maps known image extensions to their content type
+var extensionContentTypes = map[string]string{
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".jpe":  "image/jpeg",
+	".png":  "image/png",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+	".tif":  "image/tiff",
+	".tiff": "image/tiff",
+	".heic": "image/heic",
+	".heif": "image/heif",
+}
+
+// ContentTypePolicy decides which uploads are accepted based on their detected content type
+type ContentTypePolicy struct {
+	AllowedTypes   []string
+	MismatchPolicy string
+}
+
+// DefaultContentTypePolicy accepts every supported image type and trusts the content over the extension
+func DefaultContentTypePolicy() ContentTypePolicy {
+	return ContentTypePolicy{
+		AllowedTypes:   SupportedContentTypes,
+		MismatchPolicy: MismatchUseContent,
+	}
+}
+
+// ParseContentTypePolicy builds a policy from a comma-separated allow-list and a mismatch policy name.
+// Empty values fall back to the defaults.
+func ParseContentTypePolicy(allowedTypes, mismatchPolicy string) (ContentTypePolicy, error) {
+	policy := DefaultContentTypePolicy()
+
+	if strings.TrimSpace(allowedTypes) != "" {
+		policy.AllowedTypes = nil
+		for _, t := range strings.Split(allowedTypes, ",") {
+			t = strings.ToLower(strings.TrimSpace(t))
+			if !slices.Contains(SupportedContentTypes, t) {
+				return policy, fmt.Errorf("unsupported content type %q in allow-list (supported: %s)", t, strings.Join(SupportedContentTypes, ", "))
+			}
+			policy.AllowedTypes = append(policy.AllowedTypes, t)
+		}
+	}
+
+	switch mismatchPolicy {
+	case "":
+	case MismatchUseContent, MismatchReject:
+		policy.MismatchPolicy = mismatchPolicy
+	default:
+		return policy, fmt.Errorf("unknown mismatch policy %q (expected %q or %q)", mismatchPolicy, MismatchUseContent, MismatchReject)
+	}
+	return policy, nil
+}
+
+// Resolve returns the content type to store for a file, given its name and leading bytes.
+// Errors wrap ErrUnsupportedMediaType.
+func (p ContentTypePolicy) Resolve(fileName string, header []byte) (string, error) {
+	detected := detectContentType(header)
+	if detected == "" {
+		return "", fmt.Errorf("%w: content is not a recognised image", ErrUnsupportedMediaType)
+	}
+	if !slices.Contains(p.AllowedTypes, detected) {
+		return "", fmt.Errorf("%w: %s is not accepted", ErrUnsupportedMediaType, detected)
+	}
+
+	ext := strings.ToLower(filepath.Ext(fileName))
+	if declared, ok := extensionContentTypes[ext]; !ok || declared != detected {
+		if p.MismatchPolicy == MismatchReject {
+			return "", fmt.Errorf("%w: extension %q does not match detected type %s", ErrUnsupportedMediaType, ext, detected)
+		}
+		log.Printf("[Service] Extension %q of %q does not match detected type %s; using detected type", ext, fileName, detected)
+	}
+	return detected, nil
+}
+
+// detectContentType identifies an image type from its magic bytes, returning "" if unknown
+func detectContentType(header []byte) string {
+	switch {
+	case bytes.HasPrefix(header, []byte{0xFF, 0xD8, 0xFF}):
+		return "image/jpeg"
+	case bytes.HasPrefix(header, []byte("\x89PNG\r\n\x1a\n")):
+		return "image/png"
+	case bytes.HasPrefix(header, []byte("GIF87a")), bytes.HasPrefix(header, []byte("GIF89a")):
+		return "image/gif"
+	case len(header) >= 12 && bytes.Equal(header[0:4], []byte("RIFF")) && bytes.Equal(header[8:12], []byte("WEBP")):
+		return "image/webp"
+	case bytes.HasPrefix(header, []byte("II*\x00")), bytes.HasPrefix(header, []byte("MM\x00*")):
+		return "image/tiff"
+	case len(header) >= 12 && bytes.Equal(header[4:8], []byte("ftyp")):
+		return detectHEIFBrand(header)
+	}
+	return ""
+}
+
+// detectHEIFBrand inspects the ISO BMFF ftyp box for HEIC/HEIF brands. AVIF files share the
+// generic mif1 brand but hold AV1 images, which are not supported.
+func detectHEIFBrand(header []byte) string {
+	// ftyp box: size(4) "ftyp"(4) major_brand(4) minor_version(4) compatible_brands(4 each)
+	end := min(int(binary.BigEndian.Uint32(header[0:4])), len(header))
+	brands := [][]byte{header[8:12]}
+	for i := 16; i+4 <= end; i += 4 {
+		brands = append(brands, header[i:i+4])
+	}
+	result, avif := "", false
+	for _, b := range brands {
+		switch string(b) {
+		case "heic", "heix", "hevc", "hevx", "heim", "heis":
+			return "image/heic"
+		case "mif1", "msf1":
+			result = "image/heif"
+		case "avif", "avis":
+			avif = true
+		}
+	}
+	if avif {
+		return ""
+	}
+	return result
+}
@@ -0,0 +1,135 @@
+package service
+
+import (
+	"encoding/binary"
+	"errors"
+	"slices"
+	"testing"
+)
+
+// ftyp builds an ISO BMFF ftyp box with the given major and compatible brands
+func ftyp(major string, compatible ...string) []byte {
+	box := make([]byte, 16, 16+4*len(compatible))
+	binary.BigEndian.PutUint32(box, uint32(16+4*len(compatible)))
+	copy(box[4:], "ftyp")
+	copy(box[8:], major)
+	for _, b := range compatible {
+		box = append(box, b...)
+	}
+	return box
+}
+
+func TestDetectContentType(t *testing.T) {
+	// A box that declares fewer bytes than follow it: the trailing "heic" is not a brand
+	truncatedBox := ftyp("mif1", "miaf")
+	binary.BigEndian.PutUint32(truncatedBox, 16)
+	truncatedBox = append(truncatedBox, "heic"...)
+
+	tests := []struct {
+		name   string
+		header []byte
+		want   string
+	}{
+		{"jpeg", []byte{0xFF, 0xD8, 0xFF, 0xE1, 0x00, 0x10}, "image/jpeg"},
+		{"jpeg without a marker", []byte{0xFF, 0xD8, 0x00}, ""},
+		{"png", []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR"), "image/png"},
+		{"gif87a", []byte("GIF87a\x01\x00"), "image/gif"},
+		{"gif89a", []byte("GIF89a\x01\x00"), "image/gif"},
+		{"webp", []byte("RIFF\x24\x00\x00\x00WEBPVP8 "), "image/webp"},
+		{"riff audio", []byte("RIFF\x24\x00\x00\x00WAVEfmt "), ""},
+		{"tiff little endian", []byte("II*\x00\x08\x00\x00\x00"), "image/tiff"},
+		{"tiff big endian", []byte("MM\x00*\x00\x00\x00\x08"), "image/tiff"},
+		{"heic major brand", ftyp("heic", "mif1", "heic"), "image/heic"},
+		{"heix major brand", ftyp("heix", "mif1"), "image/heic"},
+		{"heif major brand", ftyp("mif1", "miaf"), "image/heif"},
+		{"heic compatible brand wins over mif1", ftyp("mif1", "miaf", "heic"), "image/heic"},
+		{"image sequence", ftyp("msf1", "iso8"), "image/heif"},
+		{"brands past the box are ignored", truncatedBox, "image/heif"},
+		{"avif is not heif", ftyp("avif", "mif1", "miaf"), ""},
+		{"avif sequence is not heif", ftyp("msf1", "avis"), ""},
+		{"mp4 video", ftyp("isom", "iso2", "avc1", "mp41"), ""},
+		{"quicktime", ftyp("qt  "), ""},
+		{"short ftyp", []byte("\x00\x00\x00\x08ftyp"), ""},
+		{"text", []byte("hello, world"), ""},
+		{"empty", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := detectContentType(tt.header); got != tt.want {
+				t.Fatalf("detectContentType(%q) = %q, want %q", tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContentTypePolicyResolve(t *testing.T) {
+	jpeg := []byte{0xFF, 0xD8, 0xFF, 0xE0}
+	heic := ftyp("heic", "mif1")
+	onlyJPEG := ContentTypePolicy{AllowedTypes: []string{"image/jpeg"}, MismatchPolicy: MismatchUseContent}
+	reject := ContentTypePolicy{AllowedTypes: SupportedContentTypes, MismatchPolicy: MismatchReject}
+
+	tests := []struct {
+		name     string
+		policy   ContentTypePolicy
+		fileName string
+		header   []byte
+		want     string
+		wantErr  bool
+	}{
+		{"matching extension", DefaultContentTypePolicy(), "a.jpg", jpeg, "image/jpeg", false},
+		{"extension case is ignored", DefaultContentTypePolicy(), "A.JPEG", jpeg, "image/jpeg", false},
+		{"mismatch uses the content", DefaultContentTypePolicy(), "a.png", jpeg, "image/jpeg", false},
+		{"missing extension uses the content", DefaultContentTypePolicy(), "photo", heic, "image/heic", false},
+		{"heic", DefaultContentTypePolicy(), "IMG_0001.HEIC", heic, "image/heic", false},
+		{"unrecognised content", DefaultContentTypePolicy(), "a.jpg", []byte("not an image"), "", true},
+		{"type outside the allow-list", onlyJPEG, "a.heic", heic, "", true},
+		{"mismatch is rejected", reject, "a.png", jpeg, "", true},
+		{"missing extension is rejected", reject, "photo", jpeg, "", true},
+		{"match under reject", reject, "a.jpe", jpeg, "image/jpeg", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.policy.Resolve(tt.fileName, tt.header)
+			if tt.wantErr {
+				if !errors.Is(err, ErrUnsupportedMediaType) {
+					t.Fatalf("Resolve(%q) error = %v, want ErrUnsupportedMediaType", tt.fileName, err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("Resolve(%q) = %q, %v; want %q", tt.fileName, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseContentTypePolicy(t *testing.T) {
+	tests := []struct {
+		name         string
+		allowed      string
+		mismatch     string
+		wantAllowed  []string
+		wantMismatch string
+		wantErr      bool
+	}{
+		{"defaults", "", "", SupportedContentTypes, MismatchUseContent, false},
+		{"allow-list is normalised", " Image/JPEG, image/heic ", "", []string{"image/jpeg", "image/heic"}, MismatchUseContent, false},
+		{"reject mismatches", "", MismatchReject, SupportedContentTypes, MismatchReject, false},
+		{"unsupported type", "image/jpeg,image/bmp", "", nil, "", true},
+		{"unknown mismatch policy", "", "extension", nil, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, err := ParseContentTypePolicy(tt.allowed, tt.mismatch)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseContentTypePolicy(%q, %q) error = %v, wantErr %v", tt.allowed, tt.mismatch, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !slices.Equal(policy.AllowedTypes, tt.wantAllowed) || policy.MismatchPolicy != tt.wantMismatch {
+				t.Fatalf("ParseContentTypePolicy(%q, %q) = %v %q", tt.allowed, tt.mismatch, policy.AllowedTypes, policy.MismatchPolicy)
+			}
+		})
+	}
+}
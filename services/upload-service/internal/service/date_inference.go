@@ -0,0 +1,207 @@
+package service
+
+import (
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"seungpyolee.com/pkg/model"
+)
+
+// dateCandidate is a capture date found in the image metadata or the file name
+type dateCandidate struct {
+	wall       time.Time // Wall-clock time, stored as UTC
+	dateOnly   bool      // The source had no time of day
+	offset     string    // UTC offset recorded with the date, e.g. "+09:00"
+	source     string    // model.DateSource*
+	confidence string    // model.DateConfidence*
+}
+
+// localDateTimeLayout formats model.PhotoMetadata.LocalDateTimeOriginal
+const localDateTimeLayout = "2006-01-02T15:04:05"
+
+// Layouts accepted for XMP and PNG dates. XMP uses ISO 8601 with optional parts; PNG
+// "Creation Time" is free text, most often RFC 1123 or the EXIF layout.
+var (
+	zonedDateLayouts = []string{
+		time.RFC3339Nano,
+		"2006-01-02T15:04Z07:00",
+		time.RFC1123Z,
+		time.RFC1123,
+		"Mon, 2 Jan 2006 15:04:05 -0700",
+		"2006:01:02 15:04:05-07:00",
+	}
+	localDateLayouts = []string{
+		"2006-01-02T15:04:05.999999999",
+		"2006-01-02T15:04",
+		"2006-01-02 15:04:05",
+		exifDateTimeLayout,
+	}
+	dateOnlyLayouts = []string{
+		"2006-01-02",
+		"2006:01:02",
+	}
+)
+
+// parseEmbeddedDate parses an XMP or PNG date, keeping the wall clock and any recorded offset
+func parseEmbeddedDate(value, source, confidence string) (dateCandidate, bool) {
+	c := dateCandidate{source: source, confidence: confidence}
+	for _, layout := range zonedDateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			c.wall = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+			// Named zones such as "MST" in RFC 1123 carry no usable offset
+			if layout != time.RFC1123 {
+				c.offset = t.Format("-07:00")
+			}
+			return c, plausibleCaptureDate(c.wall)
+		}
+	}
+	for _, layout := range localDateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			c.wall = t
+			return c, plausibleCaptureDate(c.wall)
+		}
+	}
+	for _, layout := range dateOnlyLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			c.wall, c.dateOnly = t, true
+			c.confidence = model.DateConfidenceLow
+			return c, plausibleCaptureDate(c.wall)
+		}
+	}
+	return c, false
+}
+
+// File name patterns written by cameras, phones, screenshot tools and messengers
+var (
+	// IMG_20240102_153045.jpg, PXL_20240102_153045123.jpg, 20240102_153045.jpg, Screenshot_20240102-153045.png
+	compactDateTimePattern = regexp.MustCompile(`(?:^|\D)((?:19|20)\d{6})[_-](\d{6})(?:\D|$|\d{3}(?:\D|$))`)
+
+	// Screenshot_2024-01-02-15-30-45-123_com.app.png, Screenshot 2024-01-02 at 15.30.45.png,
+	// Screen Shot 2024-01-02 at 3.30.45 PM.png, WhatsApp Image 2024-01-02 at 15.30.45.jpeg,
+	// Screenshot from 2024-01-02 15-30-45.png
+	separatedDateTimePattern = regexp.MustCompile(`(?i)(?:^|\D)((?:19|20)\d{2}-\d{2}-\d{2})(?:[ _T-]|\sat\s)(\d{1,2})[.:-](\d{2})[.:-](\d{2})(?:\s?([AP]M))?`)
+
+	// IMG-20240102-WA0001.jpg: WhatsApp keeps only the day the image was sent or received
+	whatsAppDatePattern = regexp.MustCompile(`(?i)^(?:IMG|VID|AUD|STK)-((?:19|20)\d{6})-WA\d+`)
+
+	// Any other 2024-01-02 in the name
+	separatedDatePattern = regexp.MustCompile(`(?:^|\D)((?:19|20)\d{2}-\d{2}-\d{2})(?:\D|$)`)
+)
+
+// parseFileNameDate infers a capture date from the upload's file name. Full timestamps
+// rank as medium confidence, names with only a date as low.
+func parseFileNameDate(fileName string) (dateCandidate, bool) {
+	name := strings.TrimSuffix(filepath.Base(fileName), filepath.Ext(fileName))
+	c := dateCandidate{source: model.DateSourceFileName, confidence: model.DateConfidenceMedium}
+
+	if m := compactDateTimePattern.FindStringSubmatch(name); m != nil {
+		if t, err := time.Parse("20060102150405", m[1]+m[2]); err == nil && plausibleCaptureDate(t) {
+			c.wall = t
+			return c, true
+		}
+	}
+	if m := separatedDateTimePattern.FindStringSubmatch(name); m != nil {
+		if t, ok := separatedDateTime(m[1], m[2], m[3], m[4], m[5]); ok && plausibleCaptureDate(t) {
+			c.wall = t
+			return c, true
+		}
+	}
+
+	c.dateOnly, c.confidence = true, model.DateConfidenceLow
+	if m := whatsAppDatePattern.FindStringSubmatch(name); m != nil {
+		if t, err := time.Parse("20060102", m[1]); err == nil && plausibleCaptureDate(t) {
+			c.wall = t
+			return c, true
+		}
+	}
+	if m := separatedDatePattern.FindStringSubmatch(name); m != nil {
+		if t, err := time.Parse("2006-01-02", m[1]); err == nil && plausibleCaptureDate(t) {
+			c.wall = t
+			return c, true
+		}
+	}
+	return c, false
+}
+
+// separatedDateTime assembles a date and a 24-hour or AM/PM time of day
+func separatedDateTime(date, hour, minute, second, meridiem string) (time.Time, bool) {
+	day, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return time.Time{}, false
+	}
+	h, _ := strconv.Atoi(hour)
+	m, _ := strconv.Atoi(minute)
+	s, _ := strconv.Atoi(second)
+	if meridiem != "" {
+		if h < 1 || h > 12 {
+			return time.Time{}, false
+		}
+		h %= 12
+		if strings.EqualFold(meridiem, "PM") {
+			h += 12
+		}
+	}
+	if h > 23 || m > 59 || s > 59 {
+		return time.Time{}, false
+	}
+	return day.Add(time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(s)*time.Second), true
+}
+
+// plausibleCaptureDate rejects dates before digital photography or in the future, which
+// in file names are usually counters or IDs that happen to look like dates
+func plausibleCaptureDate(t time.Time) bool {
+	return t.Year() >= 1990 && t.Before(time.Now().Add(48*time.Hour))
+}
+
+func confidenceRank(confidence string) int {
+	switch confidence {
+	case model.DateConfidenceHigh:
+		return 3
+	case model.DateConfidenceMedium:
+		return 2
+	case model.DateConfidenceLow:
+		return 1
+	}
+	return 0
+}
+
+// InferCaptureDate fills in the capture date from the file name when the image metadata
+// had none or only a less reliable one
+func (e *ExifExtractor) InferCaptureDate(fileName string, metadata *model.PhotoMetadata) {
+	if c, ok := parseFileNameDate(fileName); ok {
+		e.offerCaptureDate(c, metadata)
+	}
+}
+
+// offerCaptureDate applies c unless metadata already has a capture date at least as reliable
+func (e *ExifExtractor) offerCaptureDate(c dateCandidate, metadata *model.PhotoMetadata) {
+	if !metadata.DateTimeOriginal.IsZero() && confidenceRank(c.confidence) <= confidenceRank(metadata.DateConfidence) {
+		return
+	}
+	e.setCaptureTime(c, metadata)
+}
+
+// setCaptureTime stores a wall-clock capture time and the UTC instant it maps to. A recorded
+// offset wins; otherwise the zone is resolved as for EXIF dates, see applyCaptureTime.
+func (e *ExifExtractor) setCaptureTime(c dateCandidate, metadata *model.PhotoMetadata) {
+	metadata.LocalDateTimeOriginal = c.wall.Format(localDateTimeLayout)
+	metadata.LocalMinuteOfDay = nil
+	if !c.dateOnly {
+		minute := c.wall.Hour()*60 + c.wall.Minute()
+		metadata.LocalMinuteOfDay = &minute
+	}
+
+	loc, name, source := e.captureZone(c.wall, metadata)
+	if seconds, ok := parseUTCOffset(c.offset); ok {
+		loc, name, source = time.FixedZone(c.offset, seconds), c.offset, model.TimeZoneSourceEmbedded
+	}
+	instant := time.Date(c.wall.Year(), c.wall.Month(), c.wall.Day(), c.wall.Hour(), c.wall.Minute(), c.wall.Second(), c.wall.Nanosecond(), loc)
+	metadata.DateTimeOriginal = instant.UTC()
+	metadata.TimeZone = name
+	metadata.TimeZoneSource = source
+	metadata.DateSource = c.source
+	metadata.DateConfidence = c.confidence
+}
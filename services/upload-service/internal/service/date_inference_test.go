@@ -0,0 +1,126 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"seungpyolee.com/pkg/model"
+)
+
+func TestParseFileNameDate(t *testing.T) {
+	tests := []struct {
+		name           string
+		fileName       string
+		want           time.Time
+		wantDateOnly   bool
+		wantConfidence string
+		wantOK         bool
+	}{
+		{"camera", "IMG_20240102_153045.jpg", time.Date(2024, 1, 2, 15, 30, 45, 0, time.UTC), false, model.DateConfidenceMedium, true},
+		{"camera with millis", "PXL_20240102_153045123.jpg", time.Date(2024, 1, 2, 15, 30, 45, 0, time.UTC), false, model.DateConfidenceMedium, true},
+		{"android screenshot", "Screenshot_20240102-153045.png", time.Date(2024, 1, 2, 15, 30, 45, 0, time.UTC), false, model.DateConfidenceMedium, true},
+		{"separated screenshot", "Screenshot_2024-01-02-15-30-45-123_com.app.png", time.Date(2024, 1, 2, 15, 30, 45, 0, time.UTC), false, model.DateConfidenceMedium, true},
+		{"macos screenshot", "Screenshot 2024-01-02 at 15.30.45.png", time.Date(2024, 1, 2, 15, 30, 45, 0, time.UTC), false, model.DateConfidenceMedium, true},
+		{"macos pm", "Screen Shot 2024-01-02 at 3.30.45 PM.png", time.Date(2024, 1, 2, 15, 30, 45, 0, time.UTC), false, model.DateConfidenceMedium, true},
+		{"macos midnight", "Screen Shot 2024-01-02 at 12.05.00 AM.png", time.Date(2024, 1, 2, 0, 5, 0, 0, time.UTC), false, model.DateConfidenceMedium, true},
+		{"gnome screenshot", "Screenshot from 2024-01-02 15-30-45.png", time.Date(2024, 1, 2, 15, 30, 45, 0, time.UTC), false, model.DateConfidenceMedium, true},
+		{"whatsapp image", "WhatsApp Image 2024-01-02 at 15.30.45.jpeg", time.Date(2024, 1, 2, 15, 30, 45, 0, time.UTC), false, model.DateConfidenceMedium, true},
+		{"whatsapp day only", "IMG-20240102-WA0001.jpg", time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), true, model.DateConfidenceLow, true},
+		{"date in name", "holiday 2024-01-02.jpg", time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), true, model.DateConfidenceLow, true},
+		{"invalid meridiem keeps the day", "Screen Shot 2024-01-02 at 13.30.45 PM.png", time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), true, model.DateConfidenceLow, true},
+		{"directory is ignored", "2023-05-06/DSC_0001.jpg", time.Time{}, false, "", false},
+		{"no date", "DSC_0001.jpg", time.Time{}, false, "", false},
+		{"invalid month", "IMG_20241302_153045.jpg", time.Time{}, false, "", false},
+		{"before digital photography", "IMG_19850102_153045.jpg", time.Time{}, false, "", false},
+		{"in the future", "IMG_20990102_153045.jpg", time.Time{}, false, "", false},
+		{"counter longer than a date", "IMG_202401021_153045.jpg", time.Time{}, false, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, ok := parseFileNameDate(tt.fileName)
+			if ok != tt.wantOK {
+				t.Fatalf("parseFileNameDate(%q) ok = %v, want %v", tt.fileName, ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if !c.wall.Equal(tt.want) || c.dateOnly != tt.wantDateOnly || c.confidence != tt.wantConfidence {
+				t.Fatalf("parseFileNameDate(%q) = %v dateOnly=%v %s; want %v dateOnly=%v %s",
+					tt.fileName, c.wall, c.dateOnly, c.confidence, tt.want, tt.wantDateOnly, tt.wantConfidence)
+			}
+			if c.source != model.DateSourceFileName || c.offset != "" {
+				t.Fatalf("parseFileNameDate(%q) source = %q, offset = %q", tt.fileName, c.source, c.offset)
+			}
+		})
+	}
+}
+
+func TestParseEmbeddedDate(t *testing.T) {
+	wall := time.Date(2024, 1, 2, 15, 30, 45, 0, time.UTC)
+	tests := []struct {
+		name           string
+		value          string
+		want           time.Time
+		wantOffset     string
+		wantDateOnly   bool
+		wantConfidence string
+		wantOK         bool
+	}{
+		{"xmp with offset", "2024-01-02T15:30:45+09:00", wall, "+09:00", false, model.DateConfidenceHigh, true},
+		{"xmp utc with fraction", "2024-01-02T15:30:45.5Z", wall.Add(500 * time.Millisecond), "+00:00", false, model.DateConfidenceHigh, true},
+		{"xmp without seconds", "2024-01-02T15:30-05:30", wall.Add(-45 * time.Second), "-05:30", false, model.DateConfidenceHigh, true},
+		{"xmp local", "2024-01-02T15:30:45", wall, "", false, model.DateConfidenceHigh, true},
+		{"xmp local without seconds", "2024-01-02T15:30", wall.Add(-45 * time.Second), "", false, model.DateConfidenceHigh, true},
+		{"xmp date only", "2024-01-02", time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), "", true, model.DateConfidenceLow, true},
+		{"png rfc 1123 numeric zone", "Tue, 02 Jan 2024 15:30:45 +0900", wall, "+09:00", false, model.DateConfidenceHigh, true},
+		{"png rfc 1123 single digit day", "Tue, 2 Jan 2024 15:30:45 -0700", wall, "-07:00", false, model.DateConfidenceHigh, true},
+		{"png rfc 1123 named zone", "Tue, 02 Jan 2024 15:30:45 KST", wall, "", false, model.DateConfidenceHigh, true},
+		{"png exif layout", "2024:01:02 15:30:45", wall, "", false, model.DateConfidenceHigh, true},
+		{"png exif layout with offset", "2024:01:02 15:30:45+09:00", wall, "+09:00", false, model.DateConfidenceHigh, true},
+		{"png space separated", "2024-01-02 15:30:45", wall, "", false, model.DateConfidenceHigh, true},
+		{"png exif date only", "2024:01:02", time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), "", true, model.DateConfidenceLow, true},
+		{"zeroed exif date", "0000:00:00 00:00:00", time.Time{}, "", false, "", false},
+		{"before digital photography", "1985-01-02T15:30:45", time.Time{}, "", false, "", false},
+		{"free text", "last summer", time.Time{}, "", false, "", false},
+		{"empty", "", time.Time{}, "", false, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, ok := parseEmbeddedDate(tt.value, model.DateSourceXMP, model.DateConfidenceHigh)
+			if ok != tt.wantOK {
+				t.Fatalf("parseEmbeddedDate(%q) ok = %v, want %v", tt.value, ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if !c.wall.Equal(tt.want) || c.wall.Location() != time.UTC {
+				t.Fatalf("parseEmbeddedDate(%q) wall = %v, want %v", tt.value, c.wall, tt.want)
+			}
+			if c.offset != tt.wantOffset || c.dateOnly != tt.wantDateOnly || c.confidence != tt.wantConfidence {
+				t.Fatalf("parseEmbeddedDate(%q) = offset %q dateOnly=%v %s; want offset %q dateOnly=%v %s",
+					tt.value, c.offset, c.dateOnly, c.confidence, tt.wantOffset, tt.wantDateOnly, tt.wantConfidence)
+			}
+		})
+	}
+}
+
+func TestParseXMPCaptureDate(t *testing.T) {
+	tests := []struct {
+		name   string
+		packet string
+		want   string
+	}{
+		{"attribute", `<rdf:Description xmp:CreateDate="2024-01-02T15:30:45+09:00"/>`, "2024-01-02T15:30:45+09:00"},
+		{"element", `<exif:DateTimeOriginal> 2024-01-02T15:30:45 </exif:DateTimeOriginal>`, "2024-01-02T15:30:45"},
+		{"original beats create date", `<rdf:Description xmp:CreateDate="2024-03-04T10:00:00" exif:DateTimeOriginal="2024-01-02T15:30:45"/>`, "2024-01-02T15:30:45"},
+		{"empty original falls through", `<rdf:Description exif:DateTimeOriginal="" photoshop:DateCreated="2024-01-02"/>`, "2024-01-02"},
+		{"no date", `<rdf:Description xmp:Rating="5"/>`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseXMP([]byte(tt.packet)).created; got != tt.want {
+				t.Fatalf("parseXMP().created = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
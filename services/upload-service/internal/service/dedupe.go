@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	"seungpyolee.com/pkg/model"
+	"seungpyolee.com/pkg/shared"
+)
+
+// CheckUploads tells a client which of the files it is about to upload, given as hex SHA-256
+// hashes of their content, are already stored so it can skip them
+func (s *uploaderServiceImpl) CheckUploads(ctx context.Context, userID string, hashes []string) (*model.UploadCheckResponse, error) {
+	if len(hashes) == 0 || len(hashes) > shared.MaxUploadCheckHashes {
+		return nil, fmt.Errorf("%w: between 1 and %d hashes are required", ErrInvalidChecksum, shared.MaxUploadCheckHashes)
+	}
+	normalized := make([]string, len(hashes))
+	for i, h := range hashes {
+		h = strings.ToLower(strings.TrimSpace(h))
+		if b, err := hex.DecodeString(h); err != nil || len(b) != 32 {
+			return nil, fmt.Errorf("%w: %q is not a hex SHA-256 hash", ErrInvalidChecksum, hashes[i])
+		}
+		normalized[i] = h
+	}
+
+	photoIDs, err := s.cosmosRepo.FindPhotoIDsByChecksum(ctx, userID, normalized)
+	if err != nil {
+		log.Printf("[Service] Failed to check uploads for user %s: %v", userID, err)
+		return nil, err
+	}
+
+	result := &model.UploadCheckResponse{Existing: make(map[string]string), Missing: []string{}}
+	for _, h := range normalized {
+		if photoID, ok := photoIDs[h]; ok {
+			result.Existing[h] = photoID
+		} else if !slices.Contains(result.Missing, h) {
+			result.Missing = append(result.Missing, h)
+		}
+	}
+	return result, nil
+}
+
+// existingPhotoID returns the user's photo with the given checksum, if any, ignoring photos whose
+// processing failed. Lookup failures only log; the unique checksum index still rejects the
+// duplicate when it is saved.
+func (s *uploaderServiceImpl) existingPhotoID(ctx context.Context, userID, checksum string) (string, bool) {
+	photoIDs, err := s.cosmosRepo.FindPhotoIDsByChecksum(ctx, userID, []string{checksum})
+	if err != nil {
+		log.Printf("[Service] Failed to look up checksum for user %s: %v (non-fatal)", userID, err)
+		return "", false
+	}
+	photoID, ok := photoIDs[checksum]
+	return photoID, ok
+}
+
+// removeFailedPhoto deletes the user's failed photo with the given checksum, its blobs and its
+// cached metadata so the content can be stored again. It reports whether a photo was removed.
+func (s *uploaderServiceImpl) removeFailedPhoto(ctx context.Context, userID, checksum string) bool {
+	photo, found, err := s.cosmosRepo.DeleteFailedPhotoByChecksum(ctx, userID, checksum)
+	if err != nil || !found {
+		return false
+	}
+	s.discardBlobs(s.photoBlobNames(photo))
+	if err := s.redisRepo.DeletePhotoCache(ctx, photo.PhotoID); err != nil {
+		log.Printf("[Service] Failed to invalidate photo cache: %v (non-fatal)", err)
+	}
+	s.invalidateUserCaches(ctx, userID)
+	log.Printf("[Service] Failed photo %s of user %s replaced by a new upload", photo.PhotoID, userID)
+	return true
+}
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"seungpyolee.com/pkg/model"
+)
+
+func TestFailedPhotosAreNotDuplicates(t *testing.T) {
+	content := []byte{0xFF, 0xD8, 0xFF, 0xDA, 0x00, 0x02, 1, 2, 3}
+	sum := sha256.Sum256(content)
+	checksum := hex.EncodeToString(sum[:])
+
+	tests := []struct {
+		name          string
+		status        string
+		wantDuplicate bool
+	}{
+		{"pending", model.PhotoStatusPending, true},
+		{"ready", model.PhotoStatusReady, true},
+		{"legacy without status", "", true},
+		{"failed", model.PhotoStatusFailed, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, cosmos, blobs, _ := newTestUploader()
+			ctx := context.Background()
+			old := model.Photo{
+				PhotoID:  "old",
+				UserID:   "user-1",
+				Checksum: checksum,
+				Status:   tt.status,
+				Variants: []model.PhotoVariant{{Name: model.VariantOriginal, BlobName: "user-1/old.jpg"}},
+			}
+			cosmos.photos[old.PhotoID] = old
+			blobs.blobs["user-1/old.jpg"] = content
+
+			check, err := s.CheckUploads(ctx, "user-1", []string{checksum})
+			if err != nil {
+				t.Fatalf("CheckUploads: %v", err)
+			}
+			if _, existing := check.Existing[checksum]; existing != tt.wantDuplicate {
+				t.Fatalf("CheckUploads existing = %v, want %v", existing, tt.wantDuplicate)
+			}
+
+			photoID, duplicate, err := s.storePhoto(ctx, "user-1", "a.jpg", model.PhotoUploadRequest{}, bytes.NewReader(content))
+			if err != nil {
+				t.Fatalf("storePhoto: %v", err)
+			}
+			if duplicate != tt.wantDuplicate {
+				t.Fatalf("storePhoto duplicate = %v, want %v", duplicate, tt.wantDuplicate)
+			}
+			_, oldKept := cosmos.photos["old"]
+			if tt.wantDuplicate {
+				if photoID != "old" || !oldKept {
+					t.Fatalf("duplicate upload returned %q, old photo kept %v", photoID, oldKept)
+				}
+				return
+			}
+			if photoID == "old" || oldKept {
+				t.Fatalf("failed photo not replaced: returned %q, old photo kept %v", photoID, oldKept)
+			}
+			if _, ok := cosmos.photos[photoID]; !ok {
+				t.Fatalf("replacement photo %q not saved", photoID)
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package service
+
+import (
+	"encoding/binary"
+	"image"
+	"io"
+
+	// Register decoders so image.DecodeConfig and imaging.Decode understand every accepted type
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+)
+
+// heifHeaderScanLimit bounds how far into a HEIC/HEIF file we look for the ispe box
+const heifHeaderScanLimit = 512 << 10
+
+// readDimensions returns the stored (pre-orientation) pixel size of an image by reading
+// only its header. Returns false if the format is not understood.
+func readDimensions(r io.Reader, contentType string) (width, height int, ok bool) {
+	if contentType == "image/heic" || contentType == "image/heif" {
+		return readHEIFDimensions(r)
+	}
+	cfg, _, err := image.DecodeConfig(r)
+	if err != nil || cfg.Width <= 0 || cfg.Height <= 0 {
+		return 0, 0, false
+	}
+	return cfg.Width, cfg.Height, true
+}
+
+// readHEIFDimensions reads the "ispe" (image spatial extent) property of the primary item.
+// HEIC files carry one per image item, thumbnails, grid tiles and depth maps included, so the
+// primary item ("pitm") is looked up in the property associations ("ipma"). Files that name
+// no primary item fall back to the largest extent.
+func readHEIFDimensions(r io.Reader) (int, int, bool) {
+	header, err := io.ReadAll(io.LimitReader(r, heifHeaderScanLimit))
+	if err != nil {
+		return 0, 0, false
+	}
+
+	// meta is a full box: version and flags precede its children
+	meta, ok := findBox(isoBoxes(header), "meta")
+	if !ok || len(meta) < 4 {
+		return 0, 0, false
+	}
+	metaBoxes := isoBoxes(meta[4:])
+	iprp, ok := findBox(metaBoxes, "iprp")
+	if !ok {
+		return 0, 0, false
+	}
+	iprpBoxes := isoBoxes(iprp)
+	ipco, _ := findBox(iprpBoxes, "ipco")
+	properties := isoBoxes(ipco)
+
+	if primary, ok := primaryItem(metaBoxes); ok {
+		ipma, _ := findBox(iprpBoxes, "ipma")
+		for _, index := range itemProperties(ipma, primary) {
+			// Property indices are 1-based; 0 means none
+			if index >= 1 && index <= len(properties) {
+				if w, h, ok := imageExtent(properties[index-1]); ok {
+					return w, h, true
+				}
+			}
+		}
+	}
+
+	bestW, bestH := 0, 0
+	for _, p := range properties {
+		if w, h, ok := imageExtent(p); ok && w*h > bestW*bestH {
+			bestW, bestH = w, h
+		}
+	}
+	return bestW, bestH, bestW > 0 && bestH > 0
+}
+
+// isoBox is one box of an ISO BMFF file such as HEIF: its four-character type and payload
+type isoBox struct {
+	typ  string
+	data []byte
+}
+
+// isoBoxes splits data into consecutive boxes, stopping at the first one that does not fit,
+// such as image data cut off by the scan limit
+func isoBoxes(data []byte) []isoBox {
+	var boxes []isoBox
+	for len(data) >= 8 {
+		size, headerLen := uint64(binary.BigEndian.Uint32(data)), uint64(8)
+		switch size {
+		case 0:
+			// Extends to the end of the file
+			size = uint64(len(data))
+		case 1:
+			if len(data) < 16 {
+				return boxes
+			}
+			size, headerLen = binary.BigEndian.Uint64(data[8:16]), 16
+		}
+		if size < headerLen || size > uint64(len(data)) {
+			return boxes
+		}
+		boxes = append(boxes, isoBox{typ: string(data[4:8]), data: data[headerLen:size]})
+		data = data[size:]
+	}
+	return boxes
+}
+
+// findBox returns the payload of the first box of the given type
+func findBox(boxes []isoBox, typ string) ([]byte, bool) {
+	for _, b := range boxes {
+		if b.typ == typ {
+			return b.data, true
+		}
+	}
+	return nil, false
+}
+
+// primaryItem reads the item ID of the "pitm" box among the children of meta
+func primaryItem(metaBoxes []isoBox) (uint32, bool) {
+	pitm, ok := findBox(metaBoxes, "pitm")
+	switch {
+	case !ok || len(pitm) < 6:
+		return 0, false
+	case pitm[0] == 0:
+		return uint32(binary.BigEndian.Uint16(pitm[4:6])), true
+	case len(pitm) >= 8:
+		return binary.BigEndian.Uint32(pitm[4:8]), true
+	}
+	return 0, false
+}
+
+// itemProperties returns the property indices associated with item in an "ipma" box.
+// Version 1 uses 32-bit item IDs; flag 1 widens indices from 7 to 15 bits.
+func itemProperties(ipma []byte, item uint32) []int {
+	if len(ipma) < 8 {
+		return nil
+	}
+	version, wideIndices := ipma[0], ipma[3]&1 != 0
+	count := binary.BigEndian.Uint32(ipma[4:8])
+	p := ipma[8:]
+	for range count {
+		var id uint32
+		if version < 1 {
+			if len(p) < 3 {
+				return nil
+			}
+			id, p = uint32(binary.BigEndian.Uint16(p)), p[2:]
+		} else {
+			if len(p) < 5 {
+				return nil
+			}
+			id, p = binary.BigEndian.Uint32(p), p[4:]
+		}
+		n := int(p[0])
+		p = p[1:]
+
+		indices := make([]int, 0, n)
+		for range n {
+			if wideIndices {
+				if len(p) < 2 {
+					return nil
+				}
+				indices, p = append(indices, int(binary.BigEndian.Uint16(p)&0x7FFF)), p[2:]
+			} else {
+				if len(p) < 1 {
+					return nil
+				}
+				indices, p = append(indices, int(p[0]&0x7F)), p[1:]
+			}
+		}
+		if id == item {
+			return indices
+		}
+	}
+	return nil
+}
+
+// imageExtent reads the width and height of an "ispe" property
+func imageExtent(b isoBox) (int, int, bool) {
+	// ispe: version/flags(4) width(4) height(4)
+	if b.typ != "ispe" || len(b.data) < 12 {
+		return 0, 0, false
+	}
+	w := int(binary.BigEndian.Uint32(b.data[4:8]))
+	h := int(binary.BigEndian.Uint32(b.data[8:12]))
+	return w, h, w > 0 && h > 0
+}
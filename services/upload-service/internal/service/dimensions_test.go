@@ -0,0 +1,141 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/png"
+	"testing"
+)
+
+// box builds an ISO BMFF box from its type and payload parts
+func box(typ string, payload ...[]byte) []byte {
+	data := bytes.Join(payload, nil)
+	out := binary.BigEndian.AppendUint32(nil, uint32(8+len(data)))
+	return append(append(out, typ...), data...)
+}
+
+// fullBox builds a box whose payload starts with a version and 24-bit flags
+func fullBox(typ string, version byte, flags uint32, payload ...[]byte) []byte {
+	head := []byte{version, byte(flags >> 16), byte(flags >> 8), byte(flags)}
+	return box(typ, append([][]byte{head}, payload...)...)
+}
+
+func u16(v uint16) []byte { return binary.BigEndian.AppendUint16(nil, v) }
+func u32(v uint32) []byte { return binary.BigEndian.AppendUint32(nil, v) }
+
+func ispe(w, h uint32) []byte {
+	return fullBox("ispe", 0, 0, u32(w), u32(h))
+}
+
+// ipmaEntry is an item and the 1-based indices of its properties
+type ipmaEntry struct {
+	item    uint32
+	indices []uint16
+}
+
+func ipma(version byte, wide bool, entries ...ipmaEntry) []byte {
+	var flags uint32
+	if wide {
+		flags = 1
+	}
+	payload := [][]byte{u32(uint32(len(entries)))}
+	for _, e := range entries {
+		if version < 1 {
+			payload = append(payload, u16(uint16(e.item)))
+		} else {
+			payload = append(payload, u32(e.item))
+		}
+		payload = append(payload, []byte{byte(len(e.indices))})
+		for _, index := range e.indices {
+			if wide {
+				// The top bit marks the property essential and is not part of the index
+				payload = append(payload, u16(0x8000|index))
+			} else {
+				payload = append(payload, []byte{0x80 | byte(index)})
+			}
+		}
+	}
+	return fullBox("ipma", version, flags, payload...)
+}
+
+// heif assembles ftyp, a meta box with the given children and an mdat that contains a
+// stray "ispe" byte pattern larger than any real extent
+func heif(metaChildren ...[]byte) []byte {
+	stray := append([]byte("ispe"), 0, 0, 0, 0, 0, 0, 0x7F, 0xFF, 0, 0, 0x7F, 0xFF)
+	return bytes.Join([][]byte{
+		box("ftyp", []byte("heic"), u32(0), []byte("mif1heic")),
+		fullBox("meta", 0, 0, append([][]byte{fullBox("hdlr", 0, 0, u32(0), []byte("pict"))}, metaChildren...)...),
+		box("mdat", stray),
+	}, nil)
+}
+
+func TestReadHEIFDimensions(t *testing.T) {
+	// Properties: 1 thumbnail extent, 2 primary extent, 3 colour, 4 a larger depth map extent
+	properties := box("iprp",
+		box("ipco", ispe(320, 240), ispe(4032, 3024), box("colr", []byte("nclx")), ispe(8064, 6048)),
+		ipma(0, false, ipmaEntry{2, []uint16{1}}, ipmaEntry{1, []uint16{3, 2}}, ipmaEntry{3, []uint16{4}}),
+	)
+	grid := box("iprp",
+		box("ipco", ispe(512, 512), ispe(4032, 3024)),
+		ipma(1, true, ipmaEntry{1, []uint16{1}}, ipmaEntry{2, []uint16{1}}, ipmaEntry{70000, []uint16{2}}),
+	)
+	noPrimary := box("iprp", box("ipco", ispe(320, 240), ispe(4032, 3024)), ipma(0, false))
+	full := heif(fullBox("pitm", 0, 0, u16(1)), properties)
+
+	tests := []struct {
+		name   string
+		data   []byte
+		wantW  int
+		wantH  int
+		wantOK bool
+	}{
+		{"primary item, not the largest extent", full, 4032, 3024, true},
+		{"thumbnail as primary", heif(fullBox("pitm", 0, 0, u16(2)), properties), 320, 240, true},
+		{"grid with 32-bit ids and wide indices", heif(fullBox("pitm", 1, 0, u32(70000)), grid), 4032, 3024, true},
+		{"no primary item uses the largest extent", heif(noPrimary), 4032, 3024, true},
+		{"primary without extent uses the largest", heif(fullBox("pitm", 0, 0, u16(9)), noPrimary), 4032, 3024, true},
+		{"meta cut off by the scan limit", full[:len(full)-60], 0, 0, false},
+		{"no meta box", box("ftyp", []byte("heic"), u32(0)), 0, 0, false},
+		{"not a box stream", []byte("ispe\x00\x00\x00\x00\x00\x00\x01\x00\x00\x00\x01\x00"), 0, 0, false},
+		{"empty", nil, 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, h, ok := readHEIFDimensions(bytes.NewReader(tt.data))
+			if w != tt.wantW || h != tt.wantH || ok != tt.wantOK {
+				t.Fatalf("readHEIFDimensions() = %d, %d, %v; want %d, %d, %v", w, h, ok, tt.wantW, tt.wantH, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestReadDimensions(t *testing.T) {
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, image.NewGray(image.Rect(0, 0, 7, 5))); err != nil {
+		t.Fatal(err)
+	}
+	heic := heif(fullBox("pitm", 0, 0, u16(1)), box("iprp", box("ipco", ispe(640, 480)), ipma(0, false, ipmaEntry{1, []uint16{1}})))
+
+	tests := []struct {
+		name        string
+		data        []byte
+		contentType string
+		wantW       int
+		wantH       int
+		wantOK      bool
+	}{
+		{"png header", encoded.Bytes(), "image/png", 7, 5, true},
+		{"heic", heic, "image/heic", 640, 480, true},
+		{"heif", heic, "image/heif", 640, 480, true},
+		{"corrupt png", []byte("\x89PNG\r\n\x1a\n"), "image/png", 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, h, ok := readDimensions(bytes.NewReader(tt.data), tt.contentType)
+			if w != tt.wantW || h != tt.wantH || ok != tt.wantOK {
+				t.Fatalf("readDimensions(%s) = %d, %d, %v; want %d, %d, %v", tt.contentType, w, h, ok, tt.wantW, tt.wantH, tt.wantOK)
+			}
+		})
+	}
+}
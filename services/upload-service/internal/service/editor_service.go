@@ -1,141 +1,221 @@
 package service
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
-	"image/jpeg"
+	"image"
 	"io"
 	"log"
-	"mime"
 	"path/filepath"
 	"strings"
 	"time"
 
-	"github.com/disintegration/imaging"
 	"github.com/google/uuid"
 	"seungpyolee.com/pkg/model"
+	"seungpyolee.com/pkg/shared"
 	"seungpyolee.com/services/upload-service/internal/repository"
 )
 
 // UploaderService handles photo upload, EXIF extraction, and metadata storage
 type UploaderService interface {
-	UploadPhoto(ctx context.Context, userID string, fileName string, fileData io.Reader) (photoID string, err error)
-	GetPhotosByUser(ctx context.Context, userID string) ([]model.Photo, error)
+	UploadPhoto(ctx context.Context, userID string, fileName string, details model.PhotoUploadRequest, fileData io.Reader) (photoID string, duplicate bool, err error)
+	UploadPhotos(ctx context.Context, userID string, files []BatchFile) []BatchUploadResult
+	CheckUploads(ctx context.Context, userID string, hashes []string) (*model.UploadCheckResponse, error)
+	GetPhotosByUser(ctx context.Context, userID, cursor string, limit int) (*model.PhotoPage, error)
+	UpdatePhotoDetails(ctx context.Context, userID, photoID string, update model.PhotoUpdateRequest) (*model.Photo, error)
+	DeletePhoto(ctx context.Context, userID, photoID string) (*DeletePhotoResult, error)
+	UpdatePhotoPrivacy(ctx context.Context, userID, photoID string, update model.PhotoPrivacyRequest) (*model.Photo, error)
+	GetPrivacySettings(ctx context.Context, userID string) (*model.PrivacySettings, error)
+	UpdatePrivacySettings(ctx context.Context, userID, mode string) (*model.PrivacySettings, error)
+	UpdateCaptureDate(ctx context.Context, userID, photoID string, req model.CaptureDateRequest) (*model.Photo, error)
+	GetPhotoStatus(ctx context.Context, userID, photoID string) (*model.PhotoStatus, error)
+
+	// Background processing of stored uploads and privacy mode changes, run by ProcessingWorkerPool
+	ProcessPhoto(ctx context.Context, job model.ProcessingJob, attempt int) error
+	QueuePrivacyJobs(ctx context.Context, job model.ProcessingJob) error
+	ReapplyPhotoPrivacy(ctx context.Context, job model.ProcessingJob) error
+	RecordProcessingFailure(ctx context.Context, job model.ProcessingJob, attempt int, reason string, final bool)
+}
+
+// legacyResizeWidths are the widths of the JPEG variants generated before variant
+// profiles were configurable; they are the default profiles and the cleanup fallback
+var legacyResizeWidths = []int{1080, 720, 480}
+
+// DeletePhotoResult reports what DeletePhoto removed and which cleanup steps failed
+type DeletePhotoResult struct {
+	PhotoID      string           `json:"photoId"`
+	DeletedBlobs []string         `json:"deletedBlobs"`
+	Failures     []CleanupFailure `json:"failures,omitempty"`
+}
+
+// CleanupFailure describes a blob or cache key that could not be removed
+type CleanupFailure struct {
+	Target string `json:"target"`
+	Error  string `json:"error"`
 }
 
 type uploaderServiceImpl struct {
-	cosmosRepo    repository.CosmosDBRepository
-	blobRepo      repository.AzureBlobRepository
-	redisRepo     repository.RedisRepository
-	exifExtractor *ExifExtractor
+	cosmosRepo      repository.CosmosDBRepository
+	blobRepo        repository.AzureBlobRepository
+	redisRepo       repository.RedisRepository
+	exifExtractor   *ExifExtractor
+	contentPolicy   ContentTypePolicy
+	variantProfiles []VariantProfile
+	geocoder        *ReverseGeocoder
 }
 
 func NewUploaderService(
 	cosmosRepo repository.CosmosDBRepository,
 	blobRepo repository.AzureBlobRepository,
 	redisRepo repository.RedisRepository,
+	contentPolicy ContentTypePolicy,
+	variantProfiles []VariantProfile,
+	geocoder *ReverseGeocoder,
 ) UploaderService {
 	return &uploaderServiceImpl{
-		cosmosRepo:    cosmosRepo,
-		blobRepo:      blobRepo,
-		redisRepo:     redisRepo,
-		exifExtractor: NewExifExtractor(),
+		cosmosRepo:      cosmosRepo,
+		blobRepo:        blobRepo,
+		redisRepo:       redisRepo,
+		exifExtractor:   newExifExtractorWithGeocoder(geocoder),
+		contentPolicy:   contentPolicy,
+		variantProfiles: variantProfiles,
+		geocoder:        geocoder,
 	}
 }
 
-// UploadPhoto orchestrates file upload, EXIF extraction, and metadata storage
-func (s *uploaderServiceImpl) UploadPhoto(ctx context.Context, userID string, fileName string, fileData io.Reader) (string, error) {
-	photoID := uuid.New().String()
-	now := time.Now()
+// newExifExtractorWithGeocoder avoids handing the extractor a non-nil interface holding a nil geocoder
+func newExifExtractorWithGeocoder(geocoder *ReverseGeocoder) *ExifExtractor {
+	if geocoder == nil {
+		return NewExifExtractor(nil)
+	}
+	return NewExifExtractor(geocoder)
+}
 
-	// Read entire file into memory so we can upload multiple sizes and extract EXIF
-	fileBytes, err := io.ReadAll(fileData)
+// UploadPhoto orchestrates file upload, EXIF extraction, and metadata storage.
+// The file is streamed to blob storage block by block; it is never held in memory as a whole.
+// The photo is stored as pending and finished by a background job, see ProcessPhoto.
+// Content the user already uploaded is not stored again: the earlier photo's ID is returned
+// with duplicate set.
+func (s *uploaderServiceImpl) UploadPhoto(ctx context.Context, userID string, fileName string, details model.PhotoUploadRequest, fileData io.Reader) (string, bool, error) {
+	photoID, duplicate, err := s.storePhoto(ctx, userID, fileName, details, fileData)
 	if err != nil {
-		log.Printf("[Service] Failed to read uploaded file: %v", err)
-		return "", err
+		return "", false, err
+	}
+	if duplicate {
+		return photoID, true, nil
 	}
 
-	// Determine content type and extension from filename
-	ext := strings.ToLower(filepath.Ext(fileName))
-	contentType := mime.TypeByExtension(ext)
-	if contentType == "" {
-		contentType = "application/octet-stream"
+	// Invalidate this user's cached listings (since we added a new photo)
+	s.invalidateUserCaches(ctx, userID)
+	return photoID, false, nil
+}
+
+// storePhoto uploads the original, saves the pending document, caches the photo and queues
+// its processing, leaving gallery cache invalidation to the caller so batches can invalidate once.
+// For content the user already stored it keeps nothing and returns the existing photo's ID.
+func (s *uploaderServiceImpl) storePhoto(ctx context.Context, userID string, fileName string, details model.PhotoUploadRequest, fileData io.Reader) (photoID string, duplicate bool, err error) {
+	details, err = normalizeUploadDetails(details)
+	if err != nil {
+		return "", false, err
 	}
 
-	// Upload original
-	originalBlobName := fmt.Sprintf("%s/%s%s", userID, photoID, ext)
-	if _, err := s.blobRepo.UploadBlob(ctx, originalBlobName, bytes.NewReader(fileBytes), contentType); err != nil {
-		log.Printf("[Service] Failed to upload original blob: %v", err)
-		return "", err
+	photoID = uuid.New().String()
+	now := time.Now()
+
+	// Determine content type from the leading bytes; the extension is only kept for the blob name
+	ext := strings.ToLower(filepath.Ext(fileName))
+	peeker := bufio.NewReaderSize(fileData, sniffLen)
+	header, _ := peeker.Peek(sniffLen)
+	contentType, err := s.contentPolicy.Resolve(fileName, header)
+	if err != nil {
+		log.Printf("[Service] Rejected upload %q: %v", fileName, err)
+		return "", false, err
 	}
+	fileData = peeker
 
-	// 2. Extract EXIF metadata from buffer
-	metadata := s.exifExtractor.ExtractMetadata(bytes.NewReader(fileBytes))
+	// 1. Stream original to blob storage, teeing into the hash and EXIF extraction
+	var metadata model.PhotoMetadata
+	exifTee := newTeeConsumer(func(r io.Reader) {
+		metadata = s.exifExtractor.ExtractMetadata(r)
+	})
+	hasher := sha256.New()
+	stream := io.TeeReader(fileData, io.MultiWriter(hasher, exifTee))
 
-	// If content is an image, generate resized versions
-	if strings.HasPrefix(contentType, "image/") {
-		img, err := imaging.Decode(bytes.NewReader(fileBytes))
-		if err != nil {
-			log.Printf("[Service] Failed to decode image for resizing: %v", err)
-		} else {
-			sizes := []int{1080, 720, 480}
-			for _, w := range sizes {
-				// Only resize when image is wider than target width
-				if img.Bounds().Dx() <= w {
-					// Skip resizing if original is smaller or equal
-					continue
-				}
-				resized := imaging.Resize(img, w, 0, imaging.Lanczos)
-
-				// Encode resized image to JPEG
-				var buf bytes.Buffer
-				opt := &jpeg.Options{Quality: 85}
-				if err := jpeg.Encode(&buf, resized, opt); err != nil {
-					log.Printf("[Service] Failed to encode resized image %d: %v", w, err)
-					continue
-				}
-
-				resizeBlobName := fmt.Sprintf("%s/%s_%d.jpg", userID, photoID, w)
-				if _, err := s.blobRepo.UploadBlob(ctx, resizeBlobName, bytes.NewReader(buf.Bytes()), "image/jpeg"); err != nil {
-					log.Printf("[Service] Failed to upload resized blob %d: %v", w, err)
-					continue
-				}
-			}
-		}
+	originalBlobName := originalBlobName(userID, photoID, ext)
+	originalURL, fileSize, err := s.blobRepo.UploadBlobStream(ctx, originalBlobName, stream, contentType)
+	exifTee.Close()
+	if err != nil {
+		log.Printf("[Service] Failed to upload original blob: %v", err)
+		return "", false, err
+	}
+	checksum := hex.EncodeToString(hasher.Sum(nil))
+	// Identical content the user already stored is not stored again
+	if existingID, ok := s.existingPhotoID(ctx, userID, checksum); ok {
+		s.discardBlobs([]string{originalBlobName})
+		log.Printf("[Service] Upload %q by user %s duplicates photo %s", fileName, userID, existingID)
+		return existingID, true, nil
+	}
+	original := model.PhotoVariant{
+		Name:        model.VariantOriginal,
+		BlobName:    originalBlobName,
+		URL:         originalURL,
+		ContentType: contentType,
+		Size:        fileSize,
 	}
 
-	// 3. Create Photo document
+	// 2. Create the Photo document; variants, hashes and derived metadata follow in the background
 	photo := model.Photo{
-		PhotoID:    photoID,
-		UserID:     userID,
-		FileName:   fileName,
-		MimeType:   contentType,
-		UploadedAt: now,
-		Metadata:   metadata,
+		PhotoID:     photoID,
+		UserID:      userID,
+		FileName:    fileName,
+		MimeType:    contentType,
+		Title:       details.Title,
+		Description: details.Description,
+		AltText:     details.AltText,
+		FileSize:    fileSize,
+		Checksum:    checksum,
+		UploadedAt:  now,
+		Metadata:    metadata,
+		Variants:    []model.PhotoVariant{original},
+		Status:      model.PhotoStatusPending,
+	}
+	if metadata.GPS != nil {
+		photo.Location = model.NewGeoPoint(metadata.GPS.Latitude, metadata.GPS.Longitude)
 	}
 
-	// 4. Save to MongoDB
-	if err := s.cosmosRepo.SavePhoto(ctx, photo); err != nil {
+	// 3. Save to MongoDB
+	err = s.cosmosRepo.SavePhoto(ctx, photo)
+	if errors.Is(err, repository.ErrDuplicatePhoto) {
+		// A concurrent upload of the same content was saved first
+		if existingID, ok := s.existingPhotoID(ctx, userID, checksum); ok {
+			s.discardBlobs(variantBlobNames(photo))
+			return existingID, true, nil
+		}
+		// Otherwise the content belongs to a photo whose processing failed, which this upload replaces
+		if s.removeFailedPhoto(ctx, userID, checksum) {
+			err = s.cosmosRepo.SavePhoto(ctx, photo)
+		}
+	}
+	if err != nil {
+		// Clean up the original if DB fails
+		s.discardBlobs(variantBlobNames(photo))
 		log.Printf("[Service] Failed to save photo metadata: %v", err)
-		// Clean up blobs (original + resized) if DB fails
-		go func() {
-			ctx := context.Background()
-			// original
-			if delErr := s.blobRepo.DeleteBlob(ctx, originalBlobName); delErr != nil {
-				log.Printf("[Service] Failed to delete original blob during cleanup: %v", delErr)
-			}
-			// resized variants
-			sizes := []int{1080, 720, 480}
-			for _, w := range sizes {
-				resizeBlobName := fmt.Sprintf("%s/%s_%d.jpg", userID, photoID, w)
-				if delErr := s.blobRepo.DeleteBlob(ctx, resizeBlobName); delErr != nil {
-					// non-fatal
-					log.Printf("[Service] Failed to delete resized blob during cleanup: %v", delErr)
-				}
-			}
-		}()
-		return "", err
+		return "", false, err
+	}
+
+	// 4. Queue the processing job; without one the photo would stay pending forever
+	job := &model.ProcessingJob{Kind: model.ProcessingJobUpload, PhotoID: photoID, UserID: userID, EnqueuedAt: now}
+	if err := s.redisRepo.EnqueueProcessingJob(ctx, job); err != nil {
+		if _, delErr := s.cosmosRepo.DeletePhoto(context.Background(), userID, photoID); delErr != nil {
+			log.Printf("[Service] Failed to remove unqueued photo %s: %v", photoID, delErr)
+		}
+		s.discardBlobs(variantBlobNames(photo))
+		return "", false, fmt.Errorf("failed to queue photo processing: %w", err)
 	}
 
 	// 5. Cache the photo metadata
@@ -144,22 +224,258 @@ func (s *uploaderServiceImpl) UploadPhoto(ctx context.Context, userID string, fi
 		// Cache failure is non-fatal
 	}
 
-	// 6. Invalidate gallery cache for this user (since we added a new photo)
-	if err := s.redisRepo.InvalidateGalleryCache(ctx, userID); err != nil {
-		log.Printf("[Service] Failed to invalidate gallery cache: %v (non-fatal)", err)
-		// Cache failure is non-fatal
-	}
+	log.Printf("[Service] Photo uploaded successfully: %s by user %s, processing queued", photoID, userID)
+	return photoID, false, nil
+}
 
-	log.Printf("[Service] Photo uploaded successfully: %s by user %s", photoID, userID)
-	return photoID, nil
+// generateVariants uploads one resized copy of img per configured variant profile,
+// returning the variants that were stored. Profiles that cannot encode the image are
+// skipped; a failed upload fails the whole call so the job is retried.
+func (s *uploaderServiceImpl) generateVariants(ctx context.Context, userID, photoID string, img image.Image) ([]model.PhotoVariant, error) {
+	var variants []model.PhotoVariant
+	for _, profile := range s.variantProfiles {
+		resized, ok := profile.Apply(img)
+		if !ok {
+			// Skip profiles larger than the original
+			continue
+		}
+
+		var buf bytes.Buffer
+		if err := profile.Encode(&buf, resized); err != nil {
+			log.Printf("[Service] Failed to encode variant %s: %v", profile.Name, err)
+			continue
+		}
+
+		blobName := variantBlobName(userID, photoID, profile)
+		url, err := s.blobRepo.UploadBlob(ctx, blobName, bytes.NewReader(buf.Bytes()), profile.ContentType())
+		if err != nil {
+			log.Printf("[Service] Failed to upload variant %s: %v", profile.Name, err)
+			return nil, fmt.Errorf("failed to upload variant %s: %w", profile.Name, err)
+		}
+		variants = append(variants, model.PhotoVariant{
+			Name:        profile.Name,
+			BlobName:    blobName,
+			URL:         url,
+			ContentType: profile.ContentType(),
+			Width:       resized.Bounds().Dx(),
+			Height:      resized.Bounds().Dy(),
+			Size:        int64(buf.Len()),
+		})
+	}
+	return variants, nil
 }
 
-// GetPhotosByUser retrieves all photos for a given user
-func (s *uploaderServiceImpl) GetPhotosByUser(ctx context.Context, userID string) ([]model.Photo, error) {
-	photos, err := s.cosmosRepo.GetPhotosByUserID(ctx, userID)
+// GetPhotosByUser retrieves one page of a user's photos, newest upload first, starting after
+// cursor (empty for the first page). A limit of zero uses shared.DefaultPageSize.
+func (s *uploaderServiceImpl) GetPhotosByUser(ctx context.Context, userID, cursor string, limit int) (*model.PhotoPage, error) {
+	if limit == 0 {
+		limit = shared.DefaultPageSize
+	}
+	if limit < 0 || limit > shared.MaxPageSize {
+		return nil, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidPagination, shared.MaxPageSize)
+	}
+	var after *model.PhotoCursor
+	if cursor != "" {
+		parsed, err := model.ParsePhotoCursor(cursor, model.DefaultPhotoSort)
+		if err != nil {
+			return nil, fmt.Errorf("%w: cursor is malformed or belongs to another listing", ErrInvalidPagination)
+		}
+		after = parsed
+	}
+
+	// One extra photo tells whether another page follows
+	photos, err := s.cosmosRepo.GetPhotosPage(ctx, userID, after, int64(limit+1))
 	if err != nil {
 		log.Printf("[Service] Failed to fetch photos for user %s: %v", userID, err)
 		return nil, err
 	}
-	return photos, nil
+	page := &model.PhotoPage{Photos: photos}
+	if len(photos) > limit {
+		page.Photos = photos[:limit]
+		page.NextCursor = model.NewPhotoCursor(model.DefaultPhotoSort, page.Photos[limit-1])
+	}
+	if page.Photos == nil {
+		page.Photos = []model.Photo{}
+	}
+	page.Count = len(page.Photos)
+	return page, nil
+}
+
+// UpdatePhotoDetails edits the title, description and alt text of a photo owned by userID
+func (s *uploaderServiceImpl) UpdatePhotoDetails(ctx context.Context, userID, photoID string, update model.PhotoUpdateRequest) (*model.Photo, error) {
+	update, err := normalizeUpdateDetails(update)
+	if err != nil {
+		return nil, err
+	}
+
+	photo, err := s.cosmosRepo.GetPhotoByID(ctx, photoID)
+	if err != nil {
+		log.Printf("[Service] Failed to fetch photo %s: %v", photoID, err)
+		return nil, err
+	}
+	if photo.PhotoID == "" {
+		return nil, ErrPhotoNotFound
+	}
+	if photo.UserID != userID {
+		return nil, ErrPhotoForbidden
+	}
+
+	if err := s.cosmosRepo.UpdatePhotoDetails(ctx, photoID, update); err != nil {
+		// Deleted since it was fetched
+		if errors.Is(err, repository.ErrPhotoNotFound) {
+			return nil, ErrPhotoNotFound
+		}
+		log.Printf("[Service] Failed to update details for photo %s: %v", photoID, err)
+		return nil, err
+	}
+
+	if update.Title != nil {
+		photo.Title = *update.Title
+	}
+	if update.Description != nil {
+		photo.Description = *update.Description
+	}
+	if update.AltText != nil {
+		photo.AltText = *update.AltText
+	}
+
+	// The single-photo cache and every per-user listing embedding the photo now hold stale details
+	if err := s.redisRepo.DeletePhotoCache(ctx, photoID); err != nil {
+		log.Printf("[Service] Failed to invalidate photo cache: %v (non-fatal)", err)
+	}
+	s.invalidateUserCaches(ctx, userID)
+
+	log.Printf("[Service] Photo details updated: %s by user %s", photoID, userID)
+	return &photo, nil
+}
+
+// DeletePhoto removes a photo owned by userID together with its original and resized blobs.
+// Blobs are deleted before the document so a failed deletion can be retried; if any blob
+// cannot be removed the document is kept and an error wrapping ErrPartialDeletion is
+// returned alongside the result. Cache invalidation failures are reported in the result.
+func (s *uploaderServiceImpl) DeletePhoto(ctx context.Context, userID, photoID string) (*DeletePhotoResult, error) {
+	photo, err := s.cosmosRepo.GetPhotoByID(ctx, photoID)
+	if err != nil {
+		log.Printf("[Service] Failed to fetch photo %s: %v", photoID, err)
+		return nil, err
+	}
+	if photo.PhotoID == "" {
+		return nil, ErrPhotoNotFound
+	}
+	if photo.UserID != userID {
+		return nil, ErrPhotoForbidden
+	}
+
+	// 1. Remove original and resized blobs
+	deleted, failures := s.deleteBlobs(ctx, s.photoBlobNames(photo))
+	result := &DeletePhotoResult{
+		PhotoID:      photoID,
+		DeletedBlobs: deleted,
+		Failures:     failures,
+	}
+	if len(failures) > 0 {
+		log.Printf("[Service] Photo %s: %d blob(s) could not be deleted, keeping document", photoID, len(failures))
+		return result, fmt.Errorf("%w: %d of %d blobs could not be deleted", ErrPartialDeletion, len(failures), len(failures)+len(deleted))
+	}
+
+	// 2. Remove the document
+	found, err := s.cosmosRepo.DeletePhoto(ctx, userID, photoID)
+	if err != nil {
+		return result, err
+	}
+	if !found {
+		return nil, ErrPhotoNotFound
+	}
+
+	// 3. Invalidate photo, gallery, timeline, memories and similar-photo caches
+	if err := s.redisRepo.DeletePhotoCache(ctx, photoID); err != nil {
+		result.Failures = append(result.Failures, CleanupFailure{Target: "photo:" + photoID, Error: err.Error()})
+	}
+	result.Failures = append(result.Failures, s.invalidateUserCaches(ctx, userID)...)
+
+	log.Printf("[Service] Photo deleted: %s by user %s", photoID, userID)
+	return result, nil
+}
+
+// invalidateUserCaches removes every per-user result read-service cached for userID: gallery
+// pages, timelines, memories and similar photos. Memories and similar photos embed whole photos,
+// so any change to a photo's listing, details or privacy must clear them all. Failures are
+// logged and returned; they are non-fatal since the caches expire on their own.
+func (s *uploaderServiceImpl) invalidateUserCaches(ctx context.Context, userID string) []CleanupFailure {
+	var failures []CleanupFailure
+	for _, cache := range []struct {
+		name       string
+		invalidate func(context.Context, string) error
+	}{
+		{"gallery", s.redisRepo.InvalidateGalleryCache},
+		{"timeline", s.redisRepo.InvalidateTimelineCache},
+		{"memories", s.redisRepo.InvalidateMemoriesCache},
+		{"similar", s.redisRepo.InvalidateSimilarCache},
+	} {
+		if err := cache.invalidate(ctx, userID); err != nil {
+			log.Printf("[Service] Failed to invalidate %s cache: %v (non-fatal)", cache.name, err)
+			failures = append(failures, CleanupFailure{Target: cache.name + ":" + userID, Error: err.Error()})
+		}
+	}
+	return failures
+}
+
+// deleteBlobs deletes each blob, treating already-missing blobs as deleted
+func (s *uploaderServiceImpl) deleteBlobs(ctx context.Context, blobNames []string) ([]string, []CleanupFailure) {
+	deleted := make([]string, 0, len(blobNames))
+	var failures []CleanupFailure
+	for _, name := range blobNames {
+		err := s.blobRepo.DeleteBlob(ctx, name)
+		if err != nil && !errors.Is(err, repository.ErrBlobNotFound) {
+			failures = append(failures, CleanupFailure{Target: name, Error: err.Error()})
+			continue
+		}
+		deleted = append(deleted, name)
+	}
+	return deleted, failures
+}
+
+// discardBlobs deletes the blobs of a photo that is not being kept, in the background
+func (s *uploaderServiceImpl) discardBlobs(blobNames []string) {
+	go func() {
+		_, failures := s.deleteBlobs(context.Background(), blobNames)
+		for _, f := range failures {
+			// non-fatal
+			log.Printf("[Service] Failed to delete blob %s during cleanup: %s", f.Target, f.Error)
+		}
+	}()
+}
+
+// originalBlobName returns the blob name of the uploaded original: {userID}/{photoID}{ext}
+func originalBlobName(userID, photoID, ext string) string {
+	return fmt.Sprintf("%s/%s%s", userID, photoID, ext)
+}
+
+// variantBlobName returns the blob name of a resized variant: {userID}/{photoID}_{profile}{ext}
+func variantBlobName(userID, photoID string, profile VariantProfile) string {
+	return fmt.Sprintf("%s/%s_%s%s", userID, photoID, profile.Name, profile.Extension())
+}
+
+// legacyResizedBlobName returns the blob name used for variants before profiles: {userID}/{photoID}_{width}.jpg
+func legacyResizedBlobName(userID, photoID string, width int) string {
+	return fmt.Sprintf("%s/%s_%d.jpg", userID, photoID, width)
+}
+
+// variantBlobNames lists the blobs recorded on a photo. Photos stored before variants
+// were recorded fall back to the original plus every possible resized width.
+func variantBlobNames(photo model.Photo) []string {
+	var names []string
+	for _, v := range photo.Variants {
+		names = append(names, v.BlobName)
+	}
+	if len(names) > 0 {
+		return names
+	}
+
+	ext := strings.ToLower(filepath.Ext(photo.FileName))
+	names = append(names, originalBlobName(photo.UserID, photo.PhotoID, ext))
+	for _, w := range legacyResizeWidths {
+		names = append(names, legacyResizedBlobName(photo.UserID, photo.PhotoID, w))
+	}
+	return names
 }
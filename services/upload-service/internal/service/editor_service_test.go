@@ -0,0 +1,142 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"runtime"
+	"slices"
+	"testing"
+
+	"seungpyolee.com/pkg/model"
+)
+
+// zeroReader yields zero bytes without allocating
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+// largeUpload returns a reader of size bytes that starts with header, followed by seq and
+// zeros. seq makes each payload's checksum unique.
+func largeUpload(header []byte, size int64, seq uint64) io.Reader {
+	prefix := binary.BigEndian.AppendUint64(slices.Clone(header), seq)
+	return io.MultiReader(bytes.NewReader(prefix), io.LimitReader(zeroReader{}, size-int64(len(prefix))))
+}
+
+// largeJPEG returns a JPEG of size bytes that passes content sniffing: a start and a scan
+// marker whose segment holds seq
+func largeJPEG(size int64, seq uint64) io.Reader {
+	return largeUpload([]byte{0xFF, 0xD8, 0xFF, 0xDA, 0x00, 0x0A}, size, seq)
+}
+
+// largeTIFF returns a TIFF of size bytes with an empty first IFD, which the EXIF decoder
+// reads from the stream rather than from an extracted segment
+func largeTIFF(size int64, seq uint64) io.Reader {
+	return largeUpload([]byte{'I', 'I', 0x2A, 0, 8, 0, 0, 0, 0, 0, 0, 0, 0, 0}, size, seq)
+}
+
+// allocatedPerUpload stores n uploads of size bytes and returns the bytes allocated per upload
+func allocatedPerUpload(tb testing.TB, s *uploaderServiceImpl, fileName string, open func(int64, uint64) io.Reader, size int64, n int, seq *uint64) uint64 {
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	for i := 0; i < n; i++ {
+		*seq++
+		if _, _, err := s.storePhoto(context.Background(), "user-1", fileName, model.PhotoUploadRequest{}, open(size, *seq)); err != nil {
+			tb.Fatalf("storePhoto: %v", err)
+		}
+	}
+	runtime.ReadMemStats(&after)
+	return (after.TotalAlloc - before.TotalAlloc) / uint64(n)
+}
+
+// BenchmarkStorePhotoStreaming streams uploads of growing size through storePhoto and fails
+// if memory per upload grows with the payload, which would mean the file is being buffered.
+// JPEG metadata is read from its segments, TIFF metadata by the EXIF decoder from the stream.
+// See BenchmarkStageBlocksStreaming for the Blob Storage side of the stream.
+func BenchmarkStorePhotoStreaming(b *testing.B) {
+	s, _, blobs, _ := newTestUploader()
+	blobs.discard = true
+	var seq uint64
+
+	formats := []struct {
+		fileName string
+		open     func(int64, uint64) io.Reader
+	}{
+		{"large.jpg", largeJPEG},
+		{"large.tif", largeTIFF},
+	}
+	for _, format := range formats {
+		baseline := allocatedPerUpload(b, s, format.fileName, format.open, 4<<20, 3, &seq)
+		for _, size := range []int64{16 << 20, 128 << 20} {
+			b.Run(fmt.Sprintf("%s/%dMB", format.fileName, size>>20), func(b *testing.B) {
+				b.ReportAllocs()
+				b.SetBytes(size)
+				b.ResetTimer()
+				perUpload := allocatedPerUpload(b, s, format.fileName, format.open, size, b.N, &seq)
+				// Allow for noise, but a buffered payload would exceed this by far
+				if limit := 2*baseline + 1<<20; perUpload > limit {
+					b.Fatalf("%d MB upload allocated %d bytes, baseline for 4 MB is %d", size>>20, perUpload, baseline)
+				}
+			})
+		}
+	}
+}
+
+// TestMutationsInvalidateUserCaches checks that every change to a user's photos clears all of
+// read-service's per-user caches, since memories and similar photos embed whole photos
+func TestMutationsInvalidateUserCaches(t *testing.T) {
+	title := "Harbour"
+	shared := true
+	tests := []struct {
+		name   string
+		mutate func(s *uploaderServiceImpl) error
+	}{
+		{"upload", func(s *uploaderServiceImpl) error {
+			_, _, err := s.UploadPhoto(context.Background(), "user-1", "new.jpg", model.PhotoUploadRequest{}, largeJPEG(1<<10, 1))
+			return err
+		}},
+		{"details", func(s *uploaderServiceImpl) error {
+			_, err := s.UpdatePhotoDetails(context.Background(), "user-1", "photo-1", model.PhotoUpdateRequest{Title: &title})
+			return err
+		}},
+		{"capture date", func(s *uploaderServiceImpl) error {
+			_, err := s.UpdateCaptureDate(context.Background(), "user-1", "photo-1", model.CaptureDateRequest{DateTime: "2024-01-02T15:04:05Z"})
+			return err
+		}},
+		{"privacy", func(s *uploaderServiceImpl) error {
+			_, err := s.UpdatePhotoPrivacy(context.Background(), "user-1", "photo-1", model.PhotoPrivacyRequest{Shared: &shared})
+			return err
+		}},
+		{"delete", func(s *uploaderServiceImpl) error {
+			_, err := s.DeletePhoto(context.Background(), "user-1", "photo-1")
+			return err
+		}},
+		{"processing failure", func(s *uploaderServiceImpl) error {
+			s.RecordProcessingFailure(context.Background(), model.ProcessingJob{PhotoID: "photo-1", UserID: "user-1"}, 5, "broken", true)
+			return nil
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, cosmos, blobs, redis := newTestUploader()
+			photo := addPendingPhoto(t, cosmos, blobs)
+			photo.Status = model.PhotoStatusReady
+			photo.PrivacyMode = model.PrivacyModeNone
+			cosmos.photos[photo.PhotoID] = photo
+
+			if err := tt.mutate(s); err != nil {
+				t.Fatalf("mutation failed: %v", err)
+			}
+			for _, cache := range []string{"gallery", "timeline", "memories", "similar"} {
+				if redis.cleared[cache+":user-1"] == 0 {
+					t.Errorf("%s cache was not invalidated", cache)
+				}
+			}
+		})
+	}
+}
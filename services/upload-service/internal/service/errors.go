@@ -0,0 +1,57 @@
+package service
+
+import "errors"
+
+// Sentinel errors returned by UploaderService so handlers can map them to HTTP status codes
+var (
+	// ErrInvalidPhotoDetails is returned when title, description or alt text fail validation
+	ErrInvalidPhotoDetails = errors.New("invalid photo details")
+
+	// ErrUnsupportedMediaType is returned when the uploaded bytes are not an accepted image type
+	ErrUnsupportedMediaType = errors.New("unsupported media type")
+
+	// ErrInvalidPrivacySettings is returned when a privacy mode is unknown or a privacy update is empty
+	ErrInvalidPrivacySettings = errors.New("invalid privacy settings")
+
+	// ErrInvalidCaptureDate is returned when a capture date correction cannot be parsed
+	ErrInvalidCaptureDate = errors.New("invalid capture date")
+
+	// ErrInvalidChecksum is returned when an upload check lists malformed or too many hashes
+	ErrInvalidChecksum = errors.New("invalid checksum")
+
+	// ErrInvalidPagination is returned when a page size or cursor is invalid
+	ErrInvalidPagination = errors.New("invalid pagination")
+
+	// ErrPhotoNotFound is returned when the requested photo does not exist
+	ErrPhotoNotFound = errors.New("photo not found")
+
+	// ErrPhotoForbidden is returned when the photo belongs to another user
+	ErrPhotoForbidden = errors.New("photo belongs to another user")
+
+	// ErrPhotoProcessing is returned when a change would race with the photo's background processing
+	ErrPhotoProcessing = errors.New("photo is still being processed")
+
+	// ErrPartialDeletion is returned when some of a photo's blobs could not be removed
+	ErrPartialDeletion = errors.New("photo deletion incomplete")
+
+	// ErrUploadNotFound is returned when a resumable upload is unknown or expired
+	ErrUploadNotFound = errors.New("upload not found")
+
+	// ErrUploadForbidden is returned when a resumable upload belongs to another user
+	ErrUploadForbidden = errors.New("upload belongs to another user")
+
+	// ErrUploadOffsetMismatch is returned when a chunk does not start at the current offset
+	ErrUploadOffsetMismatch = errors.New("upload offset mismatch")
+
+	// ErrUploadLocked is returned when another request is writing to the same upload
+	ErrUploadLocked = errors.New("upload is locked by another request")
+
+	// ErrIdempotencyKeyMismatch is returned when an Idempotency-Key is reused for a different request
+	ErrIdempotencyKeyMismatch = errors.New("idempotency key was used for a different request")
+
+	// ErrIdempotencyKeyInFlight is returned when the first request with an Idempotency-Key has not finished
+	ErrIdempotencyKeyInFlight = errors.New("request with this idempotency key is still in progress")
+
+	// ErrUploadTooLarge is returned when an upload exceeds its declared or maximum size
+	ErrUploadTooLarge = errors.New("upload exceeds allowed size")
+)
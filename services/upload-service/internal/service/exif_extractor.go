@@ -1,8 +1,16 @@
 package service
 
 import (
+	"bufio"
+	"bytes"
+	"fmt"
 	"io"
 	"log"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/rwcarlsen/goexif/exif"
 	"github.com/rwcarlsen/goexif/tiff"
@@ -10,90 +18,518 @@ import (
 )
 
 // ExifExtractor handles extraction of photo metadata from image files
-type ExifExtractor struct{}
+type ExifExtractor struct {
+	zones TimeZoneLocator
+}
+
+// TimeZoneLocator resolves the time zone in effect at a position
+type TimeZoneLocator interface {
+	TimeZone(lat, lng float64) *time.Location
+}
 
-func NewExifExtractor() *ExifExtractor {
-	return &ExifExtractor{}
+// NewExifExtractor creates an extractor; zones may be nil, in which case capture times
+// without an EXIF offset or GPS timestamp are taken as UTC
+func NewExifExtractor(zones TimeZoneLocator) *ExifExtractor {
+	return &ExifExtractor{zones: zones}
 }
 
-// ExtractMetadata reads EXIF data from image file and returns PhotoMetadata
+// EXIF 2.31 timezone tags, not known to goexif
+const (
+	offsetTimeField          exif.FieldName = "OffsetTime"
+	offsetTimeOriginalField  exif.FieldName = "OffsetTimeOriginal"
+	offsetTimeDigitizedField exif.FieldName = "OffsetTimeDigitized"
+)
+
+var offsetTimeFields = map[uint16]exif.FieldName{
+	0x9010: offsetTimeField,
+	0x9011: offsetTimeOriginalField,
+	0x9012: offsetTimeDigitizedField,
+}
+
+// exifScanLimit bounds how much of a TIFF or other non-JPEG/PNG file is handed to exif.Decode,
+// which reads its input whole. Tags stored past it are not read.
+const exifScanLimit = 1 << 20
+
+// ExtractMetadata reads EXIF, IPTC and XMP metadata from an image file and returns PhotoMetadata.
+// JPEG and PNG files are read only up to the start of the image data, other formats only up to
+// exifScanLimit. Without an EXIF
+// capture time, dates from XMP and PNG text and time chunks are used instead.
 func (e *ExifExtractor) ExtractMetadata(imageData io.Reader) model.PhotoMetadata {
 	metadata := model.PhotoMetadata{}
+	var candidates []dateCandidate
 
-	exifData, err := exif.Decode(imageData)
-	if err != nil {
+	br := bufio.NewReader(imageData)
+	exifSource := io.LimitReader(br, exifScanLimit)
+	head, _ := br.Peek(len(pngSignature))
+	switch {
+	case bytes.HasPrefix(head, []byte{0xFF, 0xD8}):
+		segments, err := readJPEGMetadata(br)
+		if err != nil {
+			log.Printf("[EXIF] Could not read JPEG segments: %v", err)
+		}
+		if segments.iptc != nil {
+			iptc := parseIPTC(segments.iptc)
+			metadata.Keywords = mergeKeywords(metadata.Keywords, iptc.keywords...)
+			metadata.Caption = iptc.caption
+		}
+		candidates = append(candidates, applyXMP(segments.xmp, &metadata)...)
+		exifSource = nil
+		if segments.exif != nil {
+			exifSource = bytes.NewReader(segments.exif)
+		}
+
+	case bytes.Equal(head, pngSignature):
+		chunks, err := readPNGMetadata(br)
+		if err != nil {
+			log.Printf("[EXIF] Could not read PNG chunks: %v", err)
+		}
+		candidates = append(candidates, applyXMP(chunks.xmp, &metadata)...)
+		if c, ok := parseEmbeddedDate(chunks.created, model.DateSourcePNGText, model.DateConfidenceMedium); ok {
+			candidates = append(candidates, c)
+		}
+		if !chunks.modified.IsZero() && plausibleCaptureDate(chunks.modified) {
+			candidates = append(candidates, dateCandidate{
+				wall:       chunks.modified,
+				offset:     "+00:00",
+				source:     model.DateSourcePNGTime,
+				confidence: model.DateConfidenceLow,
+			})
+		}
+		exifSource = nil
+		if chunks.exif != nil {
+			exifSource = bytes.NewReader(chunks.exif)
+		}
+	}
+
+	if exifSource == nil {
+		log.Printf("[EXIF] No EXIF segment found")
+	} else if exifData, err := decodeExif(exifSource); err != nil {
 		log.Printf("[EXIF] Could not decode EXIF data: %v", err)
-		return metadata
+	} else {
+		applyExif(exifData, &metadata)
+		e.applyCaptureTime(exifData, &metadata)
+	}
+
+	// Candidates are applied after EXIF so GPS can place their wall-clock times
+	for _, c := range candidates {
+		e.offerCaptureDate(c, &metadata)
+	}
+
+	log.Printf("[EXIF] Successfully extracted metadata: %+v", metadata)
+	return metadata
+}
+
+// applyXMP copies the descriptive XMP properties into metadata and returns its capture date, if any
+func applyXMP(packet []byte, metadata *model.PhotoMetadata) []dateCandidate {
+	if packet == nil {
+		return nil
 	}
+	xmp := parseXMP(packet)
+	metadata.Keywords = mergeKeywords(metadata.Keywords, xmp.keywords...)
+	if metadata.Caption == "" {
+		metadata.Caption = xmp.description
+	}
+	metadata.Rating = xmp.rating
+	metadata.Label = xmp.label
 
-	// Camera Make
-	if make, err := exifData.Get(exif.Make); err == nil {
-		metadata.CameraMake = sanitizeString(make)
+	if c, ok := parseEmbeddedDate(xmp.created, model.DateSourceXMP, model.DateConfidenceHigh); ok {
+		return []dateCandidate{c}
 	}
+	return nil
+}
 
-	// Camera Model
-	if model, err := exifData.Get(exif.Model); err == nil {
-		metadata.CameraModel = sanitizeString(model)
+// decodeExif decodes EXIF data and additionally loads the timezone offset tags
+func decodeExif(r io.Reader) (*exif.Exif, error) {
+	exifData, err := exif.Decode(r)
+	if err != nil {
+		return nil, err
 	}
 
-	// Lens Model
-	if lens, err := exifData.Get(exif.LensModel); err == nil {
-		metadata.LensModel = sanitizeString(lens)
+	// Reload the Exif sub-IFD with the field map goexif lacks
+	if ptr, err := exifData.Get(exif.ExifIFDPointer); err == nil {
+		if offset, err := ptr.Int64(0); err == nil {
+			// Value offsets are relative to the start of the TIFF data, so seek rather than slice
+			r := bytes.NewReader(exifData.Raw)
+			if _, err := r.Seek(offset, io.SeekStart); err == nil {
+				if dir, _, err := tiff.DecodeDir(r, exifData.Tiff.Order); err == nil {
+					exifData.LoadTags(dir, offsetTimeFields, false)
+				}
+			}
+		}
 	}
+	return exifData, nil
+}
 
-	// Focal Length
-	if fl, err := exifData.Get(exif.FocalLength); err == nil {
-		metadata.FocalLength = sanitizeRational(fl)
+// applyExif copies the EXIF tags we keep into metadata, normalizing their values
+func applyExif(exifData *exif.Exif, metadata *model.PhotoMetadata) {
+	// Camera, lens and authorship
+	metadata.CameraMake = exifString(exifData, exif.Make)
+	metadata.CameraModel = exifString(exifData, exif.Model)
+	metadata.LensModel = exifString(exifData, exif.LensModel)
+	metadata.LensMake = exifString(exifData, exif.LensMake)
+	metadata.Software = exifString(exifData, exif.Software)
+	metadata.Artist = exifString(exifData, exif.Artist)
+	metadata.Copyright = exifString(exifData, exif.Copyright)
+
+	// Focal length, actual and 35mm-equivalent
+	if v, ok := exifFloat(exifData, exif.FocalLength); ok && v > 0 {
+		metadata.FocalLengthMM = roundTo(v, 1)
+		metadata.FocalLength = formatDecimal(metadata.FocalLengthMM) + "mm"
+	}
+	if v, ok := exifInt(exifData, exif.FocalLengthIn35mmFilm); ok && v > 0 {
+		metadata.FocalLength35mm = v
 	}
 
 	// F Number (Aperture)
-	if fn, err := exifData.Get(exif.FNumber); err == nil {
-		metadata.FNumber = sanitizeRational(fn)
+	if v, ok := exifFloat(exifData, exif.FNumber); ok && v > 0 {
+		metadata.Aperture = roundTo(v, 1)
+		metadata.FNumber = "f/" + formatDecimal(metadata.Aperture)
 	}
 
 	// Exposure Time
-	if et, err := exifData.Get(exif.ExposureTime); err == nil {
-		metadata.ExposureTime = sanitizeRational(et)
+	if tag, err := exifData.Get(exif.ExposureTime); err == nil {
+		if num, den, err := tag.Rat2(0); err == nil && num > 0 && den > 0 {
+			metadata.ExposureSeconds = float64(num) / float64(den)
+			metadata.ExposureTime = formatExposureTime(num, den)
+		}
 	}
 
 	// ISO
-	if iso, err := exifData.Get(exif.ISOSpeedRatings); err == nil {
-		metadata.ISO = sanitizeString(iso)
+	if v, ok := exifInt(exifData, exif.ISOSpeedRatings); ok && v > 0 {
+		metadata.ISOValue = v
+		metadata.ISO = strconv.Itoa(v)
+	}
+
+	// Exposure compensation
+	if v, ok := exifFloat(exifData, exif.ExposureBiasValue); ok {
+		ev := roundTo(v, 1)
+		metadata.ExposureBiasEV = &ev
+		metadata.ExposureBias = formatExposureBias(ev)
+	}
+
+	// Enumerated shooting settings
+	if v, ok := exifInt(exifData, exif.ExposureProgram); ok {
+		metadata.ExposureProgram = exposureProgramNames[v]
+	}
+	if v, ok := exifInt(exifData, exif.MeteringMode); ok {
+		metadata.MeteringMode = meteringModeNames[v]
+	}
+	if v, ok := exifInt(exifData, exif.WhiteBalance); ok {
+		metadata.WhiteBalance = whiteBalanceNames[v]
+	}
+	if v, ok := exifInt(exifData, exif.Flash); ok {
+		fired := v&0x01 != 0
+		metadata.FlashFired = &fired
+		metadata.Flash = describeFlash(v)
+	}
+
+	// Pixel dimensions as stored; used when the image header cannot be read
+	if v, ok := exifInt(exifData, exif.PixelXDimension); ok {
+		metadata.Width = v
+	}
+	if v, ok := exifInt(exifData, exif.PixelYDimension); ok {
+		metadata.Height = v
 	}
 
-	// DateTime Original (photo capture time)
-	if _, err := exifData.Get(exif.DateTimeOriginal); err == nil {
-		if dateTime, err := exifData.DateTime(); err == nil {
-			metadata.DateTimeOriginal = dateTime
+	// Orientation (1 = upright; 2-8 = mirrored and/or rotated)
+	if v, ok := exifInt(exifData, exif.Orientation); ok && v >= 1 && v <= 8 {
+		metadata.Orientation = v
+	}
+
+	// Timezone offsets ("+09:00") of DateTime, DateTimeOriginal and DateTimeDigitized
+	metadata.OffsetTime = exifOffset(exifData, offsetTimeField)
+	metadata.OffsetTimeOriginal = exifOffset(exifData, offsetTimeOriginalField)
+	metadata.OffsetTimeDigitized = exifOffset(exifData, offsetTimeDigitizedField)
+
+	// GPS position
+	metadata.GPS = extractGPS(exifData)
+}
+
+// exifDateTimeLayout is the format of DateTimeOriginal: local wall-clock time without a zone
+const exifDateTimeLayout = "2006:01:02 15:04:05"
+
+// applyCaptureTime resolves DateTimeOriginal, a wall-clock time, to a UTC instant. The zone
+// comes from OffsetTimeOriginal, else the offset between the wall clock and the UTC GPS
+// timestamp, else the GPS position; without any of them the wall clock is taken as UTC.
+func (e *ExifExtractor) applyCaptureTime(exifData *exif.Exif, metadata *model.PhotoMetadata) {
+	c := dateCandidate{source: model.DateSourceExif, confidence: model.DateConfidenceHigh}
+	raw := exifString(exifData, exif.DateTimeOriginal)
+	if raw == "" {
+		// DateTime is when the file was last changed, which is often but not always the capture
+		raw = exifString(exifData, exif.DateTime)
+		c.confidence = model.DateConfidenceMedium
+	}
+	wall, err := time.ParseInLocation(exifDateTimeLayout, raw, time.UTC)
+	if err != nil {
+		return
+	}
+	if sub := exifString(exifData, exif.SubSecTimeOriginal); sub != "" {
+		if frac, err := strconv.ParseFloat("0."+sub, 64); err == nil {
+			wall = wall.Add(time.Duration(frac * float64(time.Second)))
 		}
 	}
 
-	log.Printf("[EXIF] Successfully extracted metadata: %+v", metadata)
-	return metadata
+	c.wall = wall
+	e.setCaptureTime(c, metadata)
 }
 
-// Helper functions to safely extract EXIF values
+// captureZone picks the zone of a wall-clock capture time, see applyCaptureTime
+func (e *ExifExtractor) captureZone(wall time.Time, metadata *model.PhotoMetadata) (*time.Location, string, string) {
+	if offset := metadata.OffsetTimeOriginal; offset != "" {
+		if seconds, ok := parseUTCOffset(offset); ok {
+			return time.FixedZone(offset, seconds), offset, model.TimeZoneSourceExif
+		}
+	}
 
-func sanitizeString(tag *tiff.Tag) string {
-	if tag == nil {
-		return ""
+	if gps := metadata.GPS; gps != nil {
+		var placeZone *time.Location
+		if e.zones != nil {
+			placeZone = e.zones.TimeZone(gps.Latitude, gps.Longitude)
+		}
+		// The GPS clock gives the exact offset in effect, while the place zone is the zone of the
+		// nearest known place and can be wrong near zone borders, so the place zone only names
+		// the offset when it agrees and stands in for it, marked approximate, when there is no GPS time
+		if gps.Timestamp != nil {
+			// Offsets are whole quarter hours; anything beyond +-14h means a stale GPS fix
+			diff := wall.Sub(*gps.Timestamp).Round(15 * time.Minute)
+			if diff >= -14*time.Hour && diff <= 14*time.Hour {
+				seconds := int(diff.Seconds())
+				if placeZone != nil {
+					if _, placeOffset := wall.Add(-diff).In(placeZone).Zone(); placeOffset == seconds {
+						return placeZone, placeZone.String(), model.TimeZoneSourceGPSLocation
+					}
+				}
+				name := formatUTCOffset(seconds)
+				return time.FixedZone(name, seconds), name, model.TimeZoneSourceGPSTime
+			}
+		}
+		if placeZone != nil {
+			return placeZone, placeZone.String(), model.TimeZoneSourceGPSLocationApprox
+		}
 	}
-	if str, err := tag.StringVal(); err == nil {
-		return str
+
+	return time.UTC, "", model.TimeZoneSourceUnknown
+}
+
+// parseUTCOffset parses "+09:00" style offsets into seconds east of UTC
+func parseUTCOffset(offset string) (int, bool) {
+	if !offsetPattern.MatchString(offset) {
+		return 0, false
 	}
-	return tag.String()
+	hours, _ := strconv.Atoi(offset[1:3])
+	minutes, _ := strconv.Atoi(offset[4:6])
+	seconds := hours*3600 + minutes*60
+	if offset[0] == '-' {
+		seconds = -seconds
+	}
+	return seconds, true
 }
 
-func sanitizeRational(tag *tiff.Tag) string {
-	if tag == nil {
+// formatUTCOffset formats seconds east of UTC as "+09:00"
+func formatUTCOffset(seconds int) string {
+	sign := '+'
+	if seconds < 0 {
+		sign = '-'
+		seconds = -seconds
+	}
+	return fmt.Sprintf("%c%02d:%02d", sign, seconds/3600, seconds%3600/60)
+}
+
+// extractGPS reads latitude, longitude, altitude and GPS timestamp; returns nil without a valid fix
+func extractGPS(exifData *exif.Exif) *model.GPSInfo {
+	lat, lng, err := exifData.LatLong()
+	if err != nil || math.IsNaN(lat) || math.IsNaN(lng) || lat < -90 || lat > 90 || lng < -180 || lng > 180 {
+		return nil
+	}
+	// Cameras without a fix sometimes write 0/0
+	if lat == 0 && lng == 0 {
+		return nil
+	}
+	gps := &model.GPSInfo{Latitude: lat, Longitude: lng}
+
+	if alt, err := exifData.Get(exif.GPSAltitude); err == nil {
+		if r, err := alt.Rat(0); err == nil {
+			meters, _ := r.Float64()
+			// GPSAltitudeRef 1 means below sea level
+			if ref, err := exifData.Get(exif.GPSAltitudeRef); err == nil {
+				if v, err := ref.Int(0); err == nil && v == 1 {
+					meters = -meters
+				}
+			}
+			gps.Altitude = &meters
+		}
+	}
+
+	if ts, ok := gpsTimestamp(exifData); ok {
+		gps.Timestamp = &ts
+	}
+	return gps
+}
+
+// gpsTimestamp combines GPSDateStamp ("2006:01:02") and GPSTimeStamp (h, m, s rationals) into a UTC time
+func gpsTimestamp(exifData *exif.Exif) (time.Time, bool) {
+	dateTag, err := exifData.Get(exif.GPSDateStamp)
+	if err != nil {
+		return time.Time{}, false
+	}
+	dateStr, err := dateTag.StringVal()
+	if err != nil {
+		return time.Time{}, false
+	}
+	date, err := time.Parse("2006:01:02", strings.TrimSpace(strings.TrimRight(dateStr, "\x00")))
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	timeTag, err := exifData.Get(exif.GPSTimeStamp)
+	if err != nil {
+		return date, true
+	}
+	var parts [3]float64
+	for i := range parts {
+		r, err := timeTag.Rat(i)
+		if err != nil {
+			return date, true
+		}
+		parts[i], _ = r.Float64()
+	}
+	offset := time.Duration(parts[0]*float64(time.Hour) + parts[1]*float64(time.Minute) + parts[2]*float64(time.Second))
+	return date.Add(offset), true
+}
+
+// Names of enumerated EXIF values; unknown values map to ""
+var (
+	exposureProgramNames = map[int]string{
+		1: "Manual",
+		2: "Program AE",
+		3: "Aperture priority",
+		4: "Shutter priority",
+		5: "Creative program",
+		6: "Action program",
+		7: "Portrait mode",
+		8: "Landscape mode",
+	}
+	meteringModeNames = map[int]string{
+		1:   "Average",
+		2:   "Center-weighted average",
+		3:   "Spot",
+		4:   "Multi-spot",
+		5:   "Multi-segment",
+		6:   "Partial",
+		255: "Other",
+	}
+	whiteBalanceNames = map[int]string{
+		0: "Auto",
+		1: "Manual",
+	}
+)
+
+// offsetPattern matches EXIF timezone offsets such as "+09:00"
+var offsetPattern = regexp.MustCompile(`^[+-](?:0\d|1[0-4]):[0-5]\d$`)
+
+// describeFlash turns the EXIF Flash bit field into text, e.g. "Fired, auto mode, return detected"
+func describeFlash(v int) string {
+	if v&0x20 != 0 {
+		return "No flash function"
+	}
+	parts := []string{"Did not fire"}
+	if v&0x01 != 0 {
+		parts[0] = "Fired"
+	}
+	switch (v >> 3) & 0x03 {
+	case 1:
+		parts = append(parts, "compulsory")
+	case 2:
+		parts = append(parts, "suppressed")
+	case 3:
+		parts = append(parts, "auto mode")
+	}
+	switch (v >> 1) & 0x03 {
+	case 2:
+		parts = append(parts, "return not detected")
+	case 3:
+		parts = append(parts, "return detected")
+	}
+	if v&0x40 != 0 {
+		parts = append(parts, "red-eye reduction")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// formatExposureTime renders exposure times below one second as fractions ("1/125s")
+// and longer ones as decimals ("2.5s")
+func formatExposureTime(num, den int64) string {
+	if num >= den {
+		return formatDecimal(roundTo(float64(num)/float64(den), 1)) + "s"
+	}
+	return fmt.Sprintf("1/%ds", int64(math.Round(float64(den)/float64(num))))
+}
+
+// formatExposureBias renders exposure compensation with an explicit sign ("+0.7 EV", "0 EV")
+func formatExposureBias(ev float64) string {
+	switch {
+	case ev > 0:
+		return "+" + formatDecimal(ev) + " EV"
+	case ev < 0:
+		return "-" + formatDecimal(-ev) + " EV"
+	}
+	return "0 EV"
+}
+
+// formatDecimal prints v without trailing zeros
+func formatDecimal(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func roundTo(v float64, decimals int) float64 {
+	scale := math.Pow(10, float64(decimals))
+	return math.Round(v*scale) / scale
+}
+
+// Helper functions to safely extract EXIF values
+
+func exifString(exifData *exif.Exif, name exif.FieldName) string {
+	tag, err := exifData.Get(name)
+	if err != nil {
 		return ""
 	}
-	rational, err := tag.Rat(0)
+	return strings.TrimSpace(strings.TrimRight(sanitizeString(tag), "\x00"))
+}
+
+func exifInt(exifData *exif.Exif, name exif.FieldName) (int, bool) {
+	tag, err := exifData.Get(name)
 	if err != nil {
-		return tag.String()
+		return 0, false
 	}
-	if rational != nil {
-		return rational.String()
+	v, err := tag.Int(0)
+	return v, err == nil
+}
+
+func exifFloat(exifData *exif.Exif, name exif.FieldName) (float64, bool) {
+	tag, err := exifData.Get(name)
+	if err != nil {
+		return 0, false
+	}
+	num, den, err := tag.Rat2(0)
+	if err != nil || den == 0 {
+		return 0, false
+	}
+	return float64(num) / float64(den), true
+}
+
+func exifOffset(exifData *exif.Exif, name exif.FieldName) string {
+	if v := exifString(exifData, name); offsetPattern.MatchString(v) {
+		return v
 	}
 	return ""
 }
+
+func sanitizeString(tag *tiff.Tag) string {
+	if tag == nil {
+		return ""
+	}
+	if str, err := tag.StringVal(); err == nil {
+		return str
+	}
+	return tag.String()
+}
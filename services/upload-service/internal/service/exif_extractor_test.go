@@ -0,0 +1,53 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"seungpyolee.com/pkg/model"
+)
+
+type fixedZoneLocator struct {
+	loc *time.Location
+}
+
+func (l fixedZoneLocator) TimeZone(lat, lng float64) *time.Location {
+	return l.loc
+}
+
+func TestCaptureZone(t *testing.T) {
+	seoul, err := time.LoadLocation("Asia/Seoul")
+	if err != nil {
+		t.Skip("tzdata not available:", err)
+	}
+	wall := time.Date(2024, 5, 1, 18, 0, 0, 0, time.UTC)
+	gpsAt := func(offset time.Duration) *model.GPSInfo {
+		ts := wall.Add(-offset)
+		return &model.GPSInfo{Latitude: 37.5, Longitude: 127, Timestamp: &ts}
+	}
+
+	tests := []struct {
+		name       string
+		zones      TimeZoneLocator
+		metadata   model.PhotoMetadata
+		wantName   string
+		wantSource string
+	}{
+		{"exif offset wins", fixedZoneLocator{seoul}, model.PhotoMetadata{OffsetTimeOriginal: "-05:00", GPS: gpsAt(9 * time.Hour)}, "-05:00", model.TimeZoneSourceExif},
+		{"place zone agrees with gps time", fixedZoneLocator{seoul}, model.PhotoMetadata{GPS: gpsAt(9 * time.Hour)}, "Asia/Seoul", model.TimeZoneSourceGPSLocation},
+		{"gps time beats disagreeing place zone", fixedZoneLocator{seoul}, model.PhotoMetadata{GPS: gpsAt(8 * time.Hour)}, "+08:00", model.TimeZoneSourceGPSTime},
+		{"gps time without locator", nil, model.PhotoMetadata{GPS: gpsAt(-3*time.Hour - 30*time.Minute)}, "-03:30", model.TimeZoneSourceGPSTime},
+		{"stale gps time falls back to place zone", fixedZoneLocator{seoul}, model.PhotoMetadata{GPS: gpsAt(30 * time.Hour)}, "Asia/Seoul", model.TimeZoneSourceGPSLocationApprox},
+		{"place zone without gps time", fixedZoneLocator{seoul}, model.PhotoMetadata{GPS: &model.GPSInfo{Latitude: 37.5, Longitude: 127}}, "Asia/Seoul", model.TimeZoneSourceGPSLocationApprox},
+		{"nothing known", nil, model.PhotoMetadata{}, "", model.TimeZoneSourceUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewExifExtractor(tt.zones)
+			_, name, source := e.captureZone(wall, &tt.metadata)
+			if name != tt.wantName || source != tt.wantSource {
+				t.Fatalf("captureZone() = %q, %q; want %q, %q", name, source, tt.wantName, tt.wantSource)
+			}
+		})
+	}
+}
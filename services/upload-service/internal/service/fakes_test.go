@@ -0,0 +1,422 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"seungpyolee.com/pkg/model"
+	"seungpyolee.com/services/upload-service/internal/repository"
+)
+
+// In-memory repositories for service tests. Methods a test does not need are left to the
+// embedded nil interface and panic if called.
+
+type fakeCosmosRepo struct {
+	repository.CosmosDBRepository
+	mu           sync.Mutex
+	photos       map[string]model.Photo
+	privacyModes map[string]string
+	privacyVers  map[string]int64
+}
+
+func newFakeCosmosRepo() *fakeCosmosRepo {
+	return &fakeCosmosRepo{
+		photos:       make(map[string]model.Photo),
+		privacyModes: make(map[string]string),
+		privacyVers:  make(map[string]int64),
+	}
+}
+
+func (f *fakeCosmosRepo) SavePhoto(ctx context.Context, photo model.Photo) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, p := range f.photos {
+		if p.UserID == photo.UserID && p.Checksum == photo.Checksum {
+			return repository.ErrDuplicatePhoto
+		}
+	}
+	f.photos[photo.PhotoID] = photo
+	return nil
+}
+
+func (f *fakeCosmosRepo) GetPhotoByID(ctx context.Context, photoID string) (model.Photo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.photos[photoID], nil
+}
+
+func (f *fakeCosmosRepo) FindPhotoIDsByChecksum(ctx context.Context, userID string, checksums []string) (map[string]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	found := make(map[string]string)
+	for _, p := range f.photos {
+		for _, c := range checksums {
+			if p.UserID == userID && p.Checksum == c && p.Status != model.PhotoStatusFailed {
+				found[c] = p.PhotoID
+			}
+		}
+	}
+	return found, nil
+}
+
+func (f *fakeCosmosRepo) DeleteFailedPhotoByChecksum(ctx context.Context, userID, checksum string) (model.Photo, bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for id, p := range f.photos {
+		if p.UserID == userID && p.Checksum == checksum && p.Status == model.PhotoStatusFailed {
+			delete(f.photos, id)
+			return p, true, nil
+		}
+	}
+	return model.Photo{}, false, nil
+}
+
+func (f *fakeCosmosRepo) DeletePhoto(ctx context.Context, userID, photoID string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p, ok := f.photos[photoID]
+	if !ok || p.UserID != userID {
+		return false, nil
+	}
+	delete(f.photos, photoID)
+	return true, nil
+}
+
+// GetPhotosPage lists newest uploads first, like the real repository
+func (f *fakeCosmosRepo) GetPhotosPage(ctx context.Context, userID string, after *model.PhotoCursor, limit int64) ([]model.Photo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var photos []model.Photo
+	for _, p := range f.photos {
+		if p.UserID != userID {
+			continue
+		}
+		if after != nil {
+			at := after.Value.(time.Time)
+			if !p.UploadedAt.Before(at) && !(p.UploadedAt.Equal(at) && p.PhotoID < after.PhotoID) {
+				continue
+			}
+		}
+		photos = append(photos, p)
+	}
+	slices.SortFunc(photos, func(a, b model.Photo) int {
+		if c := b.UploadedAt.Compare(a.UploadedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(b.PhotoID, a.PhotoID)
+	})
+	if int64(len(photos)) > limit {
+		photos = photos[:limit]
+	}
+	return photos, nil
+}
+
+func (f *fakeCosmosRepo) UpdatePhotoPrivacy(ctx context.Context, photo model.Photo) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if p, ok := f.photos[photo.PhotoID]; ok {
+		p.Shared, p.PrivacyMode, p.Variants = photo.Shared, photo.PrivacyMode, photo.Variants
+		p.AppliedPrivacy, p.AppliedPrivacyVersion = photo.AppliedPrivacy, photo.AppliedPrivacyVersion
+		f.photos[photo.PhotoID] = p
+	}
+	return nil
+}
+
+func (f *fakeCosmosRepo) SaveAppliedPrivacy(ctx context.Context, photo model.Photo) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p, ok := f.photos[photo.PhotoID]
+	if !ok || p.PrivacyMode != "" || p.AppliedPrivacyVersion >= photo.AppliedPrivacyVersion {
+		return false, nil
+	}
+	p.Variants, p.AppliedPrivacy, p.AppliedPrivacyVersion = photo.Variants, photo.AppliedPrivacy, photo.AppliedPrivacyVersion
+	f.photos[photo.PhotoID] = p
+	return true, nil
+}
+
+func (f *fakeCosmosRepo) UpdatePhotoMetadata(ctx context.Context, photoID string, metadata model.PhotoMetadata) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p, ok := f.photos[photoID]
+	if !ok {
+		return repository.ErrPhotoNotFound
+	}
+	p.Metadata = metadata
+	f.photos[photoID] = p
+	return nil
+}
+
+func (f *fakeCosmosRepo) UpdatePhotoDetails(ctx context.Context, photoID string, update model.PhotoUpdateRequest) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p, ok := f.photos[photoID]
+	if !ok {
+		return repository.ErrPhotoNotFound
+	}
+	if update.Title != nil {
+		p.Title = *update.Title
+	}
+	f.photos[photoID] = p
+	return nil
+}
+
+func (f *fakeCosmosRepo) UpdatePhotoStatus(ctx context.Context, photoID, status string, attempts int, processingError string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p, ok := f.photos[photoID]
+	if !ok {
+		return false, nil
+	}
+	p.Status, p.ProcessingAttempts, p.ProcessingError = status, attempts, processingError
+	f.photos[photoID] = p
+	return true, nil
+}
+
+func (f *fakeCosmosRepo) SaveProcessedPhoto(ctx context.Context, photo model.Photo) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p, ok := f.photos[photo.PhotoID]
+	if !ok || p.Status == model.PhotoStatusFailed {
+		return false, nil
+	}
+	photo.Status = model.PhotoStatusReady
+	f.photos[photo.PhotoID] = photo
+	return true, nil
+}
+
+func (f *fakeCosmosRepo) GetUserPrivacyMode(ctx context.Context, userID string) (string, int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.privacyModes[userID], f.privacyVers[userID], nil
+}
+
+func (f *fakeCosmosRepo) SetUserPrivacyMode(ctx context.Context, userID, mode string) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.privacyModes[userID] = mode
+	f.privacyVers[userID]++
+	return f.privacyVers[userID], nil
+}
+
+// fakeBlobRepo keeps blobs in memory, or only counts their bytes when discard is set.
+// Staged blocks are kept per block ID until committed.
+type fakeBlobRepo struct {
+	repository.AzureBlobRepository
+	mu      sync.Mutex
+	blobs   map[string][]byte
+	blocks  map[string][]byte
+	commits int
+	discard bool
+	failing string // Uploads to this blob name fail
+}
+
+func newFakeBlobRepo() *fakeBlobRepo {
+	return &fakeBlobRepo{blobs: make(map[string][]byte), blocks: make(map[string][]byte)}
+}
+
+// fakeBlockSize is small so tests stage several blocks per chunk
+const fakeBlockSize = 4
+
+func (f *fakeBlobRepo) StageBlocks(ctx context.Context, blobName string, firstBlock int, fileData io.Reader) ([]string, int64, error) {
+	var blockIDs []string
+	var size int64
+	buf := make([]byte, fakeBlockSize)
+	for {
+		n, readErr := io.ReadFull(fileData, buf)
+		if n > 0 {
+			blockID := fmt.Sprintf("%s#%d", blobName, firstBlock+len(blockIDs))
+			f.mu.Lock()
+			f.blocks[blockID] = bytes.Clone(buf[:n])
+			f.mu.Unlock()
+			blockIDs = append(blockIDs, blockID)
+			size += int64(n)
+		}
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			return blockIDs, size, nil
+		}
+		if readErr != nil {
+			return blockIDs, size, readErr
+		}
+	}
+}
+
+func (f *fakeBlobRepo) CommitBlocks(ctx context.Context, blobName string, blockIDs []string, contentType string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var data []byte
+	for _, id := range blockIDs {
+		block, ok := f.blocks[id]
+		if !ok {
+			return "", fmt.Errorf("block %s was not staged", id)
+		}
+		data = append(data, block...)
+	}
+	for id := range f.blocks {
+		if strings.HasPrefix(id, blobName+"#") {
+			delete(f.blocks, id)
+		}
+	}
+	f.blobs[blobName] = data
+	f.commits++
+	return "https://blob.test/" + blobName, nil
+}
+
+func (f *fakeBlobRepo) UploadBlob(ctx context.Context, blobName string, fileData io.Reader, contentType string) (string, error) {
+	url, _, err := f.UploadBlobStream(ctx, blobName, fileData, contentType)
+	return url, err
+}
+
+func (f *fakeBlobRepo) UploadBlobStream(ctx context.Context, blobName string, fileData io.Reader, contentType string) (string, int64, error) {
+	if blobName == f.failing {
+		return "", 0, fmt.Errorf("upload of %s failed", blobName)
+	}
+	if f.discard {
+		n, err := io.Copy(io.Discard, fileData)
+		return "https://blob.test/" + blobName, n, err
+	}
+	data, err := io.ReadAll(fileData)
+	if err != nil {
+		return "", 0, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.blobs[blobName] = data
+	return "https://blob.test/" + blobName, int64(len(data)), nil
+}
+
+func (f *fakeBlobRepo) OpenBlob(ctx context.Context, blobName string) (io.ReadCloser, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	data, ok := f.blobs[blobName]
+	if !ok {
+		return nil, repository.ErrBlobNotFound
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (f *fakeBlobRepo) DeleteBlob(ctx context.Context, blobName string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.blobs, blobName)
+	return nil
+}
+
+type fakeRedisRepo struct {
+	repository.RedisRepository
+	mu      sync.Mutex
+	jobs    []model.ProcessingJob
+	uploads map[string]model.ResumableUpload
+	locks   map[string]bool
+	cleared map[string]int // Invalidations per "cache:userID"
+}
+
+func (f *fakeRedisRepo) SetResumableUpload(ctx context.Context, upload *model.ResumableUpload) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.uploads == nil {
+		f.uploads = make(map[string]model.ResumableUpload)
+	}
+	stored := *upload
+	stored.BlockIDs = slices.Clone(upload.BlockIDs)
+	f.uploads[upload.UploadID] = stored
+	return nil
+}
+
+func (f *fakeRedisRepo) GetResumableUpload(ctx context.Context, uploadID string) (*model.ResumableUpload, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	upload, ok := f.uploads[uploadID]
+	if !ok {
+		return nil, nil
+	}
+	upload.BlockIDs = slices.Clone(upload.BlockIDs)
+	return &upload, nil
+}
+
+func (f *fakeRedisRepo) DeleteResumableUpload(ctx context.Context, uploadID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.uploads, uploadID)
+	return nil
+}
+
+func (f *fakeRedisRepo) LockResumableUpload(ctx context.Context, uploadID string, ttl time.Duration) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.locks == nil {
+		f.locks = make(map[string]bool)
+	}
+	if f.locks[uploadID] {
+		return false, nil
+	}
+	f.locks[uploadID] = true
+	return true, nil
+}
+
+func (f *fakeRedisRepo) UnlockResumableUpload(ctx context.Context, uploadID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.locks, uploadID)
+	return nil
+}
+
+func (f *fakeRedisRepo) SetPhotoMetadata(ctx context.Context, photoID string, photo *model.Photo) error {
+	return nil
+}
+
+func (f *fakeRedisRepo) DeletePhotoCache(ctx context.Context, photoID string) error {
+	return nil
+}
+
+func (f *fakeRedisRepo) InvalidateGalleryCache(ctx context.Context, userID string) error {
+	f.clear("gallery:" + userID)
+	return nil
+}
+
+func (f *fakeRedisRepo) InvalidateTimelineCache(ctx context.Context, userID string) error {
+	f.clear("timeline:" + userID)
+	return nil
+}
+
+func (f *fakeRedisRepo) InvalidateMemoriesCache(ctx context.Context, userID string) error {
+	f.clear("memories:" + userID)
+	return nil
+}
+
+func (f *fakeRedisRepo) InvalidateSimilarCache(ctx context.Context, userID string) error {
+	f.clear("similar:" + userID)
+	return nil
+}
+
+func (f *fakeRedisRepo) clear(key string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.cleared == nil {
+		f.cleared = make(map[string]int)
+	}
+	f.cleared[key]++
+}
+
+func (f *fakeRedisRepo) EnqueueProcessingJob(ctx context.Context, job *model.ProcessingJob) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.jobs = append(f.jobs, *job)
+	return nil
+}
+
+// newTestUploader wires an uploader to fresh fakes with the default policies and profiles
+func newTestUploader() (*uploaderServiceImpl, *fakeCosmosRepo, *fakeBlobRepo, *fakeRedisRepo) {
+	cosmos, blobs, redis := newFakeCosmosRepo(), newFakeBlobRepo(), &fakeRedisRepo{}
+	policy, err := ParseContentTypePolicy("", "")
+	if err != nil {
+		panic(err)
+	}
+	svc := NewUploaderService(cosmos, blobs, redis, policy, DefaultVariantProfiles(), nil)
+	return svc.(*uploaderServiceImpl), cosmos, blobs, redis
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"seungpyolee.com/pkg/model"
+	"seungpyolee.com/pkg/shared"
+	"seungpyolee.com/services/upload-service/internal/repository"
+)
+
+// idempotencyInFlightTTL bounds how long a request that crashed mid-way blocks its key
+const idempotencyInFlightTTL = 5 * time.Minute
+
+// IdempotencyService remembers requests sent with an Idempotency-Key so that retries replay
+// the first response instead of repeating the mutation. Requests are fingerprinted while they
+// stream, so a key is claimed before its fingerprint is known.
+type IdempotencyService interface {
+	// Begin claims key for a request. It returns nil when the caller should process the
+	// request, the stored record when a request with this key already completed, or
+	// ErrIdempotencyKeyInFlight. A stored record is replayed only if its fingerprint matches;
+	// see Matches.
+	Begin(ctx context.Context, userID, key string) (*model.IdempotencyRecord, error)
+	// Matches returns ErrIdempotencyKeyMismatch unless record was stored for fingerprint
+	Matches(record *model.IdempotencyRecord, fingerprint string) error
+	// Complete stores the response of a request claimed by Begin. Server errors release
+	// the key so the client can retry.
+	Complete(ctx context.Context, userID, key, fingerprint string, statusCode int, header http.Header, body []byte)
+	// Release frees a key claimed by Begin without storing a response
+	Release(ctx context.Context, userID, key string)
+}
+
+type idempotencyServiceImpl struct {
+	redisRepo repository.RedisRepository
+	ttl       time.Duration
+}
+
+// NewIdempotencyService replays responses for ttl after the first request; zero uses shared.IdempotencyKeyTTL
+func NewIdempotencyService(redisRepo repository.RedisRepository, ttl time.Duration) IdempotencyService {
+	if ttl <= 0 {
+		ttl = shared.IdempotencyKeyTTL
+	}
+	return &idempotencyServiceImpl{
+		redisRepo: redisRepo,
+		ttl:       ttl,
+	}
+}
+
+func (s *idempotencyServiceImpl) Begin(ctx context.Context, userID, key string) (*model.IdempotencyRecord, error) {
+	pending := &model.IdempotencyRecord{InFlight: true, CreatedAt: time.Now()}
+	reserved, err := s.redisRepo.ReserveIdempotencyKey(ctx, userID, key, pending, idempotencyInFlightTTL)
+	if err != nil {
+		return nil, err
+	}
+	if reserved {
+		return nil, nil
+	}
+
+	record, err := s.redisRepo.GetIdempotencyRecord(ctx, userID, key)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case record == nil:
+		// Expired or released between the two calls; the client may simply retry
+		return nil, ErrIdempotencyKeyInFlight
+	case record.InFlight:
+		return nil, ErrIdempotencyKeyInFlight
+	}
+	return record, nil
+}
+
+func (s *idempotencyServiceImpl) Matches(record *model.IdempotencyRecord, fingerprint string) error {
+	if record.Fingerprint != fingerprint {
+		return ErrIdempotencyKeyMismatch
+	}
+	return nil
+}
+
+func (s *idempotencyServiceImpl) Complete(ctx context.Context, userID, key, fingerprint string, statusCode int, header http.Header, body []byte) {
+	if statusCode >= http.StatusInternalServerError {
+		s.Release(ctx, userID, key)
+		return
+	}
+
+	record := &model.IdempotencyRecord{
+		Fingerprint: fingerprint,
+		StatusCode:  statusCode,
+		Header:      header,
+		Body:        body,
+		CreatedAt:   time.Now(),
+	}
+	if err := s.redisRepo.SetIdempotencyRecord(ctx, userID, key, record, s.ttl); err != nil {
+		log.Printf("[Service] Failed to store idempotent response: %v (non-fatal)", err)
+	}
+}
+
+func (s *idempotencyServiceImpl) Release(ctx context.Context, userID, key string) {
+	if err := s.redisRepo.DeleteIdempotencyRecord(ctx, userID, key); err != nil {
+		log.Printf("[Service] Failed to release idempotency key: %v (non-fatal)", err)
+	}
+}
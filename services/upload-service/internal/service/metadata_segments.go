@@ -0,0 +1,395 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"html"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Identifiers at the start of the JPEG application segments that carry metadata
+var (
+	exifSegmentID      = []byte("Exif\x00\x00")
+	xmpSegmentID       = []byte("http://ns.adobe.com/xap/1.0/\x00")
+	photoshopSegmentID = []byte("Photoshop 3.0\x00")
+)
+
+// iptcResourceID is the Photoshop image resource holding IPTC-IIM records
+const iptcResourceID = 0x0404
+
+// jpegMetadata holds the raw metadata payloads found before the first scan of a JPEG
+type jpegMetadata struct {
+	exif []byte // TIFF structure from APP1 "Exif"
+	xmp  []byte // XMP packet from APP1
+	iptc []byte // IPTC-IIM records from APP13 "Photoshop 3.0"
+}
+
+// readJPEGMetadata walks the JPEG marker segments up to the start of scan and collects
+// the EXIF, XMP and IPTC payloads. The image data itself is never read.
+func readJPEGMetadata(r io.Reader) (jpegMetadata, error) {
+	var meta jpegMetadata
+	br := bufio.NewReader(r)
+
+	var soi [2]byte
+	if _, err := io.ReadFull(br, soi[:]); err != nil {
+		return meta, err
+	}
+	if soi != [2]byte{0xFF, 0xD8} {
+		return meta, errors.New("not a JPEG")
+	}
+
+	for {
+		// Markers may be preceded by any number of 0xFF fill bytes
+		b, err := br.ReadByte()
+		if err != nil {
+			return meta, err
+		}
+		if b != 0xFF {
+			return meta, errors.New("corrupt JPEG marker")
+		}
+		marker := byte(0xFF)
+		for marker == 0xFF {
+			if marker, err = br.ReadByte(); err != nil {
+				return meta, err
+			}
+		}
+
+		switch {
+		case marker == 0xDA || marker == 0xD9:
+			// Start of scan or end of image: no metadata segments follow
+			return meta, nil
+		case marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7):
+			// Standalone markers without a length
+			continue
+		}
+
+		var lengthBuf [2]byte
+		if _, err := io.ReadFull(br, lengthBuf[:]); err != nil {
+			return meta, err
+		}
+		length := int(binary.BigEndian.Uint16(lengthBuf[:])) - 2
+		if length < 0 {
+			return meta, errors.New("corrupt JPEG segment length")
+		}
+
+		if marker != 0xE1 && marker != 0xED {
+			if _, err := br.Discard(length); err != nil {
+				return meta, err
+			}
+			continue
+		}
+
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(br, payload); err != nil {
+			return meta, err
+		}
+		switch {
+		case marker == 0xE1 && bytes.HasPrefix(payload, exifSegmentID) && meta.exif == nil:
+			meta.exif = payload[len(exifSegmentID):]
+		case marker == 0xE1 && bytes.HasPrefix(payload, xmpSegmentID) && meta.xmp == nil:
+			meta.xmp = payload[len(xmpSegmentID):]
+		case marker == 0xED && bytes.HasPrefix(payload, photoshopSegmentID):
+			// IPTC data may be split across several APP13 segments
+			meta.iptc = append(meta.iptc, photoshopResource(payload[len(photoshopSegmentID):], iptcResourceID)...)
+		}
+	}
+}
+
+// pngSignature starts every PNG file
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// maxPNGMetadataChunk bounds the metadata chunks read into memory; larger ones are skipped
+const maxPNGMetadataChunk = 1 << 20
+
+// pngXMPKeyword is the iTXt keyword under which XMP packets are stored
+const pngXMPKeyword = "XML:com.adobe.xmp"
+
+// pngMetadata holds the metadata found in the chunks before the image data of a PNG
+type pngMetadata struct {
+	exif     []byte    // TIFF structure from eXIf
+	xmp      []byte    // XMP packet from iTXt
+	created  string    // "Creation Time" text
+	modified time.Time // tIME, the last modification time in UTC
+}
+
+// readPNGMetadata walks the PNG chunks up to the first IDAT and collects the EXIF, XMP,
+// creation time and modification time. The image data itself is never read.
+func readPNGMetadata(r io.Reader) (pngMetadata, error) {
+	var meta pngMetadata
+	br := bufio.NewReader(r)
+
+	signature := make([]byte, len(pngSignature))
+	if _, err := io.ReadFull(br, signature); err != nil {
+		return meta, err
+	}
+	if !bytes.Equal(signature, pngSignature) {
+		return meta, errors.New("not a PNG")
+	}
+
+	for {
+		var header [8]byte
+		if _, err := io.ReadFull(br, header[:]); err != nil {
+			return meta, err
+		}
+		length := int64(binary.BigEndian.Uint32(header[:4]))
+		chunkType := string(header[4:])
+		if chunkType == "IDAT" || chunkType == "IEND" {
+			return meta, nil
+		}
+
+		wanted := chunkType == "eXIf" || chunkType == "tIME" || chunkType == "tEXt" || chunkType == "zTXt" || chunkType == "iTXt"
+		if !wanted || length > maxPNGMetadataChunk {
+			// Skip the data and the CRC
+			if _, err := br.Discard(int(length) + 4); err != nil {
+				return meta, err
+			}
+			continue
+		}
+
+		data := make([]byte, length+4)
+		if _, err := io.ReadFull(br, data); err != nil {
+			return meta, err
+		}
+		data = data[:length]
+
+		switch chunkType {
+		case "eXIf":
+			if meta.exif == nil {
+				meta.exif = data
+			}
+		case "tIME":
+			if len(data) == 7 {
+				meta.modified = time.Date(int(binary.BigEndian.Uint16(data[:2])), time.Month(data[2]), int(data[3]),
+					int(data[4]), int(data[5]), int(data[6]), 0, time.UTC)
+			}
+		default:
+			keyword, text, ok := pngText(chunkType, data)
+			if !ok {
+				continue
+			}
+			switch {
+			case keyword == pngXMPKeyword && meta.xmp == nil:
+				meta.xmp = text
+			case keyword == "Creation Time" && meta.created == "":
+				meta.created = strings.TrimSpace(string(text))
+			}
+		}
+	}
+}
+
+// pngText decodes a tEXt, zTXt or iTXt chunk into its keyword and text.
+// tEXt and zTXt text is Latin-1 and returned as UTF-8; iTXt text is UTF-8 already.
+func pngText(chunkType string, data []byte) (string, []byte, bool) {
+	keyword, rest, ok := bytes.Cut(data, []byte{0})
+	if !ok {
+		return "", nil, false
+	}
+
+	switch chunkType {
+	case "tEXt":
+		return string(keyword), []byte(iptcString(rest)), true
+	case "zTXt":
+		if len(rest) < 1 {
+			return "", nil, false
+		}
+		text, err := inflatePNGText(rest[1:])
+		if err != nil {
+			return "", nil, false
+		}
+		return string(keyword), []byte(iptcString(text)), true
+	}
+
+	// iTXt: compression flag, compression method, language tag, translated keyword, text
+	if len(rest) < 2 {
+		return "", nil, false
+	}
+	compressed := rest[0] == 1
+	_, rest, ok = bytes.Cut(rest[2:], []byte{0})
+	if !ok {
+		return "", nil, false
+	}
+	_, text, ok := bytes.Cut(rest, []byte{0})
+	if !ok {
+		return "", nil, false
+	}
+	if compressed {
+		inflated, err := inflatePNGText(text)
+		if err != nil {
+			return "", nil, false
+		}
+		text = inflated
+	}
+	return string(keyword), text, true
+}
+
+// inflatePNGText decompresses zlib text, refusing anything that inflates past maxPNGMetadataChunk
+func inflatePNGText(data []byte) ([]byte, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	text, err := io.ReadAll(io.LimitReader(zr, maxPNGMetadataChunk+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(text) > maxPNGMetadataChunk {
+		return nil, errors.New("PNG text chunk too large")
+	}
+	return text, nil
+}
+
+// photoshopResource returns the data of one image resource block ("8BIM") from an APP13 payload
+func photoshopResource(data []byte, id uint16) []byte {
+	for len(data) >= 12 && bytes.Equal(data[:4], []byte("8BIM")) {
+		resourceID := binary.BigEndian.Uint16(data[4:6])
+		// Pascal string name, padded so that length byte plus name is even
+		nameLen := int(data[6]) + 1
+		nameLen += nameLen % 2
+		pos := 6 + nameLen
+		if len(data) < pos+4 {
+			return nil
+		}
+		size := int(binary.BigEndian.Uint32(data[pos : pos+4]))
+		pos += 4
+		if size < 0 || len(data) < pos+size {
+			return nil
+		}
+		if resourceID == id {
+			return data[pos : pos+size]
+		}
+		data = data[pos+size+size%2:]
+	}
+	return nil
+}
+
+// iptcFields are the IPTC-IIM application record (2) datasets we keep
+type iptcFields struct {
+	keywords []string // 2:25
+	caption  string   // 2:120
+}
+
+// parseIPTC reads IPTC-IIM datasets: 0x1C, record, dataset, 2-byte size, data
+func parseIPTC(data []byte) iptcFields {
+	var fields iptcFields
+	for len(data) >= 5 && data[0] == 0x1C {
+		record, dataset := data[1], data[2]
+		size := int(binary.BigEndian.Uint16(data[3:5]))
+		if size&0x8000 != 0 {
+			// Extended-length datasets are only used for binary payloads we do not read
+			return fields
+		}
+		if len(data) < 5+size {
+			return fields
+		}
+		value := iptcString(data[5 : 5+size])
+		data = data[5+size:]
+
+		if record != 2 || value == "" {
+			continue
+		}
+		switch dataset {
+		case 25:
+			fields.keywords = append(fields.keywords, value)
+		case 120:
+			fields.caption = value
+		}
+	}
+	return fields
+}
+
+// iptcString decodes an IPTC value, treating anything that is not UTF-8 as Latin-1
+func iptcString(b []byte) string {
+	if utf8.Valid(b) {
+		return strings.TrimSpace(strings.TrimRight(string(b), "\x00"))
+	}
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return strings.TrimSpace(string(runes))
+}
+
+// XMP properties appear either as attributes of rdf:Description or as child elements
+var (
+	xmpRatingPattern      = regexp.MustCompile(`xmp:Rating(?:="|>)\s*(-?\d+)`)
+	xmpLabelPattern       = regexp.MustCompile(`xmp:Label(?:="([^"]*)"|>([^<]*)<)`)
+	xmpSubjectPattern     = regexp.MustCompile(`(?s)<dc:subject>(.*?)</dc:subject>`)
+	xmpDescriptionPattern = regexp.MustCompile(`(?s)<dc:description>(.*?)</dc:description>`)
+	rdfItemPattern        = regexp.MustCompile(`(?s)<rdf:li[^>]*>(.*?)</rdf:li>`)
+
+	// Capture date properties, most specific first
+	xmpDatePatterns = []*regexp.Regexp{
+		regexp.MustCompile(`exif:DateTimeOriginal(?:="([^"]*)"|>([^<]*)<)`),
+		regexp.MustCompile(`photoshop:DateCreated(?:="([^"]*)"|>([^<]*)<)`),
+		regexp.MustCompile(`xmp:CreateDate(?:="([^"]*)"|>([^<]*)<)`),
+	}
+)
+
+// xmpFields are the XMP properties we keep
+type xmpFields struct {
+	rating      *int
+	label       string
+	keywords    []string // dc:subject
+	description string   // dc:description, first language alternative
+	created     string   // capture date, see xmpDatePatterns
+}
+
+// parseXMP extracts rating, label, subject, description and capture date from an XMP packet
+func parseXMP(data []byte) xmpFields {
+	var fields xmpFields
+	packet := string(data)
+
+	if m := xmpRatingPattern.FindStringSubmatch(packet); m != nil {
+		if v, err := strconv.Atoi(m[1]); err == nil && v >= -1 && v <= 5 {
+			fields.rating = &v
+		}
+	}
+	if m := xmpLabelPattern.FindStringSubmatch(packet); m != nil {
+		fields.label = strings.TrimSpace(html.UnescapeString(m[1] + m[2]))
+	}
+	if m := xmpSubjectPattern.FindStringSubmatch(packet); m != nil {
+		for _, item := range rdfItemPattern.FindAllStringSubmatch(m[1], -1) {
+			if v := strings.TrimSpace(html.UnescapeString(item[1])); v != "" {
+				fields.keywords = append(fields.keywords, v)
+			}
+		}
+	}
+	if m := xmpDescriptionPattern.FindStringSubmatch(packet); m != nil {
+		if item := rdfItemPattern.FindStringSubmatch(m[1]); item != nil {
+			fields.description = strings.TrimSpace(html.UnescapeString(item[1]))
+		}
+	}
+	for _, pattern := range xmpDatePatterns {
+		if m := pattern.FindStringSubmatch(packet); m != nil {
+			if v := strings.TrimSpace(m[1] + m[2]); v != "" {
+				fields.created = v
+				break
+			}
+		}
+	}
+	return fields
+}
+
+// mergeKeywords appends keywords not already present, ignoring case
+func mergeKeywords(keywords []string, more ...string) []string {
+	seen := make(map[string]bool, len(keywords))
+	for _, k := range keywords {
+		seen[strings.ToLower(k)] = true
+	}
+	for _, k := range more {
+		if key := strings.ToLower(k); !seen[key] {
+			seen[key] = true
+			keywords = append(keywords, k)
+		}
+	}
+	return keywords
+}
@@ -0,0 +1,33 @@
+package service
+
+import (
+	"image"
+
+	"github.com/disintegration/imaging"
+)
+
+// applyOrientation transforms img so it displays upright for the given EXIF orientation
+func applyOrientation(img image.Image, orientation int) image.Image {
+	switch orientation {
+	case 2:
+		return imaging.FlipH(img)
+	case 3:
+		return imaging.Rotate180(img)
+	case 4:
+		return imaging.FlipV(img)
+	case 5:
+		return imaging.Transpose(img)
+	case 6:
+		return imaging.Rotate270(img)
+	case 7:
+		return imaging.Transverse(img)
+	case 8:
+		return imaging.Rotate90(img)
+	}
+	return img
+}
+
+// swapsDimensions reports whether the orientation turns the image on its side
+func swapsDimensions(orientation int) bool {
+	return orientation >= 5 && orientation <= 8
+}
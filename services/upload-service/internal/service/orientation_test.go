@@ -0,0 +1,67 @@
+package service
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestApplyOrientation(t *testing.T) {
+	// The upright image, 3x2 with a distinct colour per pixel
+	const w, h = 3, 2
+	upright := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			upright.SetNRGBA(x, y, color.NRGBA{uint8(40 * x), uint8(100 * y), 7, 255})
+		}
+	}
+
+	// stored maps a pixel of the image as the camera wrote it to the upright pixel it shows,
+	// following the EXIF definition of where row 0 and column 0 belong
+	tests := []struct {
+		name        string
+		orientation int
+		stored      func(sx, sy int) (int, int)
+		sideways    bool
+	}{
+		{"unknown", 0, func(sx, sy int) (int, int) { return sx, sy }, false},
+		{"normal", 1, func(sx, sy int) (int, int) { return sx, sy }, false},
+		{"mirrored", 2, func(sx, sy int) (int, int) { return w - 1 - sx, sy }, false},
+		{"upside down", 3, func(sx, sy int) (int, int) { return w - 1 - sx, h - 1 - sy }, false},
+		{"flipped", 4, func(sx, sy int) (int, int) { return sx, h - 1 - sy }, false},
+		{"transposed", 5, func(sx, sy int) (int, int) { return sy, sx }, true},
+		{"needs 90 cw", 6, func(sx, sy int) (int, int) { return w - 1 - sy, sx }, true},
+		{"transversed", 7, func(sx, sy int) (int, int) { return w - 1 - sy, h - 1 - sx }, true},
+		{"needs 90 ccw", 8, func(sx, sy int) (int, int) { return sy, h - 1 - sx }, true},
+		{"out of range", 9, func(sx, sy int) (int, int) { return sx, sy }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := swapsDimensions(tt.orientation); got != tt.sideways {
+				t.Fatalf("swapsDimensions(%d) = %v, want %v", tt.orientation, got, tt.sideways)
+			}
+			sw, sh := w, h
+			if tt.sideways {
+				sw, sh = h, w
+			}
+			stored := image.NewNRGBA(image.Rect(0, 0, sw, sh))
+			for sy := 0; sy < sh; sy++ {
+				for sx := 0; sx < sw; sx++ {
+					stored.Set(sx, sy, upright.At(tt.stored(sx, sy)))
+				}
+			}
+
+			got := applyOrientation(stored, tt.orientation)
+			if b := got.Bounds(); b.Dx() != w || b.Dy() != h {
+				t.Fatalf("applyOrientation(%d) is %dx%d, want %dx%d", tt.orientation, b.Dx(), b.Dy(), w, h)
+			}
+			for y := 0; y < h; y++ {
+				for x := 0; x < w; x++ {
+					if c := color.NRGBAModel.Convert(got.At(got.Bounds().Min.X+x, got.Bounds().Min.Y+y)); c != upright.At(x, y) {
+						t.Fatalf("applyOrientation(%d) pixel (%d,%d) = %v, want %v", tt.orientation, x, y, c, upright.At(x, y))
+					}
+				}
+			}
+		})
+	}
+}
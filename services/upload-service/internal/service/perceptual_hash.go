@@ -0,0 +1,101 @@
+package service
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"sort"
+
+	"github.com/disintegration/imaging"
+)
+
+const (
+	// phashSampleSize is the side of the grayscale thumbnail the DCT runs on
+	phashSampleSize = 32
+	// phashBlockSize is the side of the block of lowest frequencies kept, one bit each
+	phashBlockSize = 8
+)
+
+// phashCosines[u][x] is cos((2x+1)uπ/2N), the DCT-II basis for the kept frequencies
+var phashCosines = func() [phashBlockSize][phashSampleSize]float64 {
+	var table [phashBlockSize][phashSampleSize]float64
+	for u := range phashBlockSize {
+		for x := range phashSampleSize {
+			table[u][x] = math.Cos(float64(2*x+1) * float64(u) * math.Pi / (2 * phashSampleSize))
+		}
+	}
+	return table
+}()
+
+// perceptualHash returns the 64-bit DCT hash of img as 16 hex digits. Each bit says whether
+// one of the 8x8 lowest spatial frequencies of a 32x32 grayscale thumbnail lies above their
+// median, so re-encoding, resizing and small edits flip few bits. Photos are compared by the
+// Hamming distance between hashes.
+func perceptualHash(img image.Image) string {
+	small := imaging.Grayscale(imaging.Resize(img, phashSampleSize, phashSampleSize, imaging.Lanczos))
+
+	var pixels [phashSampleSize][phashSampleSize]float64
+	for y := range phashSampleSize {
+		for x := range phashSampleSize {
+			pixels[y][x] = float64(small.Pix[y*small.Stride+x*4])
+		}
+	}
+
+	var coefficients [phashBlockSize * phashBlockSize]float64
+	for v := range phashBlockSize {
+		for u := range phashBlockSize {
+			sum := 0.0
+			for y := range phashSampleSize {
+				row := 0.0
+				for x := range phashSampleSize {
+					row += pixels[y][x] * phashCosines[u][x]
+				}
+				sum += row * phashCosines[v][y]
+			}
+			coefficients[v*phashBlockSize+u] = sum
+		}
+	}
+
+	// The DC term is the mean brightness; leave it out of the median
+	sorted := make([]float64, 0, len(coefficients)-1)
+	sorted = append(sorted, coefficients[1:]...)
+	sort.Float64s(sorted)
+	median := sorted[len(sorted)/2]
+
+	var hash uint64
+	for i, c := range coefficients {
+		if c > median {
+			hash |= 1 << uint(63-i)
+		}
+	}
+	return fmt.Sprintf("%016x", hash)
+}
+
+const (
+	// histogramLevels is the number of levels each RGB channel is quantized to
+	histogramLevels = 4
+	// histogramSampleSize is the side of the thumbnail pixels are counted on
+	histogramSampleSize = 64
+)
+
+// colorHistogram returns the share of pixels of img in each of the 4x4x4 RGB bins, scaled
+// so that a bin holding every pixel reads 255. Together with the perceptual hash, which
+// only sees brightness, it ranks similar photos.
+func colorHistogram(img image.Image) []byte {
+	small := imaging.Resize(img, histogramSampleSize, histogramSampleSize, imaging.Box)
+
+	var counts [histogramLevels * histogramLevels * histogramLevels]int
+	for i := 0; i+3 < len(small.Pix); i += 4 {
+		r := int(small.Pix[i]) * histogramLevels / 256
+		g := int(small.Pix[i+1]) * histogramLevels / 256
+		b := int(small.Pix[i+2]) * histogramLevels / 256
+		counts[(r*histogramLevels+g)*histogramLevels+b]++
+	}
+
+	total := len(small.Pix) / 4
+	histogram := make([]byte, len(counts))
+	for i, c := range counts {
+		histogram[i] = byte((c*255 + total/2) / total)
+	}
+	return histogram
+}
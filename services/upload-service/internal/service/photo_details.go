@@ -0,0 +1,66 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"seungpyolee.com/pkg/model"
+	"seungpyolee.com/pkg/shared"
+)
+
+// normalizeUploadDetails trims the user-supplied text fields and validates their lengths
+func normalizeUploadDetails(details model.PhotoUploadRequest) (model.PhotoUploadRequest, error) {
+	details.Title = strings.TrimSpace(details.Title)
+	details.Description = strings.TrimSpace(details.Description)
+	details.AltText = strings.TrimSpace(details.AltText)
+
+	if err := validateDetailLength("title", details.Title, shared.MaxPhotoTitleLength); err != nil {
+		return details, err
+	}
+	if err := validateDetailLength("description", details.Description, shared.MaxPhotoDescriptionLength); err != nil {
+		return details, err
+	}
+	if err := validateDetailLength("altText", details.AltText, shared.MaxPhotoAltTextLength); err != nil {
+		return details, err
+	}
+	return details, nil
+}
+
+// normalizeUpdateDetails trims and validates only the fields present in the update
+func normalizeUpdateDetails(update model.PhotoUpdateRequest) (model.PhotoUpdateRequest, error) {
+	if update.Title == nil && update.Description == nil && update.AltText == nil {
+		return update, fmt.Errorf("%w: at least one of title, description or altText is required", ErrInvalidPhotoDetails)
+	}
+
+	fields := []struct {
+		name  string
+		value **string
+		limit int
+	}{
+		{"title", &update.Title, shared.MaxPhotoTitleLength},
+		{"description", &update.Description, shared.MaxPhotoDescriptionLength},
+		{"altText", &update.AltText, shared.MaxPhotoAltTextLength},
+	}
+	for _, f := range fields {
+		if *f.value == nil {
+			continue
+		}
+		trimmed := strings.TrimSpace(**f.value)
+		if err := validateDetailLength(f.name, trimmed, f.limit); err != nil {
+			return update, err
+		}
+		*f.value = &trimmed
+	}
+	return update, nil
+}
+
+func validateDetailLength(field, value string, limit int) error {
+	if !utf8.ValidString(value) {
+		return fmt.Errorf("%w: %s must be valid UTF-8", ErrInvalidPhotoDetails, field)
+	}
+	if n := utf8.RuneCountInString(value); n > limit {
+		return fmt.Errorf("%w: %s must be at most %d characters (got %d)", ErrInvalidPhotoDetails, field, limit, n)
+	}
+	return nil
+}
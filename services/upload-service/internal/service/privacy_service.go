@@ -0,0 +1,363 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/disintegration/imaging"
+	"github.com/rwcarlsen/goexif/exif"
+	"seungpyolee.com/pkg/model"
+)
+
+// A user privacy job lists this many pages of photos per run before continuing in a new job,
+// keeping each run well within shared.ProcessingJobTimeout
+const (
+	privacyPageSize    = 200
+	privacyPagesPerJob = 5
+)
+
+// GetPrivacySettings returns the user's default privacy mode for shared photos
+func (s *uploaderServiceImpl) GetPrivacySettings(ctx context.Context, userID string) (*model.PrivacySettings, error) {
+	mode, _, err := s.cosmosRepo.GetUserPrivacyMode(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if mode == "" {
+		mode = model.DefaultPrivacyMode
+	}
+	return &model.PrivacySettings{PrivacyMode: mode}, nil
+}
+
+// UpdatePrivacySettings changes the user's default privacy mode. Shared copies of photos
+// that follow the default are regenerated by the processing workers, see QueuePrivacyJobs.
+func (s *uploaderServiceImpl) UpdatePrivacySettings(ctx context.Context, userID, mode string) (*model.PrivacySettings, error) {
+	if !model.ValidPrivacyMode(mode) {
+		return nil, fmt.Errorf("%w: unknown privacy mode %q", ErrInvalidPrivacySettings, mode)
+	}
+	version, err := s.cosmosRepo.SetUserPrivacyMode(ctx, userID, mode)
+	if err != nil {
+		return nil, err
+	}
+
+	job := &model.ProcessingJob{
+		Kind:           model.ProcessingJobUserPrivacy,
+		UserID:         userID,
+		PrivacyMode:    mode,
+		PrivacyVersion: version,
+		EnqueuedAt:     time.Now(),
+	}
+	if err := s.redisRepo.EnqueueProcessingJob(ctx, job); err != nil {
+		// Setting the mode again queues a job for the new version
+		return nil, fmt.Errorf("failed to queue privacy update: %w", err)
+	}
+
+	log.Printf("[Service] Privacy mode set to %s for user %s", mode, userID)
+	return &model.PrivacySettings{PrivacyMode: mode}, nil
+}
+
+// UpdatePhotoPrivacy changes whether a photo owned by userID is shared and which privacy
+// mode applies to it, regenerating its shared copy when the effective mode changes
+func (s *uploaderServiceImpl) UpdatePhotoPrivacy(ctx context.Context, userID, photoID string, update model.PhotoPrivacyRequest) (*model.Photo, error) {
+	if update.Shared == nil && update.PrivacyMode == nil {
+		return nil, fmt.Errorf("%w: at least one of shared or privacyMode is required", ErrInvalidPrivacySettings)
+	}
+	if update.PrivacyMode != nil && *update.PrivacyMode != "" && !model.ValidPrivacyMode(*update.PrivacyMode) {
+		return nil, fmt.Errorf("%w: unknown privacy mode %q", ErrInvalidPrivacySettings, *update.PrivacyMode)
+	}
+
+	photo, err := s.cosmosRepo.GetPhotoByID(ctx, photoID)
+	if err != nil {
+		log.Printf("[Service] Failed to fetch photo %s: %v", photoID, err)
+		return nil, err
+	}
+	if photo.PhotoID == "" {
+		return nil, ErrPhotoNotFound
+	}
+	if photo.UserID != userID {
+		return nil, ErrPhotoForbidden
+	}
+	// Processing writes the variants, shared copy included, when it finishes
+	if photo.Processing() {
+		return nil, ErrPhotoProcessing
+	}
+
+	if update.Shared != nil {
+		photo.Shared = *update.Shared
+	}
+	if update.PrivacyMode != nil {
+		photo.PrivacyMode = *update.PrivacyMode
+	}
+
+	mode, version := s.userPrivacyMode(ctx, userID)
+	if photo.PrivacyMode != "" {
+		mode = photo.PrivacyMode
+	}
+	obsolete, err := s.applyPrivacy(ctx, &photo, mode)
+	if err != nil {
+		return nil, err
+	}
+	// Queued jobs of this or an earlier version of the user's setting now leave the photo alone
+	photo.AppliedPrivacyVersion = version
+	if err := s.cosmosRepo.UpdatePhotoPrivacy(ctx, photo); err != nil {
+		return nil, err
+	}
+	s.discardBlobs(obsolete)
+
+	if err := s.redisRepo.DeletePhotoCache(ctx, photoID); err != nil {
+		log.Printf("[Service] Failed to invalidate photo cache: %v (non-fatal)", err)
+	}
+	s.invalidateUserCaches(ctx, userID)
+
+	log.Printf("[Service] Photo privacy updated: %s shared=%t mode=%s", photoID, photo.Shared, photo.AppliedPrivacy)
+	return &photo, nil
+}
+
+// QueuePrivacyJobs runs a user privacy job: it queues a photo privacy job for each photo that
+// follows the user's default mode and does not have it applied yet. A run covers a few pages
+// of photos, then queues the job again to continue after the last one. Jobs of a superseded
+// version of the setting stop, as the job of the latest version covers every photo.
+func (s *uploaderServiceImpl) QueuePrivacyJobs(ctx context.Context, job model.ProcessingJob) error {
+	_, version, err := s.cosmosRepo.GetUserPrivacyMode(ctx, job.UserID)
+	if err != nil {
+		return err
+	}
+	if version != job.PrivacyVersion {
+		log.Printf("[Service] Privacy mode %s of user %s was superseded, not reapplying it", job.PrivacyMode, job.UserID)
+		return nil
+	}
+
+	var after *model.PhotoCursor
+	if job.After != "" {
+		if after, err = model.ParsePhotoCursor(job.After, model.DefaultPhotoSort); err != nil {
+			return err
+		}
+	}
+	var last model.Photo
+	queued := 0
+	for range privacyPagesPerJob {
+		photos, err := s.cosmosRepo.GetPhotosPage(ctx, job.UserID, after, privacyPageSize)
+		if err != nil {
+			return err
+		}
+		for _, photo := range photos {
+			if photo.PrivacyMode != "" || photo.Status == model.PhotoStatusFailed || photo.AppliedPrivacyVersion >= job.PrivacyVersion {
+				continue
+			}
+			photoJob := &model.ProcessingJob{
+				Kind:           model.ProcessingJobPhotoPrivacy,
+				PhotoID:        photo.PhotoID,
+				UserID:         job.UserID,
+				PrivacyMode:    job.PrivacyMode,
+				PrivacyVersion: job.PrivacyVersion,
+				EnqueuedAt:     time.Now(),
+			}
+			if err := s.redisRepo.EnqueueProcessingJob(ctx, photoJob); err != nil {
+				// The retried run queues the page again; photo jobs are idempotent
+				return err
+			}
+			queued++
+		}
+		if len(photos) < privacyPageSize {
+			log.Printf("[Service] Queued privacy mode %s for %d more photos of user %s, done", job.PrivacyMode, queued, job.UserID)
+			return nil
+		}
+		last = photos[len(photos)-1]
+		after = &model.PhotoCursor{Sort: model.DefaultPhotoSort, Value: last.UploadedAt, PhotoID: last.PhotoID}
+	}
+
+	next := job
+	next.After = model.NewPhotoCursor(model.DefaultPhotoSort, last)
+	next.EnqueuedAt = time.Now()
+	if err := s.redisRepo.EnqueueProcessingJob(ctx, &next); err != nil {
+		return err
+	}
+	log.Printf("[Service] Queued privacy mode %s for %d photos of user %s, continuing", job.PrivacyMode, queued, job.UserID)
+	return nil
+}
+
+// ReapplyPhotoPrivacy runs a photo privacy job, bringing the shared copy of a photo that
+// follows its owner's default up to the job's mode. The write is dropped if the photo got its
+// own mode or a later version of the setting was applied in the meantime.
+func (s *uploaderServiceImpl) ReapplyPhotoPrivacy(ctx context.Context, job model.ProcessingJob) error {
+	photo, err := s.cosmosRepo.GetPhotoByID(ctx, job.PhotoID)
+	if err != nil {
+		return err
+	}
+	if photo.PhotoID == "" || photo.UserID != job.UserID || photo.PrivacyMode != "" ||
+		photo.Status == model.PhotoStatusFailed || photo.AppliedPrivacyVersion >= job.PrivacyVersion {
+		return nil
+	}
+	// Processing may have read the earlier mode; retry once it has written its shared copy
+	if photo.Processing() {
+		return ErrPhotoProcessing
+	}
+
+	obsolete, err := s.applyPrivacy(ctx, &photo, job.PrivacyMode)
+	if err != nil {
+		return err
+	}
+	photo.AppliedPrivacyVersion = job.PrivacyVersion
+	saved, err := s.cosmosRepo.SaveAppliedPrivacy(ctx, photo)
+	if err != nil {
+		return err
+	}
+	if !saved {
+		// Another change won; a copy made here under the same mode is the one it references
+		log.Printf("[Service] Privacy mode %s of photo %s was superseded, dropping it", job.PrivacyMode, photo.PhotoID)
+		return nil
+	}
+	s.discardBlobs(obsolete)
+
+	if err := s.redisRepo.DeletePhotoCache(ctx, photo.PhotoID); err != nil {
+		log.Printf("[Service] Failed to invalidate photo cache: %v (non-fatal)", err)
+	}
+	s.invalidateUserCaches(ctx, photo.UserID)
+	log.Printf("[Service] Reapplied privacy mode %s to photo %s", job.PrivacyMode, photo.PhotoID)
+	return nil
+}
+
+// userPrivacyMode returns the user's default privacy mode and the version of the setting.
+// Lookup failures fall back to the default so a database hiccup never results in GPS being
+// shared; version 0 then lets any queued job correct the mode later.
+func (s *uploaderServiceImpl) userPrivacyMode(ctx context.Context, userID string) (string, int64) {
+	mode, version, err := s.cosmosRepo.GetUserPrivacyMode(ctx, userID)
+	if err != nil || !model.ValidPrivacyMode(mode) {
+		return model.DefaultPrivacyMode, version
+	}
+	return mode, version
+}
+
+// applyPrivacy makes the shared variant of photo match mode, updating photo in place, and
+// returns the blobs of shared copies it no longer references. The caller deletes them once
+// the photo is saved. Under "none" the shared copy is dropped and non-owners receive the original.
+func (s *uploaderServiceImpl) applyPrivacy(ctx context.Context, photo *model.Photo, mode string) ([]string, error) {
+	_, hasShared := photo.Variant(model.VariantShared)
+	if photo.AppliedPrivacy == mode && (hasShared || mode == model.PrivacyModeNone) {
+		return nil, nil
+	}
+
+	if mode == model.PrivacyModeNone {
+		photo.AppliedPrivacy = mode
+		return dropSharedVariant(photo), nil
+	}
+
+	original, ok := photo.Variant(model.VariantOriginal)
+	if !ok {
+		return nil, fmt.Errorf("photo %s has no original variant", photo.PhotoID)
+	}
+	spool, err := s.spoolBlob(ctx, original.BlobName)
+	if err != nil {
+		log.Printf("[Service] Failed to read original of photo %s: %v", photo.PhotoID, err)
+		return nil, err
+	}
+	defer func() {
+		spool.Close()
+		os.Remove(spool.Name())
+	}()
+
+	img, err := imaging.Decode(spool)
+	if err != nil {
+		// Without a decodable image no sanitized copy can exist; drop any copy made under a weaker mode
+		log.Printf("[Service] Failed to decode photo %s for sanitizing: %v", photo.PhotoID, err)
+		photo.AppliedPrivacy = mode
+		return dropSharedVariant(photo), nil
+	}
+	img = applyOrientation(img, photo.Metadata.Orientation)
+
+	shared, err := s.storeSharedVariant(ctx, photo.UserID, photo.PhotoID, original.ContentType, mode, img, readRawExif(spool))
+	if err != nil {
+		return nil, err
+	}
+	var obsolete []string
+	for _, blobName := range dropSharedVariant(photo) {
+		// Copies under the same mode share the blob name and were just overwritten
+		if blobName != shared.BlobName {
+			obsolete = append(obsolete, blobName)
+		}
+	}
+	photo.Variants = append(photo.Variants, shared)
+	photo.AppliedPrivacy = mode
+	return obsolete, nil
+}
+
+// storeSharedVariant encodes and uploads the full-size sanitized copy served to non-owners
+func (s *uploaderServiceImpl) storeSharedVariant(ctx context.Context, userID, photoID, originalType, mode string, img image.Image, exifData *exif.Exif) (model.PhotoVariant, error) {
+	contentType := sharedContentType(originalType)
+	data, err := encodeSanitized(img, contentType, mode, exifData)
+	if err != nil {
+		log.Printf("[Service] Failed to encode shared copy of photo %s: %v", photoID, err)
+		return model.PhotoVariant{}, err
+	}
+
+	blobName := sharedBlobName(userID, photoID, contentType, mode)
+	url, err := s.blobRepo.UploadBlob(ctx, blobName, bytes.NewReader(data), contentType)
+	if err != nil {
+		log.Printf("[Service] Failed to upload shared copy of photo %s: %v", photoID, err)
+		return model.PhotoVariant{}, err
+	}
+	return model.PhotoVariant{
+		Name:        model.VariantShared,
+		BlobName:    blobName,
+		URL:         url,
+		ContentType: contentType,
+		Width:       img.Bounds().Dx(),
+		Height:      img.Bounds().Dy(),
+		Size:        int64(len(data)),
+	}, nil
+}
+
+// dropSharedVariant removes the shared copy of photo, if any, from Variants and returns its blob names
+func dropSharedVariant(photo *model.Photo) []string {
+	var blobNames []string
+	kept := photo.Variants[:0]
+	for _, v := range photo.Variants {
+		if v.Name == model.VariantShared {
+			blobNames = append(blobNames, v.BlobName)
+			continue
+		}
+		kept = append(kept, v)
+	}
+	photo.Variants = kept
+	return blobNames
+}
+
+// spoolBlob copies a blob to a temp file positioned at its start; the caller removes it
+func (s *uploaderServiceImpl) spoolBlob(ctx context.Context, blobName string) (*os.File, error) {
+	body, err := s.blobRepo.OpenBlob(ctx, blobName)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	spool, err := os.CreateTemp("", "photo-sanitize-*")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(spool, body); err == nil {
+		_, err = spool.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		spool.Close()
+		os.Remove(spool.Name())
+		return nil, err
+	}
+	return spool, nil
+}
+
+// readRawExif decodes the EXIF block of the file from its start; nil if there is none
+func readRawExif(f io.ReadSeeker) *exif.Exif {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil
+	}
+	exifData, err := decodeExif(f)
+	if err != nil {
+		return nil
+	}
+	return exifData
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"seungpyolee.com/pkg/model"
+)
+
+// addSharedPhotos stores n ready photos of user-1 with a strip_gps shared copy, newest last
+func addSharedPhotos(cosmos *fakeCosmosRepo, blobs *fakeBlobRepo, n int) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := range n {
+		id := fmt.Sprintf("photo-%04d", i)
+		shared := sharedBlobName("user-1", id, "image/jpeg", model.PrivacyModeStripGPS)
+		blobs.blobs[shared] = []byte("copy")
+		cosmos.photos[id] = model.Photo{
+			PhotoID:        id,
+			UserID:         "user-1",
+			UploadedAt:     base.Add(time.Duration(i) * time.Minute),
+			Status:         model.PhotoStatusReady,
+			AppliedPrivacy: model.PrivacyModeStripGPS,
+			Variants: []model.PhotoVariant{
+				{Name: model.VariantOriginal, BlobName: "user-1/" + id + ".jpg"},
+				{Name: model.VariantShared, BlobName: shared},
+			},
+		}
+	}
+}
+
+// drainJobs runs queued privacy jobs until none are left and returns how many ran
+func drainJobs(t *testing.T, s *uploaderServiceImpl, redis *fakeRedisRepo) int {
+	t.Helper()
+	ran := 0
+	for len(redis.jobs) > 0 {
+		job := redis.jobs[0]
+		redis.jobs = redis.jobs[1:]
+		var err error
+		switch job.Kind {
+		case model.ProcessingJobUserPrivacy:
+			err = s.QueuePrivacyJobs(context.Background(), job)
+		case model.ProcessingJobPhotoPrivacy:
+			err = s.ReapplyPhotoPrivacy(context.Background(), job)
+		default:
+			t.Fatalf("unexpected job kind %q", job.Kind)
+		}
+		if err != nil {
+			t.Fatalf("%s job for %q: %v", job.Kind, job.PhotoID, err)
+		}
+		ran++
+	}
+	return ran
+}
+
+func TestUpdatePrivacySettingsQueuesJobs(t *testing.T) {
+	s, cosmos, blobs, redis := newTestUploader()
+	total := privacyPageSize*privacyPagesPerJob + 3
+	addSharedPhotos(cosmos, blobs, total)
+	// Photos with their own mode keep it
+	override := cosmos.photos["photo-0000"]
+	override.PrivacyMode = model.PrivacyModeStripGPS
+	cosmos.photos["photo-0000"] = override
+
+	if _, err := s.UpdatePrivacySettings(context.Background(), "user-1", model.PrivacyModeNone); err != nil {
+		t.Fatalf("UpdatePrivacySettings: %v", err)
+	}
+	// One user job, its continuation and one job per following photo
+	if ran, want := drainJobs(t, s, redis), 2+total-1; ran != want {
+		t.Fatalf("ran %d jobs, want %d", ran, want)
+	}
+
+	for id, p := range cosmos.photos {
+		_, hasShared := p.Variant(model.VariantShared)
+		if id == "photo-0000" {
+			if !hasShared || p.AppliedPrivacy != model.PrivacyModeStripGPS {
+				t.Fatalf("photo with its own mode was changed: %+v", p)
+			}
+			continue
+		}
+		if hasShared || p.AppliedPrivacy != model.PrivacyModeNone || p.AppliedPrivacyVersion != 1 {
+			t.Fatalf("photo %s not brought up to none: applied %q version %d shared %v", id, p.AppliedPrivacy, p.AppliedPrivacyVersion, hasShared)
+		}
+	}
+}
+
+func TestSupersededPrivacyJobsDropTheirWrites(t *testing.T) {
+	s, cosmos, blobs, redis := newTestUploader()
+	addSharedPhotos(cosmos, blobs, 3)
+	ctx := context.Background()
+
+	if _, err := s.UpdatePrivacySettings(ctx, "user-1", model.PrivacyModeNone); err != nil {
+		t.Fatalf("UpdatePrivacySettings: %v", err)
+	}
+	stale := redis.jobs[0]
+	redis.jobs = nil
+	if err := s.QueuePrivacyJobs(ctx, stale); err != nil {
+		t.Fatalf("QueuePrivacyJobs: %v", err)
+	}
+	stalePhotoJobs := redis.jobs
+	redis.jobs = nil
+
+	// The user switches back before the photo jobs of the first change ran
+	if _, err := s.UpdatePrivacySettings(ctx, "user-1", model.PrivacyModeStripGPS); err != nil {
+		t.Fatalf("UpdatePrivacySettings: %v", err)
+	}
+	drainJobs(t, s, redis)
+
+	// A superseded user job queues nothing
+	if err := s.QueuePrivacyJobs(ctx, stale); err != nil || len(redis.jobs) != 0 {
+		t.Fatalf("superseded user job queued %d jobs, err %v", len(redis.jobs), err)
+	}
+	// Superseded photo jobs leave the photos alone
+	redis.jobs = stalePhotoJobs
+	drainJobs(t, s, redis)
+	for id, p := range cosmos.photos {
+		shared, ok := p.Variant(model.VariantShared)
+		if !ok || p.AppliedPrivacy != model.PrivacyModeStripGPS {
+			t.Fatalf("photo %s lost its strip_gps copy to a superseded job: %+v", id, p)
+		}
+		if _, ok := blobs.blobs[shared.BlobName]; !ok {
+			t.Fatalf("photo %s references deleted blob %s", id, shared.BlobName)
+		}
+	}
+}
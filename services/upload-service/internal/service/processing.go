@@ -0,0 +1,235 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/disintegration/imaging"
+	"seungpyolee.com/pkg/model"
+)
+
+// ProcessPhoto finishes a stored upload from its original blob: it infers a missing capture
+// date from the file name, reads the dimensions, computes the perceptual hash and color
+// histogram, generates the resized variants and the shared copy, and resolves the place.
+// A failed attempt deletes the blobs it derived, see derivedBlobNames.
+func (s *uploaderServiceImpl) ProcessPhoto(ctx context.Context, job model.ProcessingJob, attempt int) error {
+	photo, err := s.cosmosRepo.GetPhotoByID(ctx, job.PhotoID)
+	if err != nil {
+		return err
+	}
+	if photo.PhotoID == "" {
+		log.Printf("[Service] Photo %s was deleted before processing", job.PhotoID)
+		return nil
+	}
+	if photo.Status == model.PhotoStatusReady {
+		// An earlier delivery finished but was not acknowledged
+		return nil
+	}
+	if photo.Status == model.PhotoStatusFailed {
+		// A stale delivery of a job that was already given up on
+		log.Printf("[Service] Photo %s was marked failed, skipping processing", photo.PhotoID)
+		return nil
+	}
+	if _, err := s.cosmosRepo.UpdatePhotoStatus(ctx, photo.PhotoID, model.PhotoStatusProcessing, attempt, photo.ProcessingError); err != nil {
+		return err
+	}
+
+	original, ok := photo.Variant(model.VariantOriginal)
+	if !ok {
+		return fmt.Errorf("photo %s has no original variant", photo.PhotoID)
+	}
+	spool, err := s.spoolBlob(ctx, original.BlobName)
+	if err != nil {
+		return fmt.Errorf("failed to read original: %w", err)
+	}
+	defer func() {
+		spool.Close()
+		os.Remove(spool.Name())
+	}()
+
+	if err := s.derivePhoto(ctx, &photo, original, spool); err != nil {
+		// Nothing references the variants stored before the failure. They are deleted before
+		// the job is retried so the cleanup cannot remove what the next attempt writes.
+		_, failures := s.deleteBlobs(context.Background(), s.derivedBlobNames(photo))
+		for _, f := range failures {
+			log.Printf("[Service] Failed to delete blob %s during cleanup: %s", f.Target, f.Error)
+		}
+		return err
+	}
+	now := time.Now()
+	photo.Status = model.PhotoStatusReady
+	photo.ProcessingAttempts = attempt
+	photo.ProcessingError = ""
+	photo.ProcessedAt = &now
+
+	found, err := s.cosmosRepo.SaveProcessedPhoto(ctx, photo)
+	if err != nil {
+		return err
+	}
+	if !found {
+		// Deleted, or given up on, while processing; nothing references the new blobs
+		s.discardBlobs(s.derivedBlobNames(photo))
+		log.Printf("[Service] Photo %s was deleted or marked failed during processing", photo.PhotoID)
+		return nil
+	}
+
+	// The photo, gallery, timeline, memories and similar-photo caches hold the pending photo
+	if err := s.redisRepo.SetPhotoMetadata(ctx, photo.PhotoID, &photo); err != nil {
+		log.Printf("[Service] Failed to cache photo metadata: %v (non-fatal)", err)
+	}
+	s.invalidateUserCaches(ctx, photo.UserID)
+
+	log.Printf("[Service] Photo processed: %s with %d variants (attempt %d)", photo.PhotoID, len(photo.Variants), attempt)
+	return nil
+}
+
+// derivePhoto fills in everything ProcessPhoto derives from the spooled original
+func (s *uploaderServiceImpl) derivePhoto(ctx context.Context, photo *model.Photo, original model.PhotoVariant, spool *os.File) error {
+	metadata := &photo.Metadata
+
+	// Screenshots, scans and messenger images often carry their date only in the file name
+	s.exifExtractor.InferCaptureDate(photo.FileName, metadata)
+
+	// Read dimensions from the image header, falling back to EXIF PixelX/YDimension
+	if w, h, ok := readDimensions(spool, photo.MimeType); ok {
+		metadata.Width, metadata.Height = w, h
+	}
+	if swapsDimensions(metadata.Orientation) {
+		metadata.Width, metadata.Height = metadata.Height, metadata.Width
+	}
+	original.Width, original.Height = metadata.Width, metadata.Height
+
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to rewind spool file: %w", err)
+	}
+
+	// Generate resized versions and the sanitized copy for non-owners
+	variants := []model.PhotoVariant{original}
+	privacyMode, privacyVersion := s.userPrivacyMode(ctx, photo.UserID)
+	if photo.PrivacyMode != "" {
+		privacyMode = photo.PrivacyMode
+	}
+	img, err := imaging.Decode(spool)
+	if err != nil {
+		// Undecodable images keep only their original
+		log.Printf("[Service] Failed to decode photo %s for resizing: %v", photo.PhotoID, err)
+	} else {
+		// Bake the EXIF orientation into the pixels so variants display upright
+		img = applyOrientation(img, metadata.Orientation)
+		photo.PerceptualHash = perceptualHash(img)
+		photo.PerceptualBands = model.PerceptualHashBands(photo.PerceptualHash)
+		photo.ColorHistogram = colorHistogram(img)
+
+		resized, err := s.generateVariants(ctx, photo.UserID, photo.PhotoID, img)
+		if err != nil {
+			return err
+		}
+		variants = append(variants, resized...)
+
+		if privacyMode != model.PrivacyModeNone {
+			// Without a shared copy non-owners get no full-size file; the photo is still usable
+			if shared, err := s.storeSharedVariant(ctx, photo.UserID, photo.PhotoID, photo.MimeType, privacyMode, img, readRawExif(spool)); err == nil {
+				variants = append(variants, shared)
+			}
+		}
+	}
+	photo.Variants = variants
+	photo.AppliedPrivacy = privacyMode
+	photo.AppliedPrivacyVersion = privacyVersion
+
+	// Offline lookup against the in-memory place index; no match leaves Place empty
+	if metadata.GPS != nil && s.geocoder != nil {
+		if place, ok := s.geocoder.Lookup(metadata.GPS.Latitude, metadata.GPS.Longitude); ok {
+			photo.Place = place
+		}
+	}
+	return nil
+}
+
+// derivedBlobNames lists every blob processing may write for photo: a resized variant per
+// profile and a shared copy per privacy mode. None of them is referenced until processing
+// saves the photo, so they can be deleted whenever the photo is not ready.
+func (s *uploaderServiceImpl) derivedBlobNames(photo model.Photo) []string {
+	var names []string
+	for _, profile := range s.variantProfiles {
+		names = append(names, variantBlobName(photo.UserID, photo.PhotoID, profile))
+	}
+	contentType := sharedContentType(photo.MimeType)
+	for _, mode := range []string{model.PrivacyModeStripGPS, model.PrivacyModeStripAll} {
+		names = append(names, sharedBlobName(photo.UserID, photo.PhotoID, contentType, mode))
+	}
+	return names
+}
+
+// photoBlobNames lists the blobs to delete with photo: those recorded on it, plus whatever an
+// unfinished or failed processing attempt may have left behind
+func (s *uploaderServiceImpl) photoBlobNames(photo model.Photo) []string {
+	names := variantBlobNames(photo)
+	if photo.Processing() || photo.Status == model.PhotoStatusFailed {
+		for _, name := range s.derivedBlobNames(photo) {
+			if !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// RecordProcessingFailure notes a failed processing attempt on the photo. A final failure
+// marks the photo failed, otherwise it is pending again until the next attempt.
+func (s *uploaderServiceImpl) RecordProcessingFailure(ctx context.Context, job model.ProcessingJob, attempt int, reason string, final bool) {
+	status := model.PhotoStatusPending
+	if final {
+		status = model.PhotoStatusFailed
+	}
+	if _, err := s.cosmosRepo.UpdatePhotoStatus(ctx, job.PhotoID, status, attempt, reason); err != nil {
+		log.Printf("[Service] Failed to record processing failure of photo %s: %v", job.PhotoID, err)
+		return
+	}
+	if !final {
+		return
+	}
+	if err := s.redisRepo.DeletePhotoCache(ctx, job.PhotoID); err != nil {
+		log.Printf("[Service] Failed to invalidate photo cache: %v (non-fatal)", err)
+	}
+	s.invalidateUserCaches(ctx, job.UserID)
+
+	// The last attempt may have stored variants before failing to save them
+	photo, err := s.cosmosRepo.GetPhotoByID(ctx, job.PhotoID)
+	if err == nil && photo.Status == model.PhotoStatusFailed {
+		s.discardBlobs(s.derivedBlobNames(photo))
+	}
+}
+
+// GetPhotoStatus reports the processing state of a photo owned by userID
+func (s *uploaderServiceImpl) GetPhotoStatus(ctx context.Context, userID, photoID string) (*model.PhotoStatus, error) {
+	photo, err := s.cosmosRepo.GetPhotoByID(ctx, photoID)
+	if err != nil {
+		log.Printf("[Service] Failed to fetch photo %s: %v", photoID, err)
+		return nil, err
+	}
+	if photo.PhotoID == "" {
+		return nil, ErrPhotoNotFound
+	}
+	if photo.UserID != userID {
+		return nil, ErrPhotoForbidden
+	}
+
+	status := photo.Status
+	if status == "" {
+		// Stored before uploads were processed in the background
+		status = model.PhotoStatusReady
+	}
+	return &model.PhotoStatus{
+		PhotoID:     photo.PhotoID,
+		Status:      status,
+		Attempts:    photo.ProcessingAttempts,
+		Error:       photo.ProcessingError,
+		ProcessedAt: photo.ProcessedAt,
+	}, nil
+}
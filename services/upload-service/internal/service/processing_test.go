@@ -0,0 +1,135 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"maps"
+	"slices"
+	"testing"
+	"time"
+
+	"seungpyolee.com/pkg/model"
+)
+
+// addPendingPhoto stores a pending JPEG upload large enough for every default profile
+func addPendingPhoto(t *testing.T, cosmos *fakeCosmosRepo, blobs *fakeBlobRepo) model.Photo {
+	img := image.NewRGBA(image.Rect(0, 0, 1200, 900))
+	for y := 0; y < 900; y++ {
+		for x := 0; x < 1200; x++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), 128, 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	photo := model.Photo{
+		PhotoID:    "photo-1",
+		UserID:     "user-1",
+		FileName:   "a.jpg",
+		MimeType:   "image/jpeg",
+		Status:     model.PhotoStatusPending,
+		UploadedAt: time.Now(),
+		Variants:   []model.PhotoVariant{{Name: model.VariantOriginal, BlobName: "user-1/photo-1.jpg", ContentType: "image/jpeg"}},
+	}
+	cosmos.photos[photo.PhotoID] = photo
+	blobs.blobs["user-1/photo-1.jpg"] = buf.Bytes()
+	return photo
+}
+
+func TestProcessPhotoStoresDerivedBlobs(t *testing.T) {
+	s, cosmos, blobs, _ := newTestUploader()
+	photo := addPendingPhoto(t, cosmos, blobs)
+	job := model.ProcessingJob{PhotoID: photo.PhotoID, UserID: photo.UserID}
+
+	if err := s.ProcessPhoto(context.Background(), job, 1); err != nil {
+		t.Fatalf("ProcessPhoto() error = %v", err)
+	}
+	processed := cosmos.photos[photo.PhotoID]
+	if processed.Status != model.PhotoStatusReady {
+		t.Fatalf("status = %q, want ready", processed.Status)
+	}
+	// Every blob written is recorded on the photo, and every derived name is known
+	recorded := variantBlobNames(processed)
+	stored := slices.Sorted(maps.Keys(blobs.blobs))
+	if !slices.Equal(slices.Sorted(slices.Values(recorded)), stored) {
+		t.Fatalf("stored blobs %v, recorded %v", stored, recorded)
+	}
+	for _, name := range recorded[1:] {
+		if !slices.Contains(s.derivedBlobNames(processed), name) {
+			t.Fatalf("derivedBlobNames() is missing %s", name)
+		}
+	}
+}
+
+func TestProcessPhotoFailureDeletesDerivedBlobs(t *testing.T) {
+	s, cosmos, blobs, _ := newTestUploader()
+	photo := addPendingPhoto(t, cosmos, blobs)
+	job := model.ProcessingJob{PhotoID: photo.PhotoID, UserID: photo.UserID}
+
+	// The 1080 variant is stored, then the 720 variant fails
+	blobs.failing = variantBlobName(photo.UserID, photo.PhotoID, DefaultVariantProfiles()[1])
+	if err := s.ProcessPhoto(context.Background(), job, 1); err == nil {
+		t.Fatalf("ProcessPhoto() succeeded although a variant upload failed")
+	}
+	if got := slices.Collect(maps.Keys(blobs.blobs)); len(got) != 1 || got[0] != "user-1/photo-1.jpg" {
+		t.Fatalf("blobs after a failed attempt = %v, want only the original", got)
+	}
+}
+
+func TestFailedPhotoLeftoversAreDeleted(t *testing.T) {
+	ctx := context.Background()
+	s, cosmos, blobs, _ := newTestUploader()
+	photo := addPendingPhoto(t, cosmos, blobs)
+	job := model.ProcessingJob{PhotoID: photo.PhotoID, UserID: photo.UserID}
+
+	// Blobs of an attempt whose save failed, which nothing on the photo records
+	for _, name := range s.derivedBlobNames(photo) {
+		blobs.blobs[name] = []byte("leftover")
+	}
+	s.RecordProcessingFailure(ctx, job, 5, "database unavailable", true)
+	if cosmos.photos[photo.PhotoID].Status != model.PhotoStatusFailed {
+		t.Fatalf("status = %q, want failed", cosmos.photos[photo.PhotoID].Status)
+	}
+	waitForBlobs(t, blobs, 1)
+
+	// A stale delivery must not revive the failed photo
+	if err := s.ProcessPhoto(ctx, job, 6); err != nil {
+		t.Fatalf("late ProcessPhoto() error = %v", err)
+	}
+	if cosmos.photos[photo.PhotoID].Status != model.PhotoStatusFailed {
+		t.Fatalf("status after a stale delivery = %q, want failed", cosmos.photos[photo.PhotoID].Status)
+	}
+	waitForBlobs(t, blobs, 1)
+
+	// Deleting the failed photo removes leftovers too
+	for _, name := range s.derivedBlobNames(photo) {
+		blobs.blobs[name] = []byte("leftover")
+	}
+	if _, err := s.DeletePhoto(ctx, photo.UserID, photo.PhotoID); err != nil {
+		t.Fatalf("DeletePhoto() error = %v", err)
+	}
+	if len(blobs.blobs) != 0 {
+		t.Fatalf("blobs after deleting the failed photo = %v", slices.Collect(maps.Keys(blobs.blobs)))
+	}
+}
+
+// waitForBlobs waits for background cleanup to leave n blobs
+func waitForBlobs(t *testing.T, blobs *fakeBlobRepo, n int) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		blobs.mu.Lock()
+		count := len(blobs.blobs)
+		blobs.mu.Unlock()
+		if count == n {
+			return
+		}
+	}
+	blobs.mu.Lock()
+	defer blobs.mu.Unlock()
+	t.Fatalf("blobs = %v, want %d", slices.Collect(maps.Keys(blobs.blobs)), n)
+}
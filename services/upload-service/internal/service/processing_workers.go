@@ -0,0 +1,151 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"seungpyolee.com/pkg/model"
+	"seungpyolee.com/pkg/shared"
+	"seungpyolee.com/services/upload-service/internal/repository"
+)
+
+// processingPollInterval is how long an idle worker waits for a new job before looking for
+// jobs to retry again, and how long it backs off after a queue error
+const processingPollInterval = 5 * time.Second
+
+// ProcessingWorkerPool runs photo processing and privacy jobs from the Redis queue. A failed
+// attempt is left unacknowledged and retried by any worker of any instance once
+// shared.ProcessingRetryDelay has passed, which also recovers the jobs of crashed workers.
+// After shared.MaxProcessingAttempts the job is dead-lettered, and for uploads the photo marked failed.
+type ProcessingWorkerPool struct {
+	redisRepo repository.RedisRepository
+	uploader  UploaderService
+	workers   int
+	name      string
+}
+
+func NewProcessingWorkerPool(redisRepo repository.RedisRepository, uploader UploaderService, workers int) *ProcessingWorkerPool {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "upload-service"
+	}
+	return &ProcessingWorkerPool{
+		redisRepo: redisRepo,
+		uploader:  uploader,
+		workers:   workers,
+		name:      fmt.Sprintf("%s-%d", host, os.Getpid()),
+	}
+}
+
+// Start launches the workers; they run until ctx is cancelled
+func (p *ProcessingWorkerPool) Start(ctx context.Context) {
+	if err := p.redisRepo.EnsureProcessingQueue(ctx); err != nil {
+		// Workers create the queue once Redis is reachable
+		log.Printf("[Worker] Processing queue not ready: %v", err)
+	}
+	for i := 0; i < p.workers; i++ {
+		go p.work(ctx, fmt.Sprintf("%s-%d", p.name, i))
+	}
+	log.Printf("[Worker] Started %d processing workers", p.workers)
+}
+
+func (p *ProcessingWorkerPool) work(ctx context.Context, consumer string) {
+	for ctx.Err() == nil {
+		// Retries first, so a steady stream of uploads cannot starve them
+		jobs, err := p.redisRepo.ClaimStaleProcessingJobs(ctx, consumer, shared.ProcessingRetryDelay, 1)
+		if err == nil && len(jobs) == 0 {
+			jobs, err = p.redisRepo.ReadProcessingJobs(ctx, consumer, 1, processingPollInterval)
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("[Worker] %s failed to read the processing queue: %v", consumer, err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(processingPollInterval):
+			}
+			// The queue may have been missing or flushed
+			p.redisRepo.EnsureProcessingQueue(ctx)
+			continue
+		}
+
+		for _, queued := range jobs {
+			p.handle(ctx, queued)
+		}
+	}
+}
+
+// handle runs one delivery of a job
+func (p *ProcessingWorkerPool) handle(ctx context.Context, queued repository.QueuedJob) {
+	attempt := int(queued.Deliveries)
+	if queued.Job.UserID == "" || (queued.Job.PhotoID == "" && queued.Job.Kind != model.ProcessingJobUserPrivacy) {
+		p.giveUp(ctx, queued, "malformed job")
+		return
+	}
+	if attempt > shared.MaxProcessingAttempts {
+		// The earlier attempts never reported back: their workers crashed or stalled on this photo
+		p.giveUp(ctx, queued, "processing did not finish")
+		return
+	}
+
+	jobCtx, cancel := context.WithTimeout(ctx, shared.ProcessingJobTimeout)
+	err := p.run(jobCtx, queued.Job, attempt)
+	cancel()
+	if err == nil {
+		// If the acknowledgement is lost the job is delivered again and skipped as done
+		if err := p.redisRepo.AckProcessingJob(ctx, queued.ID); err != nil {
+			log.Printf("[Worker] Failed to acknowledge job %s: %v", queued.ID, err)
+		}
+		return
+	}
+	if ctx.Err() != nil {
+		// Shutting down; the job is retried later
+		return
+	}
+	if attempt >= shared.MaxProcessingAttempts {
+		p.giveUp(ctx, queued, err.Error())
+		return
+	}
+
+	log.Printf("[Worker] Job %s for photo %q failed (attempt %d of %d, retrying in %s): %v",
+		queued.ID, queued.Job.PhotoID, attempt, shared.MaxProcessingAttempts, shared.ProcessingRetryDelay, err)
+	p.recordFailure(ctx, queued.Job, attempt, err.Error(), false)
+}
+
+// run dispatches a job by kind
+func (p *ProcessingWorkerPool) run(ctx context.Context, job model.ProcessingJob, attempt int) error {
+	switch job.Kind {
+	case model.ProcessingJobUserPrivacy:
+		return p.uploader.QueuePrivacyJobs(ctx, job)
+	case model.ProcessingJobPhotoPrivacy:
+		return p.uploader.ReapplyPhotoPrivacy(ctx, job)
+	default:
+		return p.uploader.ProcessPhoto(ctx, job, attempt)
+	}
+}
+
+// recordFailure notes a failed upload processing attempt on the photo. Privacy jobs leave the
+// processing state of their photo alone.
+func (p *ProcessingWorkerPool) recordFailure(ctx context.Context, job model.ProcessingJob, attempt int, reason string, final bool) {
+	if job.Kind == model.ProcessingJobUserPrivacy || job.Kind == model.ProcessingJobPhotoPrivacy {
+		return
+	}
+	p.uploader.RecordProcessingFailure(ctx, job, attempt, reason, final)
+}
+
+// giveUp dead-letters a job and marks the photo of an upload failed
+func (p *ProcessingWorkerPool) giveUp(ctx context.Context, queued repository.QueuedJob, reason string) {
+	log.Printf("[Worker] Giving up on job %s for photo %q after %d attempts: %s", queued.ID, queued.Job.PhotoID, queued.Deliveries, reason)
+	if err := p.redisRepo.DeadLetterProcessingJob(ctx, queued, reason); err != nil {
+		// Still pending; the next claim tries again
+		return
+	}
+	if queued.Job.PhotoID != "" {
+		p.recordFailure(ctx, queued.Job, int(queued.Deliveries), reason, true)
+	}
+}
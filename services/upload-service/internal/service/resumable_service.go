@@ -0,0 +1,238 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"seungpyolee.com/pkg/model"
+	"seungpyolee.com/pkg/shared"
+	"seungpyolee.com/services/upload-service/internal/repository"
+)
+
+// resumableLockTTL bounds how long a crashed PATCH can block its upload
+const resumableLockTTL = 5 * time.Minute
+
+// ResumableUploadService implements the tus 1.0 resumable upload protocol.
+// Chunks are staged as Azure blocks of a staging blob; once every byte has arrived
+// the staging blob is committed and fed through UploaderService.UploadPhoto.
+type ResumableUploadService interface {
+	CreateUpload(ctx context.Context, userID string, length int64, fileName string, details model.PhotoUploadRequest) (*model.ResumableUpload, error)
+	GetUpload(ctx context.Context, userID, uploadID string) (*model.ResumableUpload, error)
+	AppendChunk(ctx context.Context, userID, uploadID string, offset int64, chunk io.Reader) (*model.ResumableUpload, error)
+	TerminateUpload(ctx context.Context, userID, uploadID string) error
+}
+
+type resumableUploadServiceImpl struct {
+	blobRepo  repository.AzureBlobRepository
+	redisRepo repository.RedisRepository
+	uploader  UploaderService
+}
+
+func NewResumableUploadService(
+	blobRepo repository.AzureBlobRepository,
+	redisRepo repository.RedisRepository,
+	uploader UploaderService,
+) ResumableUploadService {
+	return &resumableUploadServiceImpl{
+		blobRepo:  blobRepo,
+		redisRepo: redisRepo,
+		uploader:  uploader,
+	}
+}
+
+// CreateUpload registers a new upload of length bytes
+func (s *resumableUploadServiceImpl) CreateUpload(ctx context.Context, userID string, length int64, fileName string, details model.PhotoUploadRequest) (*model.ResumableUpload, error) {
+	if length < 0 {
+		return nil, fmt.Errorf("%w: Upload-Length must not be negative", ErrInvalidPhotoDetails)
+	}
+	if length > shared.MaxUploadFileSize {
+		return nil, ErrUploadTooLarge
+	}
+	if fileName == "" {
+		return nil, fmt.Errorf("%w: filename metadata is required", ErrInvalidPhotoDetails)
+	}
+	details, err := normalizeUploadDetails(details)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	upload := &model.ResumableUpload{
+		UploadID:    uuid.New().String(),
+		UserID:      userID,
+		Length:      length,
+		FileName:    fileName,
+		Title:       details.Title,
+		Description: details.Description,
+		AltText:     details.AltText,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(shared.ResumableUploadTTL),
+	}
+	if err := s.redisRepo.SetResumableUpload(ctx, upload); err != nil {
+		return nil, err
+	}
+
+	log.Printf("[Resumable] Upload created: %s (%d bytes) by user %s", upload.UploadID, length, userID)
+	return upload, nil
+}
+
+// GetUpload returns the current state of an upload owned by userID
+func (s *resumableUploadServiceImpl) GetUpload(ctx context.Context, userID, uploadID string) (*model.ResumableUpload, error) {
+	upload, err := s.redisRepo.GetResumableUpload(ctx, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	if upload == nil {
+		return nil, ErrUploadNotFound
+	}
+	if upload.UserID != userID {
+		return nil, ErrUploadForbidden
+	}
+	return upload, nil
+}
+
+// AppendChunk stages chunk at offset. Progress is recorded even if the chunk is cut
+// short, so the client can resume from the offset reported by HEAD. When the final
+// byte arrives the upload is processed and PhotoID is set on the returned state.
+func (s *resumableUploadServiceImpl) AppendChunk(ctx context.Context, userID, uploadID string, offset int64, chunk io.Reader) (*model.ResumableUpload, error) {
+	locked, err := s.redisRepo.LockResumableUpload(ctx, uploadID, resumableLockTTL)
+	if err != nil {
+		return nil, err
+	}
+	if !locked {
+		return nil, ErrUploadLocked
+	}
+	defer s.redisRepo.UnlockResumableUpload(context.Background(), uploadID)
+
+	upload, err := s.GetUpload(ctx, userID, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	if offset != upload.Offset {
+		return upload, ErrUploadOffsetMismatch
+	}
+
+	// Stage the chunk, never accepting more than the declared length
+	remaining := upload.Length - upload.Offset
+	blockIDs, n, stageErr := s.blobRepo.StageBlocks(ctx, stagingBlobName(upload), len(upload.BlockIDs), io.LimitReader(chunk, remaining))
+	upload.BlockIDs = append(upload.BlockIDs, blockIDs...)
+	upload.Offset += n
+	if err := s.redisRepo.SetResumableUpload(ctx, upload); err != nil {
+		return nil, err
+	}
+	if stageErr != nil {
+		log.Printf("[Resumable] Upload %s interrupted at offset %d: %v", uploadID, upload.Offset, stageErr)
+		return upload, stageErr
+	}
+	if upload.Offset == upload.Length {
+		var extra [1]byte
+		if n, _ := chunk.Read(extra[:]); n > 0 {
+			return upload, ErrUploadTooLarge
+		}
+	}
+
+	if upload.Offset < upload.Length || upload.PhotoID != "" {
+		return upload, nil
+	}
+	return upload, s.completeUpload(ctx, upload)
+}
+
+// completeUpload commits the staging blob and runs it through the regular upload pipeline.
+// Uploads the pipeline rejects are discarded; after other failures the committed blob is
+// kept so the client can retry the final PATCH.
+func (s *resumableUploadServiceImpl) completeUpload(ctx context.Context, upload *model.ResumableUpload) error {
+	blobName := stagingBlobName(upload)
+	if !upload.Committed {
+		if _, err := s.blobRepo.CommitBlocks(ctx, blobName, upload.BlockIDs, "application/octet-stream"); err != nil {
+			log.Printf("[Resumable] Failed to commit staging blob for upload %s: %v", upload.UploadID, err)
+			return err
+		}
+		upload.Committed = true
+		if err := s.redisRepo.SetResumableUpload(ctx, upload); err != nil {
+			log.Printf("[Resumable] Failed to record commit of upload %s: %v (non-fatal)", upload.UploadID, err)
+		}
+	}
+
+	staged, err := s.blobRepo.OpenBlob(ctx, blobName)
+	if err != nil {
+		log.Printf("[Resumable] Failed to open staging blob for upload %s: %v", upload.UploadID, err)
+		return err
+	}
+	details := model.PhotoUploadRequest{
+		Title:       upload.Title,
+		Description: upload.Description,
+		AltText:     upload.AltText,
+	}
+	photoID, duplicate, err := s.uploader.UploadPhoto(ctx, upload.UserID, upload.FileName, details, staged)
+	staged.Close()
+	if err != nil {
+		log.Printf("[Resumable] Failed to process upload %s: %v", upload.UploadID, err)
+		if rejectedUpload(err) {
+			s.discardUpload(context.Background(), upload)
+		}
+		return err
+	}
+
+	upload.PhotoID, upload.Duplicate = photoID, duplicate
+	if err := s.redisRepo.SetResumableUpload(ctx, upload); err != nil {
+		log.Printf("[Resumable] Failed to record photo for upload %s: %v (non-fatal)", upload.UploadID, err)
+	}
+	if err := s.blobRepo.DeleteBlob(ctx, blobName); err != nil && !errors.Is(err, repository.ErrBlobNotFound) {
+		log.Printf("[Resumable] Failed to delete staging blob %s: %v (non-fatal)", blobName, err)
+	}
+
+	log.Printf("[Resumable] Upload %s completed as photo %s", upload.UploadID, photoID)
+	return nil
+}
+
+// rejectedUpload reports whether the upload pipeline refused the content itself, so
+// processing the same bytes again would fail the same way
+func rejectedUpload(err error) bool {
+	return errors.Is(err, ErrUnsupportedMediaType) || errors.Is(err, ErrInvalidPhotoDetails) || errors.Is(err, ErrUploadTooLarge)
+}
+
+// TerminateUpload discards an unfinished upload and its staged data
+func (s *resumableUploadServiceImpl) TerminateUpload(ctx context.Context, userID, uploadID string) error {
+	locked, err := s.redisRepo.LockResumableUpload(ctx, uploadID, resumableLockTTL)
+	if err != nil {
+		return err
+	}
+	if !locked {
+		return ErrUploadLocked
+	}
+	defer s.redisRepo.UnlockResumableUpload(context.Background(), uploadID)
+
+	upload, err := s.GetUpload(ctx, userID, uploadID)
+	if err != nil {
+		return err
+	}
+	if err := s.discardUpload(ctx, upload); err != nil {
+		return err
+	}
+
+	log.Printf("[Resumable] Upload terminated: %s by user %s", uploadID, userID)
+	return nil
+}
+
+// discardUpload deletes an upload's staging blob and state. Uncommitted blocks are garbage
+// collected by Azure; a committed staging blob is not.
+func (s *resumableUploadServiceImpl) discardUpload(ctx context.Context, upload *model.ResumableUpload) error {
+	if err := s.blobRepo.DeleteBlob(ctx, stagingBlobName(upload)); err != nil && !errors.Is(err, repository.ErrBlobNotFound) {
+		log.Printf("[Resumable] Failed to delete staging blob for upload %s: %v", upload.UploadID, err)
+	}
+	if err := s.redisRepo.DeleteResumableUpload(ctx, upload.UploadID); err != nil {
+		log.Printf("[Resumable] Failed to delete state of upload %s: %v", upload.UploadID, err)
+		return err
+	}
+	return nil
+}
+
+// stagingBlobName returns the blob that collects a resumable upload's chunks: tus/{userID}/{uploadID}
+func stagingBlobName(upload *model.ResumableUpload) string {
+	return fmt.Sprintf("tus/%s/%s", upload.UserID, upload.UploadID)
+}
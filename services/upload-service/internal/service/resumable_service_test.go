@@ -0,0 +1,255 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"seungpyolee.com/pkg/model"
+	"seungpyolee.com/pkg/shared"
+)
+
+// stubUploader records what completed uploads hand to the upload pipeline
+type stubUploader struct {
+	UploaderService
+	mu       sync.Mutex
+	received []string
+	errs     []error // Returned by successive calls; nil once exhausted
+}
+
+func (u *stubUploader) UploadPhoto(ctx context.Context, userID, fileName string, details model.PhotoUploadRequest, fileData io.Reader) (string, bool, error) {
+	data, err := io.ReadAll(fileData)
+	if err != nil {
+		return "", false, err
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.received = append(u.received, string(data))
+	if len(u.errs) > 0 {
+		err, u.errs = u.errs[0], u.errs[1:]
+		if err != nil {
+			return "", false, err
+		}
+	}
+	return "photo-1", false, nil
+}
+
+func newTestResumable(uploader *stubUploader) (*resumableUploadServiceImpl, *fakeBlobRepo, *fakeRedisRepo) {
+	blobs, redis := newFakeBlobRepo(), &fakeRedisRepo{}
+	svc := NewResumableUploadService(blobs, redis, uploader)
+	return svc.(*resumableUploadServiceImpl), blobs, redis
+}
+
+// failingReader returns its data, then err instead of io.EOF
+type failingReader struct {
+	data string
+	err  error
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if r.data == "" {
+		return 0, r.err
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestCreateUploadValidation(t *testing.T) {
+	svc, _, _ := newTestResumable(&stubUploader{})
+	tests := []struct {
+		name     string
+		length   int64
+		fileName string
+		wantErr  error
+	}{
+		{"negative length", -1, "a.jpg", ErrInvalidPhotoDetails},
+		{"too large", shared.MaxUploadFileSize + 1, "a.jpg", ErrUploadTooLarge},
+		{"missing file name", 10, "", ErrInvalidPhotoDetails},
+		{"empty upload", 0, "a.jpg", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upload, err := svc.CreateUpload(context.Background(), "user-1", tt.length, tt.fileName, model.PhotoUploadRequest{})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("CreateUpload() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && (upload.Offset != 0 || upload.Length != tt.length || upload.UploadID == "") {
+				t.Fatalf("CreateUpload() = %+v", upload)
+			}
+		})
+	}
+}
+
+func TestAppendChunkOffsetsAndCompletion(t *testing.T) {
+	ctx := context.Background()
+	uploader := &stubUploader{}
+	svc, blobs, _ := newTestResumable(uploader)
+	upload, err := svc.CreateUpload(ctx, "user-1", 10, "a.jpg", model.PhotoUploadRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := upload.UploadID
+
+	if upload, err = svc.AppendChunk(ctx, "user-1", id, 0, strings.NewReader("abcdef")); err != nil || upload.Offset != 6 {
+		t.Fatalf("first chunk: offset %d, error %v", upload.Offset, err)
+	}
+	// A retry of the first chunk, as after a lost response, must not be staged twice
+	if upload, err = svc.AppendChunk(ctx, "user-1", id, 0, strings.NewReader("abcdef")); !errors.Is(err, ErrUploadOffsetMismatch) || upload.Offset != 6 {
+		t.Fatalf("stale offset: offset %d, error %v; want 6, ErrUploadOffsetMismatch", upload.Offset, err)
+	}
+	if _, err = svc.AppendChunk(ctx, "user-2", id, 6, strings.NewReader("ghij")); !errors.Is(err, ErrUploadForbidden) {
+		t.Fatalf("other user: error %v, want ErrUploadForbidden", err)
+	}
+	if len(uploader.received) != 0 {
+		t.Fatalf("upload processed before its last byte arrived")
+	}
+
+	if upload, err = svc.AppendChunk(ctx, "user-1", id, 6, strings.NewReader("ghij")); err != nil {
+		t.Fatalf("last chunk: %v", err)
+	}
+	if upload.Offset != 10 || upload.PhotoID != "photo-1" {
+		t.Fatalf("last chunk: offset %d, photo %q", upload.Offset, upload.PhotoID)
+	}
+	if len(uploader.received) != 1 || uploader.received[0] != "abcdefghij" {
+		t.Fatalf("uploader received %q, want [abcdefghij]", uploader.received)
+	}
+	if _, ok := blobs.blobs[stagingBlobName(upload)]; ok {
+		t.Fatalf("staging blob kept after completion")
+	}
+
+	// Retrying the final PATCH reports the photo without processing the upload again
+	if upload, err = svc.AppendChunk(ctx, "user-1", id, 10, strings.NewReader("")); err != nil || upload.PhotoID != "photo-1" {
+		t.Fatalf("retried final chunk: photo %q, error %v", upload.PhotoID, err)
+	}
+	if len(uploader.received) != 1 {
+		t.Fatalf("completed upload processed %d times", len(uploader.received))
+	}
+}
+
+func TestAppendChunkRejectsExtraBytes(t *testing.T) {
+	ctx := context.Background()
+	uploader := &stubUploader{}
+	svc, _, _ := newTestResumable(uploader)
+	upload, _ := svc.CreateUpload(ctx, "user-1", 4, "a.jpg", model.PhotoUploadRequest{})
+
+	upload, err := svc.AppendChunk(ctx, "user-1", upload.UploadID, 0, strings.NewReader("abcdef"))
+	if !errors.Is(err, ErrUploadTooLarge) {
+		t.Fatalf("AppendChunk() error = %v, want ErrUploadTooLarge", err)
+	}
+	if upload.Offset != 4 || len(uploader.received) != 0 {
+		t.Fatalf("oversized chunk: offset %d, processed %d times", upload.Offset, len(uploader.received))
+	}
+}
+
+func TestAppendChunkInterruptedKeepsProgress(t *testing.T) {
+	ctx := context.Background()
+	svc, _, _ := newTestResumable(&stubUploader{})
+	upload, _ := svc.CreateUpload(ctx, "user-1", 10, "a.jpg", model.PhotoUploadRequest{})
+	id := upload.UploadID
+
+	cut := errors.New("connection reset")
+	upload, err := svc.AppendChunk(ctx, "user-1", id, 0, &failingReader{data: "abcdefg", err: cut})
+	if !errors.Is(err, cut) || upload.Offset != 7 {
+		t.Fatalf("interrupted chunk: offset %d, error %v; want 7, %v", upload.Offset, err, cut)
+	}
+	if upload, err = svc.GetUpload(ctx, "user-1", id); err != nil || upload.Offset != 7 {
+		t.Fatalf("GetUpload() offset %d, error %v; want 7", upload.Offset, err)
+	}
+	if upload, err = svc.AppendChunk(ctx, "user-1", id, 7, strings.NewReader("hij")); err != nil || upload.PhotoID == "" {
+		t.Fatalf("resumed chunk: photo %q, error %v", upload.PhotoID, err)
+	}
+}
+
+func TestAppendChunkLocked(t *testing.T) {
+	ctx := context.Background()
+	svc, _, redis := newTestResumable(&stubUploader{})
+	upload, _ := svc.CreateUpload(ctx, "user-1", 10, "a.jpg", model.PhotoUploadRequest{})
+
+	redis.LockResumableUpload(ctx, upload.UploadID, resumableLockTTL)
+	if _, err := svc.AppendChunk(ctx, "user-1", upload.UploadID, 0, strings.NewReader("abc")); !errors.Is(err, ErrUploadLocked) {
+		t.Fatalf("AppendChunk() error = %v, want ErrUploadLocked", err)
+	}
+	if err := svc.TerminateUpload(ctx, "user-1", upload.UploadID); !errors.Is(err, ErrUploadLocked) {
+		t.Fatalf("TerminateUpload() error = %v, want ErrUploadLocked", err)
+	}
+}
+
+func TestCompleteUploadRejectedContentIsDiscarded(t *testing.T) {
+	ctx := context.Background()
+	uploader := &stubUploader{errs: []error{ErrUnsupportedMediaType}}
+	svc, blobs, _ := newTestResumable(uploader)
+	upload, _ := svc.CreateUpload(ctx, "user-1", 4, "a.txt", model.PhotoUploadRequest{})
+	id := upload.UploadID
+
+	if _, err := svc.AppendChunk(ctx, "user-1", id, 0, strings.NewReader("text")); !errors.Is(err, ErrUnsupportedMediaType) {
+		t.Fatalf("AppendChunk() error = %v, want ErrUnsupportedMediaType", err)
+	}
+	if len(blobs.blobs) != 0 {
+		t.Fatalf("staging blob kept after the content was rejected: %v", blobs.blobs)
+	}
+	if _, err := svc.AppendChunk(ctx, "user-1", id, 4, strings.NewReader("")); !errors.Is(err, ErrUploadNotFound) {
+		t.Fatalf("retry after rejection: error %v, want ErrUploadNotFound", err)
+	}
+	if len(uploader.received) != 1 {
+		t.Fatalf("rejected upload processed %d times", len(uploader.received))
+	}
+}
+
+func TestCompleteUploadRetriesWithoutRecommitting(t *testing.T) {
+	ctx := context.Background()
+	uploader := &stubUploader{errs: []error{errors.New("database unavailable")}}
+	svc, blobs, _ := newTestResumable(uploader)
+	upload, _ := svc.CreateUpload(ctx, "user-1", 6, "a.jpg", model.PhotoUploadRequest{})
+	id := upload.UploadID
+
+	if _, err := svc.AppendChunk(ctx, "user-1", id, 0, strings.NewReader("abcdef")); err == nil {
+		t.Fatalf("AppendChunk() succeeded although processing failed")
+	}
+	upload, err := svc.AppendChunk(ctx, "user-1", id, 6, strings.NewReader(""))
+	if err != nil || upload.PhotoID != "photo-1" {
+		t.Fatalf("retried final chunk: photo %q, error %v", upload.PhotoID, err)
+	}
+	if blobs.commits != 1 {
+		t.Fatalf("staging blob committed %d times, want 1", blobs.commits)
+	}
+	if strings.Join(uploader.received, ",") != "abcdef,abcdef" {
+		t.Fatalf("uploader received %q", uploader.received)
+	}
+	if len(blobs.blobs) != 0 {
+		t.Fatalf("staging blob kept after completion")
+	}
+}
+
+func TestTerminateUpload(t *testing.T) {
+	ctx := context.Background()
+	uploader := &stubUploader{errs: []error{errors.New("database unavailable")}}
+	svc, blobs, _ := newTestResumable(uploader)
+
+	// A committed staging blob, left behind by a failed completion, is removed too
+	upload, _ := svc.CreateUpload(ctx, "user-1", 3, "a.jpg", model.PhotoUploadRequest{})
+	id := upload.UploadID
+	svc.AppendChunk(ctx, "user-1", id, 0, strings.NewReader("abc"))
+	if len(blobs.blobs) != 1 {
+		t.Fatalf("expected a committed staging blob, have %v", blobs.blobs)
+	}
+
+	if err := svc.TerminateUpload(ctx, "user-2", id); !errors.Is(err, ErrUploadForbidden) {
+		t.Fatalf("TerminateUpload() by another user: error %v, want ErrUploadForbidden", err)
+	}
+	if err := svc.TerminateUpload(ctx, "user-1", id); err != nil {
+		t.Fatalf("TerminateUpload() error = %v", err)
+	}
+	if len(blobs.blobs) != 0 {
+		t.Fatalf("staging blob kept after termination")
+	}
+	if _, err := svc.GetUpload(ctx, "user-1", id); !errors.Is(err, ErrUploadNotFound) {
+		t.Fatalf("GetUpload() after termination: error %v, want ErrUploadNotFound", err)
+	}
+	if err := svc.TerminateUpload(ctx, "user-1", id); !errors.Is(err, ErrUploadNotFound) {
+		t.Fatalf("second TerminateUpload() error = %v, want ErrUploadNotFound", err)
+	}
+}
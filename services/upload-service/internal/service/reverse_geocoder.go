@@ -0,0 +1,325 @@
+package service
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	// Embed the IANA zone database so time zone lookups work in minimal containers
+	_ "time/tzdata"
+
+	"seungpyolee.com/pkg/model"
+)
+
+// DefaultGeocoderMaxDistanceKm is how far a photo may be from the nearest known place and still be labelled with it
+const DefaultGeocoderMaxDistanceKm = 100
+
+// timeZoneMaxDistanceKm bounds how far the nearest place may be for its zone to be used;
+// beyond it, typically at sea, the zone is derived from longitude
+const timeZoneMaxDistanceKm = 1500
+
+const earthRadiusKm = 6371.0
+
+// maxPlaceLineLength bounds a dataset line; GeoNames rows carry long lists of alternate names
+const maxPlaceLineLength = 1 << 20
+
+// GeocoderDataset names the files a ReverseGeocoder is built from
+type GeocoderDataset struct {
+	// PlacesFile is required: a GeoNames cities dump such as cities15000.txt, or rows of name,
+	// region, country code, country, latitude, longitude and an optional IANA time zone
+	PlacesFile string
+	// RegionsFile and CountriesFile are the optional GeoNames admin1CodesASCII.txt and
+	// countryInfo.txt naming the regions and countries of a dump; without them the codes are used
+	RegionsFile   string
+	CountriesFile string
+}
+
+// PlaceNames maps the codes in a GeoNames dump to names
+type PlaceNames struct {
+	Regions   map[string]string // "KR.11" -> "Seoul"
+	Countries map[string]string // "KR" -> "South Korea"
+}
+
+// ReverseGeocoder resolves coordinates to the nearest known place without any network calls.
+// Places are kept in a k-d tree over unit vectors on the sphere, so lookups are
+// logarithmic and behave correctly across the antimeridian and near the poles.
+type ReverseGeocoder struct {
+	root           *placeNode
+	size           int
+	maxChordDistSq float64
+	tzChordDistSq  float64
+}
+
+type placeNode struct {
+	place       model.PhotoPlace
+	location    *time.Location // nil when the dataset has no zone for the place
+	point       [3]float64
+	left, right *placeNode
+}
+
+// LoadReverseGeocoder builds a geocoder from the files of dataset.
+// A maxDistanceKm of zero uses DefaultGeocoderMaxDistanceKm.
+func LoadReverseGeocoder(dataset GeocoderDataset, maxDistanceKm float64) (*ReverseGeocoder, error) {
+	if dataset.PlacesFile == "" {
+		return nil, errors.New("a place dataset file is required")
+	}
+	var names PlaceNames
+	var err error
+	if dataset.RegionsFile != "" {
+		// admin1CodesASCII.txt: code, name, ASCII name, geoname ID
+		if names.Regions, err = loadCodeNames(dataset.RegionsFile, 0, 1); err != nil {
+			return nil, err
+		}
+	}
+	if dataset.CountriesFile != "" {
+		// countryInfo.txt: ISO code, ISO3 code, numeric code, FIPS code, name, ...
+		if names.Countries, err = loadCodeNames(dataset.CountriesFile, 0, 4); err != nil {
+			return nil, err
+		}
+	}
+
+	f, err := os.Open(dataset.PlacesFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open place dataset: %w", err)
+	}
+	defer f.Close()
+	return NewReverseGeocoder(f, names, maxDistanceKm)
+}
+
+// loadCodeNames reads a tab-separated GeoNames file into a map from the code column to the name column
+func loadCodeNames(path string, codeCol, nameCol int) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open place names: %w", err)
+	}
+	defer f.Close()
+
+	names := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, maxPlaceLineLength)
+	for scanner.Scan() {
+		text := scanner.Text()
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Split(text, "\t")
+		if len(fields) <= max(codeCol, nameCol) {
+			return nil, fmt.Errorf("place names file %s: expected at least %d fields", path, max(codeCol, nameCol)+1)
+		}
+		names[fields[codeCol]] = fields[nameCol]
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read place names: %w", err)
+	}
+	return names, nil
+}
+
+// geoNamesColumns is the number of columns of a GeoNames dump row
+const geoNamesColumns = 19
+
+// NewReverseGeocoder builds a geocoder from tab-separated place rows: either GeoNames dump rows,
+// whose region and country codes are looked up in names, or rows of name, region, country code,
+// country, latitude, longitude and an optional IANA time zone. Blank lines and lines starting
+// with # are skipped.
+func NewReverseGeocoder(r io.Reader, names PlaceNames, maxDistanceKm float64) (*ReverseGeocoder, error) {
+	if maxDistanceKm == 0 {
+		maxDistanceKm = DefaultGeocoderMaxDistanceKm
+	}
+	if maxDistanceKm < 0 || math.IsNaN(maxDistanceKm) {
+		return nil, fmt.Errorf("invalid geocoder max distance %v", maxDistanceKm)
+	}
+
+	var nodes []*placeNode
+	zones := make(map[string]*time.Location)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxPlaceLineLength)
+	for line := 1; scanner.Scan(); line++ {
+		// Only line endings are trimmed; trailing columns of a row may be empty
+		text := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(text) == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Split(text, "\t")
+		var place model.PhotoPlace
+		var latText, lngText, zone string
+		switch len(fields) {
+		case 6, 7:
+			place = model.PhotoPlace{City: fields[0], Region: fields[1], CountryCode: strings.ToUpper(fields[2]), Country: fields[3]}
+			latText, lngText = fields[4], fields[5]
+			if len(fields) == 7 {
+				zone = fields[6]
+			}
+		case geoNamesColumns:
+			place = names.place(fields)
+			latText, lngText, zone = fields[4], fields[5], fields[17]
+		default:
+			return nil, fmt.Errorf("place dataset line %d: expected 6, 7 or %d fields, got %d", line, geoNamesColumns, len(fields))
+		}
+
+		lat, latErr := strconv.ParseFloat(latText, 64)
+		lng, lngErr := strconv.ParseFloat(lngText, 64)
+		if latErr != nil || lngErr != nil || lat < -90 || lat > 90 || lng < -180 || lng > 180 {
+			return nil, fmt.Errorf("place dataset line %d: invalid coordinates", line)
+		}
+		var location *time.Location
+		if zone != "" {
+			loc, err := loadLocation(zones, zone)
+			if err != nil {
+				return nil, fmt.Errorf("place dataset line %d: %w", line, err)
+			}
+			location = loc
+		}
+		nodes = append(nodes, &placeNode{
+			place:    place,
+			location: location,
+			point:    unitVector(lat, lng),
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read place dataset: %w", err)
+	}
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("place dataset is empty")
+	}
+
+	// Compare squared chord lengths instead of great-circle distances during the search
+	return &ReverseGeocoder{
+		root:           buildPlaceTree(nodes, 0),
+		size:           len(nodes),
+		maxChordDistSq: chordDistSq(maxDistanceKm),
+		tzChordDistSq:  chordDistSq(timeZoneMaxDistanceKm),
+	}, nil
+}
+
+// place builds the place of a GeoNames dump row: name, admin1 region and country
+func (n PlaceNames) place(fields []string) model.PhotoPlace {
+	countryCode := strings.ToUpper(fields[8])
+	region := fields[10]
+	if name, ok := n.Regions[countryCode+"."+fields[10]]; ok {
+		region = name
+	}
+	country := countryCode
+	if name, ok := n.Countries[countryCode]; ok {
+		country = name
+	}
+	return model.PhotoPlace{City: fields[1], Region: region, CountryCode: countryCode, Country: country}
+}
+
+// loadLocation loads an IANA zone once per dataset
+func loadLocation(zones map[string]*time.Location, name string) (*time.Location, error) {
+	if loc, ok := zones[name]; ok {
+		return loc, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone %q", name)
+	}
+	zones[name] = loc
+	return loc, nil
+}
+
+// Size returns the number of places in the index
+func (g *ReverseGeocoder) Size() int {
+	return g.size
+}
+
+// Lookup returns the place nearest to the given coordinates, if one lies within the configured distance
+func (g *ReverseGeocoder) Lookup(lat, lng float64) (*model.PhotoPlace, bool) {
+	target := unitVector(lat, lng)
+	best, bestDist := g.root.nearest(target, 0, nil, nil, math.Inf(1))
+	if best == nil || bestDist > g.maxChordDistSq {
+		return nil, false
+	}
+	place := best.place
+	return &place, true
+}
+
+// TimeZone returns an approximation of the time zone at the given coordinates: the zone of
+// the nearest place with one, which can be a neighbouring zone near borders, or far from any
+// place (at sea) the nautical zone of the longitude, so a zone is always returned. No zone
+// boundary data is used; callers record the result as model.TimeZoneSourceGPSLocationApprox
+// unless another source confirms its offset.
+func (g *ReverseGeocoder) TimeZone(lat, lng float64) *time.Location {
+	best, bestDist := g.root.nearest(unitVector(lat, lng), 0, hasZone, nil, math.Inf(1))
+	if best != nil && bestDist <= g.tzChordDistSq {
+		return best.location
+	}
+	return nauticalZone(lng)
+}
+
+func hasZone(n *placeNode) bool {
+	return n.location != nil
+}
+
+// nauticalZone returns the fixed zone of 15-degree longitude bands, e.g. "UTC+9"
+func nauticalZone(lng float64) *time.Location {
+	hours := int(math.Round(lng / 15))
+	if hours == 0 {
+		return time.UTC
+	}
+	return time.FixedZone(fmt.Sprintf("UTC%+d", hours), hours*3600)
+}
+
+// buildPlaceTree splits nodes on the median of the x, y and z axes in turn
+func buildPlaceTree(nodes []*placeNode, depth int) *placeNode {
+	if len(nodes) == 0 {
+		return nil
+	}
+	axis := depth % 3
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].point[axis] < nodes[j].point[axis] })
+	mid := len(nodes) / 2
+	n := nodes[mid]
+	n.left = buildPlaceTree(nodes[:mid], depth+1)
+	n.right = buildPlaceTree(nodes[mid+1:], depth+1)
+	return n
+}
+
+// nearest finds the closest node accepted by match, or any node when match is nil
+func (n *placeNode) nearest(target [3]float64, depth int, match func(*placeNode) bool, best *placeNode, bestDist float64) (*placeNode, float64) {
+	if n == nil {
+		return best, bestDist
+	}
+	if d := squaredDistance(n.point, target); d < bestDist && (match == nil || match(n)) {
+		best, bestDist = n, d
+	}
+
+	axis := depth % 3
+	diff := target[axis] - n.point[axis]
+	near, far := n.left, n.right
+	if diff > 0 {
+		near, far = n.right, n.left
+	}
+	best, bestDist = near.nearest(target, depth+1, match, best, bestDist)
+	// Only descend the other side if the splitting plane is closer than the best match
+	if diff*diff < bestDist {
+		best, bestDist = far.nearest(target, depth+1, match, best, bestDist)
+	}
+	return best, bestDist
+}
+
+// chordDistSq converts a great-circle distance to the squared chord length between unit vectors
+func chordDistSq(km float64) float64 {
+	chord := 2 * math.Sin(math.Min(km/earthRadiusKm, math.Pi)/2)
+	return chord * chord
+}
+
+func unitVector(lat, lng float64) [3]float64 {
+	phi := lat * math.Pi / 180
+	lambda := lng * math.Pi / 180
+	return [3]float64{
+		math.Cos(phi) * math.Cos(lambda),
+		math.Cos(phi) * math.Sin(lambda),
+		math.Sin(phi),
+	}
+}
+
+func squaredDistance(a, b [3]float64) float64 {
+	dx, dy, dz := a[0]-b[0], a[1]-b[1], a[2]-b[2]
+	return dx*dx + dy*dy + dz*dz
+}
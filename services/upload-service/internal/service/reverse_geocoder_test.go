@@ -0,0 +1,65 @@
+package service
+
+import (
+	"testing"
+
+	"seungpyolee.com/pkg/model"
+)
+
+func TestLoadReverseGeocoder(t *testing.T) {
+	geoNames := GeocoderDataset{
+		PlacesFile:    "testdata/cities.txt",
+		RegionsFile:   "testdata/admin1CodesASCII.txt",
+		CountriesFile: "testdata/countryInfo.txt",
+	}
+	tests := []struct {
+		name     string
+		dataset  GeocoderDataset
+		lat, lng float64
+		want     *model.PhotoPlace
+		wantErr  bool
+	}{
+		{"places file required", GeocoderDataset{}, 0, 0, nil, true},
+		{"missing file", GeocoderDataset{PlacesFile: "testdata/missing.txt"}, 0, 0, nil, true},
+		{"tsv rows", GeocoderDataset{PlacesFile: "testdata/places.tsv"}, 37.57, 126.98,
+			&model.PhotoPlace{City: "Seoul", Region: "Seoul", CountryCode: "KR", Country: "South Korea"}, false},
+		{"geonames dump with names", geoNames, 51.5, -0.1,
+			&model.PhotoPlace{City: "London", Region: "England", CountryCode: "GB", Country: "United Kingdom"}, false},
+		{"region without a name keeps its code", geoNames, 25.77, -80.19,
+			&model.PhotoPlace{City: "Miami", Region: "FL", CountryCode: "US", Country: "United States"}, false},
+		{"geonames dump without names", GeocoderDataset{PlacesFile: "testdata/cities.txt"}, 35.1, 129.0,
+			&model.PhotoPlace{City: "Busan", Region: "10", CountryCode: "KR", Country: "KR"}, false},
+		{"too far from any place", geoNames, 0, 0, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := LoadReverseGeocoder(tt.dataset, 0)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadReverseGeocoder() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			got, ok := g.Lookup(tt.lat, tt.lng)
+			if tt.want == nil {
+				if ok {
+					t.Fatalf("Lookup(%v, %v) = %+v, want no place", tt.lat, tt.lng, got)
+				}
+				return
+			}
+			if !ok || *got != *tt.want {
+				t.Fatalf("Lookup(%v, %v) = %+v, %v; want %+v", tt.lat, tt.lng, got, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestGeoNamesTimeZone(t *testing.T) {
+	g, err := LoadReverseGeocoder(GeocoderDataset{PlacesFile: "testdata/cities.txt"}, 0)
+	if err != nil {
+		t.Fatalf("LoadReverseGeocoder: %v", err)
+	}
+	if got := g.TimeZone(25.8, -80.2).String(); got != "America/New_York" {
+		t.Fatalf("TimeZone near Miami = %s, want America/New_York", got)
+	}
+}
@@ -0,0 +1,215 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"sort"
+	"strings"
+
+	"github.com/rwcarlsen/goexif/exif"
+	"github.com/rwcarlsen/goexif/tiff"
+	"seungpyolee.com/pkg/model"
+)
+
+// sharedJPEGQuality is used for the sanitized full-size copy served to non-owners
+const sharedJPEGQuality = 92
+
+// exifIFDPointerTag links IFD0 to the Exif sub-IFD
+const exifIFDPointerTag = 0x8769
+
+// droppedExifFields are never copied into a sanitized image: sub-IFD pointers are rebuilt,
+// orientation is baked into the pixels, dimensions change, and maker notes and thumbnails
+// are opaque blobs that can carry location data of their own
+var droppedExifFields = map[exif.FieldName]bool{
+	exif.ExifIFDPointer:                   true,
+	exif.GPSInfoIFDPointer:                true,
+	exif.InteroperabilityIFDPointer:       true,
+	exif.InteroperabilityIndex:            true,
+	exif.Orientation:                      true,
+	exif.PixelXDimension:                  true,
+	exif.PixelYDimension:                  true,
+	exif.MakerNote:                        true,
+	exif.ThumbJPEGInterchangeFormat:       true,
+	exif.ThumbJPEGInterchangeFormatLength: true,
+}
+
+// sharedContentType picks the format of the sanitized copy: PNG stays PNG to keep transparency,
+// everything else becomes JPEG
+func sharedContentType(originalType string) string {
+	if originalType == "image/png" {
+		return "image/png"
+	}
+	return "image/jpeg"
+}
+
+// sharedBlobName returns the blob name of the sanitized copy: {userID}/{photoID}_shared-{mode}{ext}.
+// Naming copies by mode means a write of a superseded mode never overwrites the current copy.
+func sharedBlobName(userID, photoID, contentType, mode string) string {
+	ext := ".jpg"
+	if contentType == "image/png" {
+		ext = ".png"
+	}
+	return fmt.Sprintf("%s/%s_%s-%s%s", userID, photoID, model.VariantShared, mode, ext)
+}
+
+// encodeSanitized encodes img, whose orientation is already baked in, for non-owners.
+// Re-encoding drops every tag of the original; under strip_gps a JPEG copy gets the
+// original's EXIF back without GPS, orientation or maker notes. exifData may be nil.
+func encodeSanitized(img image.Image, contentType, mode string, exifData *exif.Exif) ([]byte, error) {
+	var buf bytes.Buffer
+	if contentType == "image/png" {
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: sharedJPEGQuality}); err != nil {
+		return nil, err
+	}
+	if mode != model.PrivacyModeStripGPS || exifData == nil {
+		return buf.Bytes(), nil
+	}
+
+	segment, ok := sanitizedExifSegment(exifData)
+	if !ok {
+		return buf.Bytes(), nil
+	}
+	// Insert the APP1 segment right after the SOI marker
+	encoded := buf.Bytes()
+	out := make([]byte, 0, len(encoded)+len(segment))
+	out = append(out, encoded[:2]...)
+	out = append(out, segment...)
+	out = append(out, encoded[2:]...)
+	return out, nil
+}
+
+// sanitizedExifSegment rebuilds a JPEG APP1 Exif segment from the decoded tags,
+// leaving out GPS and droppedExifFields. It reports false when nothing is left to write
+// or the result does not fit in one segment.
+func sanitizedExifSegment(exifData *exif.Exif) ([]byte, bool) {
+	if exifData.Tiff == nil || len(exifData.Tiff.Dirs) == 0 {
+		return nil, false
+	}
+
+	// Tags found in IFD0 stay there; everything else belongs in the Exif sub-IFD
+	inIFD0 := make(map[uint16]bool)
+	for _, tag := range exifData.Tiff.Dirs[0].Tags {
+		inIFD0[tag.Id] = true
+	}
+
+	var ifd0, exifIFD []*tiff.Tag
+	exifData.Walk(walkFunc(func(name exif.FieldName, tag *tiff.Tag) error {
+		if droppedExifFields[name] || strings.HasPrefix(string(name), "GPS") {
+			return nil
+		}
+		if inIFD0[tag.Id] {
+			ifd0 = append(ifd0, tag)
+		} else {
+			exifIFD = append(exifIFD, tag)
+		}
+		return nil
+	}))
+	if len(ifd0) == 0 && len(exifIFD) == 0 {
+		return nil, false
+	}
+
+	order := exifData.Tiff.Order
+	if len(exifIFD) > 0 {
+		// The pointer value is patched once the size of IFD0 is known
+		ifd0 = append(ifd0, &tiff.Tag{Id: exifIFDPointerTag, Type: tiff.DTLong, Count: 1, Val: make([]byte, 4)})
+	}
+	sortTags(ifd0)
+	sortTags(exifIFD)
+
+	const headerLen = 8
+	exifOffset := uint32(headerLen + ifdLen(ifd0))
+	if len(exifIFD) > 0 {
+		for _, tag := range ifd0 {
+			if tag.Id == exifIFDPointerTag {
+				order.PutUint32(tag.Val, exifOffset)
+			}
+		}
+	}
+
+	body := make([]byte, headerLen, int(exifOffset)+ifdLen(exifIFD))
+	if order == binary.BigEndian {
+		copy(body, "MM")
+	} else {
+		copy(body, "II")
+	}
+	order.PutUint16(body[2:], 42)
+	order.PutUint32(body[4:], headerLen)
+	body = appendIFD(body, ifd0, order)
+	if len(exifIFD) > 0 {
+		body = appendIFD(body, exifIFD, order)
+	}
+
+	// APP1 length covers itself, the Exif identifier and the TIFF body
+	const exifHeader = "Exif\x00\x00"
+	length := 2 + len(exifHeader) + len(body)
+	if length > 0xFFFF {
+		return nil, false
+	}
+	segment := make([]byte, 0, 2+length)
+	segment = append(segment, 0xFF, 0xE1, byte(length>>8), byte(length))
+	segment = append(segment, exifHeader...)
+	segment = append(segment, body...)
+	return segment, true
+}
+
+// ifdLen is the size of an IFD including the out-of-line values that follow it
+func ifdLen(tags []*tiff.Tag) int {
+	n := 2 + 12*len(tags) + 4
+	for _, tag := range tags {
+		if len(tag.Val) > 4 {
+			n += len(tag.Val) + len(tag.Val)%2
+		}
+	}
+	return n
+}
+
+// appendIFD writes an IFD at the end of body followed by its out-of-line values.
+// Tag values are copied as raw bytes, so body must use the byte order they were read with.
+func appendIFD(body []byte, tags []*tiff.Tag, order binary.ByteOrder) []byte {
+	start := len(body)
+	dataOffset := uint32(start + 2 + 12*len(tags) + 4)
+
+	entries := make([]byte, 2+12*len(tags)+4)
+	order.PutUint16(entries, uint16(len(tags)))
+	var data []byte
+	for i, tag := range tags {
+		e := entries[2+12*i:]
+		order.PutUint16(e[0:], tag.Id)
+		order.PutUint16(e[2:], uint16(tag.Type))
+		order.PutUint32(e[4:], tag.Count)
+		if len(tag.Val) <= 4 {
+			copy(e[8:12], tag.Val)
+			continue
+		}
+		order.PutUint32(e[8:], dataOffset+uint32(len(data)))
+		data = append(data, tag.Val...)
+		// Values start on a word boundary
+		if len(data)%2 == 1 {
+			data = append(data, 0)
+		}
+	}
+	// Next IFD offset stays zero: no thumbnail IFD is written
+	body = append(body, entries...)
+	return append(body, data...)
+}
+
+func sortTags(tags []*tiff.Tag) {
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Id < tags[j].Id })
+}
+
+// walkFunc adapts a function to exif.Walker
+type walkFunc func(name exif.FieldName, tag *tiff.Tag) error
+
+func (f walkFunc) Walk(name exif.FieldName, tag *tiff.Tag) error {
+	return f(name, tag)
+}
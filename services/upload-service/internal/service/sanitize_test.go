@@ -0,0 +1,180 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+
+	"github.com/rwcarlsen/goexif/exif"
+	"github.com/rwcarlsen/goexif/tiff"
+	"seungpyolee.com/pkg/model"
+)
+
+// makerNote stands in for a vendor blob that can carry location data of its own
+var makerNote = []byte("MAKERNOTE 37.5665N 126.9780E")
+
+func asciiTag(id uint16, s string) *tiff.Tag {
+	return &tiff.Tag{Id: id, Type: tiff.DTAscii, Count: uint32(len(s) + 1), Val: append([]byte(s), 0)}
+}
+
+func longTag(id uint16, v uint32) *tiff.Tag {
+	val := make([]byte, 4)
+	binary.LittleEndian.PutUint32(val, v)
+	return &tiff.Tag{Id: id, Type: tiff.DTLong, Count: 1, Val: val}
+}
+
+func shortTag(id uint16, v uint16) *tiff.Tag {
+	val := make([]byte, 4)
+	binary.LittleEndian.PutUint16(val, v)
+	return &tiff.Tag{Id: id, Type: tiff.DTShort, Count: 1, Val: val}
+}
+
+func rationalTag(id uint16, pairs ...uint32) *tiff.Tag {
+	val := make([]byte, 4*len(pairs))
+	for i, v := range pairs {
+		binary.LittleEndian.PutUint32(val[4*i:], v)
+	}
+	return &tiff.Tag{Id: id, Type: tiff.DTRational, Count: uint32(len(pairs) / 2), Val: val}
+}
+
+// jpegWithExif encodes img and inserts an APP1 segment holding camera tags, an orientation,
+// a maker note, GPS coordinates and a thumbnail IFD, the way cameras write them
+func jpegWithExif(t *testing.T, img image.Image) []byte {
+	var thumb bytes.Buffer
+	if err := jpeg.Encode(&thumb, image.NewGray(image.Rect(0, 0, 8, 8)), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	exifIFD := []*tiff.Tag{
+		rationalTag(0x829D, 28, 10), // FNumber
+		asciiTag(0x9003, "2024:05:01 18:42:10"),
+		{Id: 0x927C, Type: tiff.DTUndefined, Count: uint32(len(makerNote)), Val: makerNote},
+	}
+	gpsIFD := []*tiff.Tag{
+		asciiTag(0x0001, "N"),
+		rationalTag(0x0002, 37, 1, 33, 1, 5988, 100),
+		asciiTag(0x0003, "E"),
+		rationalTag(0x0004, 126, 1, 58, 1, 4080, 100),
+	}
+	ifd0 := []*tiff.Tag{
+		asciiTag(0x010F, "Canon"),
+		asciiTag(0x0110, "Canon EOS R6"),
+		shortTag(0x0112, 6), // Orientation
+		longTag(exifIFDPointerTag, 0),
+		longTag(0x8825, 0), // GPSInfoIFDPointer
+	}
+	ifd1 := []*tiff.Tag{
+		shortTag(0x0103, 6), // Compression: JPEG
+		longTag(0x0201, 0),  // ThumbJPEGInterchangeFormat
+		longTag(0x0202, uint32(thumb.Len())),
+	}
+
+	// Lay out header, IFD0, Exif IFD, GPS IFD, IFD1 and the thumbnail in that order
+	exifOffset := uint32(8 + ifdLen(ifd0))
+	gpsOffset := exifOffset + uint32(ifdLen(exifIFD))
+	ifd1Offset := gpsOffset + uint32(ifdLen(gpsIFD))
+	thumbOffset := ifd1Offset + uint32(ifdLen(ifd1))
+	binary.LittleEndian.PutUint32(ifd0[3].Val, exifOffset)
+	binary.LittleEndian.PutUint32(ifd0[4].Val, gpsOffset)
+	binary.LittleEndian.PutUint32(ifd1[1].Val, thumbOffset)
+
+	body := []byte{'I', 'I', 42, 0, 8, 0, 0, 0}
+	body = appendIFD(body, ifd0, binary.LittleEndian)
+	// Link IFD0 to the thumbnail IFD
+	binary.LittleEndian.PutUint32(body[8+2+12*len(ifd0):], ifd1Offset)
+	body = appendIFD(body, exifIFD, binary.LittleEndian)
+	body = appendIFD(body, gpsIFD, binary.LittleEndian)
+	body = appendIFD(body, ifd1, binary.LittleEndian)
+	body = append(body, thumb.Bytes()...)
+
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	length := 2 + 6 + len(body)
+	segment := append([]byte{0xFF, 0xE1, byte(length >> 8), byte(length)}, "Exif\x00\x00"...)
+	out := append([]byte{}, encoded.Bytes()[:2]...)
+	out = append(out, segment...)
+	out = append(out, body...)
+	return append(out, encoded.Bytes()[2:]...)
+}
+
+func TestEncodeSanitizedRemovesLocation(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 64, 48))
+	for y := 0; y < 48; y++ {
+		for x := 0; x < 64; x++ {
+			img.Set(x, y, color.RGBA{uint8(4 * x), uint8(5 * y), 90, 255})
+		}
+	}
+	original, err := exif.Decode(bytes.NewReader(jpegWithExif(t, img)))
+	if err != nil {
+		t.Fatalf("fixture does not decode: %v", err)
+	}
+	// Guard the fixture: everything the sanitizer must remove is really there
+	for _, name := range []exif.FieldName{exif.GPSLatitude, exif.GPSLongitude, exif.MakerNote, exif.Orientation, exif.ThumbJPEGInterchangeFormat} {
+		if _, err := original.Get(name); err != nil {
+			t.Fatalf("fixture lacks %s: %v", name, err)
+		}
+	}
+
+	removed := []exif.FieldName{
+		exif.GPSInfoIFDPointer, exif.GPSLatitudeRef, exif.GPSLatitude, exif.GPSLongitudeRef, exif.GPSLongitude,
+		exif.MakerNote, exif.Orientation, exif.ThumbJPEGInterchangeFormat, exif.ThumbJPEGInterchangeFormatLength,
+	}
+	kept := map[exif.FieldName]string{
+		exif.Make:             `"Canon"`,
+		exif.Model:            `"Canon EOS R6"`,
+		exif.DateTimeOriginal: `"2024:05:01 18:42:10"`,
+		exif.FNumber:          `"28/10"`,
+	}
+
+	for _, mode := range []string{model.PrivacyModeStripGPS, model.PrivacyModeStripAll} {
+		t.Run(mode, func(t *testing.T) {
+			out, err := encodeSanitized(img, "image/jpeg", mode, original)
+			if err != nil {
+				t.Fatalf("encodeSanitized() error = %v", err)
+			}
+			if _, err := jpeg.Decode(bytes.NewReader(out)); err != nil {
+				t.Fatalf("sanitized copy is not a valid JPEG: %v", err)
+			}
+			if bytes.Contains(out, makerNote) {
+				t.Fatalf("sanitized copy still holds the maker note bytes")
+			}
+
+			sanitized, err := exif.Decode(bytes.NewReader(out))
+			if mode == model.PrivacyModeStripAll {
+				if err == nil {
+					t.Fatalf("strip_all copy still has EXIF data")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("strip_gps copy has no readable EXIF: %v", err)
+			}
+			for _, name := range removed {
+				if tag, err := sanitized.Get(name); err == nil {
+					t.Errorf("%s survived: %v", name, tag)
+				}
+			}
+			for name, want := range kept {
+				tag, err := sanitized.Get(name)
+				if err != nil {
+					t.Errorf("%s was dropped", name)
+					continue
+				}
+				if got := tag.String(); got != want {
+					t.Errorf("%s = %s, want %s", name, got, want)
+				}
+			}
+			if lat, lng, err := sanitized.LatLong(); err == nil {
+				t.Errorf("coordinates survived: %f, %f", lat, lng)
+			}
+			if len(sanitized.Tiff.Dirs) != 1 {
+				t.Errorf("sanitized TIFF has %d top-level IFDs, want 1 (no thumbnail IFD)", len(sanitized.Tiff.Dirs))
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package service
+
+import "io"
+
+// teeConsumer feeds a byte stream to a consumer goroutine through a pipe.
+// Consumers such as the EXIF decoder stop reading long before the stream ends;
+// after that, writes are discarded so the producer is never blocked or failed.
+type teeConsumer struct {
+	pw      *io.PipeWriter
+	stopped bool
+	done    chan struct{}
+}
+
+func newTeeConsumer(consume func(r io.Reader)) *teeConsumer {
+	pr, pw := io.Pipe()
+	t := &teeConsumer{pw: pw, done: make(chan struct{})}
+	go func() {
+		defer close(t.done)
+		consume(pr)
+		// Unblock any pending write once the consumer has what it needs
+		pr.Close()
+	}()
+	return t
+}
+
+// Write always reports success so it can sit inside an io.MultiWriter
+func (t *teeConsumer) Write(p []byte) (int, error) {
+	if !t.stopped {
+		if _, err := t.pw.Write(p); err != nil {
+			t.stopped = true
+		}
+	}
+	return len(p), nil
+}
+
+// Close signals end of stream and waits for the consumer to return
+func (t *teeConsumer) Close() {
+	t.pw.Close()
+	<-t.done
+}
@@ -0,0 +1,207 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/disintegration/imaging"
+	"seungpyolee.com/pkg/model"
+)
+
+// Fit modes of a variant profile
+const (
+	// FitModeFit scales the image down to fit inside Width x Height, keeping the aspect ratio
+	FitModeFit = "fit"
+	// FitModeFill scales and center-crops the image to exactly Width x Height
+	FitModeFill = "fill"
+	// FitModeCrop center-crops Width x Height out of the image without scaling
+	FitModeCrop = "crop"
+)
+
+// resampleFilters maps profile filter names to imaging filters
+var resampleFilters = map[string]imaging.ResampleFilter{
+	"nearest":           imaging.NearestNeighbor,
+	"box":               imaging.Box,
+	"linear":            imaging.Linear,
+	"hermite":           imaging.Hermite,
+	"mitchellnetravali": imaging.MitchellNetravali,
+	"catmullrom":        imaging.CatmullRom,
+	"bspline":           imaging.BSpline,
+	"gaussian":          imaging.Gaussian,
+	"lanczos":           imaging.Lanczos,
+}
+
+// profileNamePattern keeps profile names safe for use in blob names
+var profileNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,31}$`)
+
+// VariantProfile describes one resized copy generated for every uploaded image.
+// A zero Width or Height leaves that dimension unconstrained in fit mode.
+type VariantProfile struct {
+	Name    string `json:"name"`
+	Width   int    `json:"width"`
+	Height  int    `json:"height"`
+	Fit     string `json:"fit"`     // fit, fill or crop
+	Format  string `json:"format"`  // jpeg or png
+	Quality int    `json:"quality"` // JPEG quality 1-100
+	Filter  string `json:"filter"`  // resampling filter, e.g. lanczos
+}
+
+// DefaultVariantProfiles reproduces the original 1080/720/480 wide JPEG variants
+func DefaultVariantProfiles() []VariantProfile {
+	profiles := make([]VariantProfile, 0, len(legacyResizeWidths))
+	for _, w := range legacyResizeWidths {
+		profiles = append(profiles, VariantProfile{
+			Name:    strconv.Itoa(w),
+			Width:   w,
+			Fit:     FitModeFit,
+			Format:  "jpeg",
+			Quality: 85,
+			Filter:  "lanczos",
+		})
+	}
+	return profiles
+}
+
+// LoadVariantProfiles reads profiles from inline JSON, or failing that from a JSON file.
+// With neither set the defaults are returned. Example:
+//
+//	[{"name":"thumb","width":256,"height":256,"fit":"fill","format":"jpeg","quality":80},
+//	 {"name":"large","width":2048,"height":2048,"fit":"fit","format":"jpeg","quality":90}]
+func LoadVariantProfiles(inlineJSON, path string) ([]VariantProfile, error) {
+	var data []byte
+	switch {
+	case strings.TrimSpace(inlineJSON) != "":
+		data = []byte(inlineJSON)
+	case path != "":
+		fileData, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read variant profiles file: %w", err)
+		}
+		data = fileData
+	default:
+		return DefaultVariantProfiles(), nil
+	}
+
+	var profiles []VariantProfile
+	if err := json.Unmarshal(data, &profiles); err != nil {
+		return nil, fmt.Errorf("failed to parse variant profiles: %w", err)
+	}
+
+	seen := map[string]bool{}
+	for i := range profiles {
+		if err := profiles[i].normalize(); err != nil {
+			return nil, err
+		}
+		if seen[profiles[i].Name] {
+			return nil, fmt.Errorf("duplicate variant profile %q", profiles[i].Name)
+		}
+		seen[profiles[i].Name] = true
+	}
+	return profiles, nil
+}
+
+// normalize fills defaults and validates the profile. "original" and "shared" are reserved:
+// their blobs are the upload itself and the sanitized copy, which a profile would overwrite
+func (p *VariantProfile) normalize() error {
+	if !profileNamePattern.MatchString(p.Name) || p.Name == model.VariantOriginal || p.Name == model.VariantShared {
+		return fmt.Errorf("invalid variant profile name %q", p.Name)
+	}
+	if p.Fit == "" {
+		p.Fit = FitModeFit
+	}
+	if p.Format == "" {
+		p.Format = "jpeg"
+	}
+	if p.Quality == 0 {
+		p.Quality = 85
+	}
+	if p.Filter == "" {
+		p.Filter = "lanczos"
+	}
+
+	switch p.Fit {
+	case FitModeFit:
+		if p.Width <= 0 && p.Height <= 0 {
+			return fmt.Errorf("variant profile %q: fit needs a width or height", p.Name)
+		}
+	case FitModeFill, FitModeCrop:
+		if p.Width <= 0 || p.Height <= 0 {
+			return fmt.Errorf("variant profile %q: %s needs both width and height", p.Name, p.Fit)
+		}
+	default:
+		return fmt.Errorf("variant profile %q: unknown fit mode %q", p.Name, p.Fit)
+	}
+	if p.Width < 0 || p.Height < 0 {
+		return fmt.Errorf("variant profile %q: dimensions must not be negative", p.Name)
+	}
+	if p.Format != "jpeg" && p.Format != "png" {
+		return fmt.Errorf("variant profile %q: unknown format %q", p.Name, p.Format)
+	}
+	if p.Quality < 1 || p.Quality > 100 {
+		return fmt.Errorf("variant profile %q: quality must be between 1 and 100", p.Name)
+	}
+	if _, ok := resampleFilters[p.Filter]; !ok {
+		return fmt.Errorf("variant profile %q: unknown filter %q", p.Name, p.Filter)
+	}
+	return nil
+}
+
+// Apply produces the variant image, or returns false when the source is too small
+// (variants are never upscaled)
+func (p VariantProfile) Apply(img image.Image) (image.Image, bool) {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	filter := resampleFilters[p.Filter]
+
+	switch p.Fit {
+	case FitModeFill:
+		if w < p.Width || h < p.Height {
+			return nil, false
+		}
+		return imaging.Fill(img, p.Width, p.Height, imaging.Center, filter), true
+	case FitModeCrop:
+		if w < p.Width || h < p.Height {
+			return nil, false
+		}
+		return imaging.CropCenter(img, p.Width, p.Height), true
+	default:
+		if (p.Width == 0 || w <= p.Width) && (p.Height == 0 || h <= p.Height) {
+			return nil, false
+		}
+		if p.Width == 0 || p.Height == 0 {
+			return imaging.Resize(img, p.Width, p.Height, filter), true
+		}
+		return imaging.Fit(img, p.Width, p.Height, filter), true
+	}
+}
+
+// Encode writes img in the profile's output format
+func (p VariantProfile) Encode(w io.Writer, img image.Image) error {
+	if p.Format == "png" {
+		return png.Encode(w, img)
+	}
+	return jpeg.Encode(w, img, &jpeg.Options{Quality: p.Quality})
+}
+
+// ContentType returns the MIME type of the profile's output format
+func (p VariantProfile) ContentType() string {
+	if p.Format == "png" {
+		return "image/png"
+	}
+	return "image/jpeg"
+}
+
+// Extension returns the blob file extension of the profile's output format
+func (p VariantProfile) Extension() string {
+	if p.Format == "png" {
+		return ".png"
+	}
+	return ".jpg"
+}
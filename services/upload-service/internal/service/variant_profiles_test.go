@@ -0,0 +1,25 @@
+package service
+
+import "testing"
+
+func TestLoadVariantProfilesNames(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		wantErr bool
+	}{
+		{"valid", `[{"name":"thumb","width":256,"height":256,"fit":"fill"}]`, false},
+		{"original reserved", `[{"name":"original","width":256}]`, true},
+		{"shared reserved", `[{"name":"shared","width":256}]`, true},
+		{"uppercase", `[{"name":"Thumb","width":256}]`, true},
+		{"duplicate", `[{"name":"a","width":256},{"name":"a","width":512}]`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadVariantProfiles(tt.json, "")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadVariantProfiles(%s) error = %v, wantErr %v", tt.json, err, tt.wantErr)
+			}
+		})
+	}
+}